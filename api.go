@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// maxAPIBody caps the size of a JSON request body.
+const maxAPIBody = 1 << 20
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeValidationErrors reports which fields of a JSON body were invalid,
+// keyed by their JSON names.
+func writeValidationErrors(w http.ResponseWriter, errs fieldErrors) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "Invalid fields", "fields": errs})
+}
+
+// readJSON decodes a request body into v, rejecting unknown fields so typos
+// in scripts are caught.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// apiPantryHandler lists the household's pantry items (GET) or adds one from
+// a JSON PantryItem (POST).
+func apiPantryHandler(w http.ResponseWriter, r *http.Request) {
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		sortPantryItems(store.PantryItems)
+		writeJSON(w, http.StatusOK, store.PantryItems)
+	case http.MethodPost:
+		var item PantryItem
+		if !readJSON(w, r, &item) {
+			return
+		}
+		item.Tags = mergeTags(nil, item.Tags...)
+		sortTags(item.Tags)
+		errs := validatePantryItem(&item)
+		if err := validatePlace(hh, errs, "position", item.LocationID, item.Position); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		item.ID = store.NextPantryID
+		store.PantryItems = append(store.PantryItems, item)
+		store.NextPantryID++
+		if err := saveStore(hh, store); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, item)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// apiFreezerHandler lists the household's freezer meals (GET) or adds one
+// from a JSON FreezerMeal (POST).
+func apiFreezerHandler(w http.ResponseWriter, r *http.Request) {
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		sortFreezerMeals(store.FreezerMeals)
+		writeJSON(w, http.StatusOK, store.FreezerMeals)
+	case http.MethodPost:
+		var meal FreezerMeal
+		if !readJSON(w, r, &meal) {
+			return
+		}
+		meal.Tags = mergeTags(nil, meal.Tags...)
+		sortTags(meal.Tags)
+		errs := validateFreezerMeal(&meal)
+		if err := validatePlace(hh, errs, "position", meal.LocationID, meal.Position); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		meal.ID = store.NextMealID
+		meal.Ingredients = nil
+		store.FreezerMeals = append(store.FreezerMeals, meal)
+		store.NextMealID++
+		if err := saveStore(hh, store); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, meal)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// apiShoppingHandler lists the household's shopping list.
+func apiShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSafeMethod(r.Method) {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	items, err := loadShoppingList(householdID(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// apiPathID reads the "{id}" path segment, writing a JSON 404 if it isn't a
+// number.
+func apiPathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeConflict reports an update made to an out-of-date version, with the
+// item as it now is so the caller can merge and try again.
+func writeConflict(w http.ResponseWriter, current any) {
+	writeJSON(w, http.StatusConflict, map[string]any{
+		"error":   "The item has changed since the version given; merge with current and try again",
+		"current": current,
+	})
+}
+
+// writeSaveError answers a failed save: 409 if another save changed the
+// same items first, or 500.
+func writeSaveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errConflict) {
+		writeJSONError(w, http.StatusConflict, "The inventory changed while saving; reload and try again")
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, "Failed to save data")
+}
+
+// apiPantryItemHandler returns a pantry item (GET) or replaces it with a
+// JSON PantryItem (PUT). A PUT must give the version it was made to, and is
+// refused with 409 if the item has changed since. Batches are kept, as they
+// are changed on the item's page.
+func apiPantryItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiPathID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	i := pantryIndex(store, id)
+	if i < 0 {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, store.PantryItems[i])
+	case http.MethodPut:
+		var item PantryItem
+		if !readJSON(w, r, &item) {
+			return
+		}
+		item.Tags = mergeTags(nil, item.Tags...)
+		sortTags(item.Tags)
+		errs := validatePantryItem(&item)
+		errs.check(item.Version > 0, "version", "Give the version of the item the change was made to.")
+		if err := validatePlace(hh, errs, "position", item.LocationID, item.Position); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		current := store.PantryItems[i]
+		item.ID = id
+		item.Batches = current.Batches
+		item.syncBatches()
+		if pantryConflicts(item.Version, item, current) {
+			writeConflict(w, current)
+			return
+		}
+		store.PantryItems[i] = item
+		if err := saveStore(hh, store); err != nil {
+			// Someone else saved the item between loading and saving.
+			if errors.Is(err, errConflict) {
+				if store, err := loadStore(hh); err == nil {
+					if i := pantryIndex(store, id); i >= 0 {
+						writeConflict(w, store.PantryItems[i])
+						return
+					}
+				}
+			}
+			writeSaveError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, store.PantryItems[i])
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// apiFreezerItemHandler returns a freezer meal (GET) or replaces it with a
+// JSON FreezerMeal (PUT), which must give its version as for pantry items.
+// Batch-cook ingredients are kept.
+func apiFreezerItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiPathID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	i := freezerIndex(store, id)
+	if i < 0 {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, store.FreezerMeals[i])
+	case http.MethodPut:
+		var meal FreezerMeal
+		if !readJSON(w, r, &meal) {
+			return
+		}
+		meal.Tags = mergeTags(nil, meal.Tags...)
+		sortTags(meal.Tags)
+		errs := validateFreezerMeal(&meal)
+		errs.check(meal.Version > 0, "version", "Give the version of the meal the change was made to.")
+		if err := validatePlace(hh, errs, "position", meal.LocationID, meal.Position); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+		if len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+		current := store.FreezerMeals[i]
+		meal.ID = id
+		meal.Ingredients = current.Ingredients
+		if mealConflicts(meal.Version, meal, current) {
+			writeConflict(w, current)
+			return
+		}
+		store.FreezerMeals[i] = meal
+		if err := saveStore(hh, store); err != nil {
+			if errors.Is(err, errConflict) {
+				if store, err := loadStore(hh); err == nil {
+					if i := freezerIndex(store, id); i >= 0 {
+						writeConflict(w, store.FreezerMeals[i])
+						return
+					}
+				}
+			}
+			writeSaveError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, store.FreezerMeals[i])
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
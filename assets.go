@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// embeddedAssets are the templates and static files built into the binary,
+// so it runs from any directory.
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// staticCacheControl is sent with content-hashed static URLs. A changed file
+// gets a new URL, so browsers can keep the old one forever.
+const staticCacheControl = "public, max-age=31536000, immutable"
+
+// assetFS returns where templates and static files are loaded from: the
+// -assets directory in dev mode, otherwise the embedded copies.
+func assetFS() fs.FS {
+	if config.Dev {
+		return os.DirFS(config.Assets)
+	}
+	return embeddedAssets
+}
+
+var (
+	staticHashesMu sync.Mutex
+	staticHashes   = make(map[string]string)
+)
+
+// staticHash returns a short hash of a static file's contents. Hashes of the
+// embedded files are cached, as they can't change while the server runs.
+func staticHash(name string) (string, error) {
+	if !config.Dev {
+		staticHashesMu.Lock()
+		defer staticHashesMu.Unlock()
+		if h, ok := staticHashes[name]; ok {
+			return h, nil
+		}
+	}
+	data, err := fs.ReadFile(assetFS(), path.Join("static", name))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	h := hex.EncodeToString(sum[:5])
+	if !config.Dev {
+		staticHashes[name] = h
+	}
+	return h, nil
+}
+
+// staticURL returns the content-hashed URL of a static file, such as
+// /static/style.0a1b2c3d4e.css for style.css. A file that can't be read gets
+// its plain URL.
+func staticURL(name string) string {
+	h, err := staticHash(name)
+	if err != nil {
+		return "/static/" + name
+	}
+	ext := path.Ext(name)
+	return "/static/" + strings.TrimSuffix(name, ext) + "." + h + ext
+}
+
+// splitHashedName splits a hashed static file name back into the file's own
+// name and the hash, or returns ok false if name has no hash.
+func splitHashedName(name string) (file, hash string, ok bool) {
+	ext := path.Ext(name)
+	base, hash, found := cutLast(strings.TrimSuffix(name, ext), ".")
+	if !found || len(hash) != 10 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", "", false
+	}
+	return base + ext, hash, true
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// staticHandler serves static files under /static/. A URL whose hash matches
+// the file is cached for a year; any other URL, including the plain file
+// name, must be revalidated.
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	cacheControl := "no-cache"
+	if file, hash, ok := splitHashedName(name); ok {
+		if current, err := staticHash(file); err == nil {
+			name = file
+			if hash == current {
+				cacheControl = staticCacheControl
+			}
+		}
+	}
+
+	fsys := assetFS()
+	p := path.Join("static", name)
+	if !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+	if info, err := fs.Stat(fsys, p); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	http.ServeFileFS(w, r, fsys, p)
+}
+
+// offlineAssets are the static files the service worker keeps, so the
+// inventory page works without a connection.
+var offlineAssets = []string{"style.css", "offline.js", "live.js", "icon.svg", "manifest.json"}
+
+// serviceWorkerHandler serves the service worker from the root, so it can
+// control every page, with the hashed URLs of offlineAssets written in. A
+// changed asset changes the script, which is how browsers know to update it.
+func serviceWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := fs.ReadFile(assetFS(), "static/sw.js")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	urls := make([]string, len(offlineAssets))
+	for i, name := range offlineAssets {
+		urls[i] = staticURL(name)
+	}
+	assets, _ := json.Marshal(urls)
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "const ASSETS = %s;\n\n", assets)
+	w.Write(data)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func getStatic(t *testing.T, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func TestStaticURLIsHashed(t *testing.T) {
+	url := staticURL("style.css")
+	if !regexp.MustCompile(`^/static/style\.[0-9a-f]{10}\.css$`).MatchString(url) {
+		t.Fatalf("unexpected static URL %q", url)
+	}
+
+	// Static files need no login, and the hashed URL is cached for good.
+	w := getStatic(t, url)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != staticCacheControl {
+		t.Errorf("expected long-lived caching, got %q", got)
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("expected CSS, got %q", w.Header().Get("Content-Type"))
+	}
+
+	// The plain name and a stale hash still work but must be revalidated.
+	for _, u := range []string{"/static/style.css", "/static/style.0000000000.css"} {
+		w := getStatic(t, u)
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s: expected 200 with no-cache, got %d %q", u, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	for _, u := range []string{"/static/missing.css", "/static/", "/static/..%2ftemplates%2flogin.html"} {
+		if w := getStatic(t, u); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", u, w.Code)
+		}
+	}
+}
+
+func TestPagesLinkHashedStylesheet(t *testing.T) {
+	setupHandlerTest(t)
+	w := httptest.NewRecorder()
+	loginHandler(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if !strings.Contains(w.Body.String(), `href="`+staticURL("style.css")+`"`) {
+		t.Error("expected the page to link the hashed stylesheet")
+	}
+}
+
+func TestDevModeLoadsFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"templates", "static"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("templates/page.html", "first")
+	write("static/app.css", "body {}")
+
+	orig := config
+	t.Cleanup(func() { config = orig })
+	config.Dev = true
+	config.Assets = dir
+
+	renderPage := func() string {
+		w := httptest.NewRecorder()
+		render(w, httptest.NewRequest(http.MethodGet, "/", nil), "page.html", nil)
+		return w.Body.String()
+	}
+	if got := renderPage(); got != "first" {
+		t.Fatalf("expected the template from disk, got %q", got)
+	}
+	write("templates/page.html", "second")
+	if got := renderPage(); got != "second" {
+		t.Errorf("expected the edited template, got %q", got)
+	}
+
+	before := staticURL("app.css")
+	write("static/app.css", "body { color: red }")
+	if after := staticURL("app.css"); after == before {
+		t.Error("expected the hash to change with the file")
+	}
+	if w := getStatic(t, "/static/app.css"); w.Body.String() != "body { color: red }" {
+		t.Errorf("expected the file from disk, got %q", w.Body.String())
+	}
+}
+
+func TestServiceWorker(t *testing.T) {
+	// The service worker needs no login, so the login page can register it.
+	w := getStatic(t, "/sw.js")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected 200 with no-cache, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "const ASSETS = [") || !strings.Contains(body, staticURL("offline.js")) {
+		t.Errorf("expected the offline assets' hashed URLs, got %.120s", body)
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("expected JavaScript, got %q", w.Header().Get("Content-Type"))
+	}
+}
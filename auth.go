@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie     = "session"
+	sessionTTL        = 30 * 24 * time.Hour
+	minPasswordLength = 8
+)
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// hashToken is how session tokens are stored, so a leaked database can't be
+// used to hijack sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func countUsers() (int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+// createUser adds an account. Usernames are unique ignoring case.
+func createUser(username, password string, admin bool) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, fmt.Errorf("user %q already exists", username)
+	}
+	res, err := db.Exec("INSERT INTO users (username, password_hash, admin) VALUES (?, ?, ?)", username, hash, admin)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &User{ID: int(id), Username: username, PasswordHash: hash, Admin: admin}, nil
+}
+
+// ensureAdmin creates the first admin account when there are no users yet.
+// It does nothing once any account exists.
+func ensureAdmin(username, password string) error {
+	n, err := countUsers()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if username == "" || password == "" {
+		return errors.New("no user accounts yet: set -admin-user and -admin-password " +
+			"(or CUPBOARD_ADMIN_USER and CUPBOARD_ADMIN_PASSWORD) to create the first admin")
+	}
+	u, err := createUser(username, password, true)
+	if err != nil {
+		return err
+	}
+	return addHouseholdMember(defaultHouseholdID, u.ID)
+}
+
+func loadUsers() ([]User, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, username, password_hash, admin FROM users ORDER BY username COLLATE NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Admin); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// loadUserByName returns the named user, or nil if there is no such user.
+func loadUserByName(username string) (*User, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	u := &User{}
+	err = db.QueryRow("SELECT id, username, password_hash, admin FROM users WHERE username = ?", username).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func deleteUser(id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM api_tokens WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM household_members WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// createSession starts a session for a user and returns its token.
+func createSession(userID int) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	// Expired sessions are swept whenever someone logs in.
+	now := time.Now().UTC()
+	if _, err := db.Exec("DELETE FROM sessions WHERE expires < ?", now.Format(time.RFC3339)); err != nil {
+		return "", err
+	}
+	_, err = db.Exec("INSERT INTO sessions (token_hash, user_id, expires) VALUES (?, ?, ?)",
+		hashToken(token), userID, now.Add(sessionTTL).Format(time.RFC3339))
+	return token, err
+}
+
+// sessionUser returns the user a session token belongs to, or nil if the
+// token is unknown or expired.
+func sessionUser(token string) (*User, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	u := &User{}
+	err = db.QueryRow(`
+		SELECT u.id, u.username, u.password_hash, u.admin FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires > ?`,
+		hashToken(token), time.Now().UTC().Format(time.RFC3339),
+	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func deleteSession(token string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(token))
+	return err
+}
+
+// recordAudit appends to the audit log. A nil user is recorded as the system
+// and a zero householdID means the action wasn't about one household.
+func recordAudit(householdID int, user *User, action, detail string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var userID int
+	username := "system"
+	if user != nil {
+		userID, username = user.ID, user.Username
+	}
+	_, err = db.Exec("INSERT INTO audit_log (time, user_id, username, action, detail, household_id) VALUES (?, ?, ?, ?, ?, ?)",
+		time.Now().UTC().Format(time.RFC3339), userID, username, action, detail, householdID)
+	return err
+}
+
+// loadAuditLog returns the most recent entries first.
+func loadAuditLog(limit int) ([]AuditEntry, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT a.id, a.time, a.user_id, a.username, a.action, a.detail, COALESCE(h.name, '')
+		FROM audit_log a LEFT JOIN households h ON h.id = a.household_id
+		ORDER BY a.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.UserID, &e.Username, &e.Action, &e.Detail, &e.Household); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+type ctxKey int
+
+const (
+	userKey ctxKey = iota
+	householdKey
+	householdsKey
+	csrfKey
+	apiTokenKey
+	requestLogKey
+	auditKey
+)
+
+// currentUser returns the logged-in user, or nil outside requireUser.
+func currentUser(r *http.Request) *User {
+	u, _ := r.Context().Value(userKey).(*User)
+	return u
+}
+
+func withUser(r *http.Request, u *User) *http.Request {
+	noteRequestUser(r, u)
+	return r.WithContext(context.WithValue(r.Context(), userKey, u))
+}
+
+// isPublicPath reports whether a path can be fetched without logging in.
+// The service worker is public so the login page can register it.
+func isPublicPath(path string) bool {
+	return path == "/login" || path == "/healthz" || path == "/sw.js" || strings.HasPrefix(path, "/static/")
+}
+
+// statusRecorder remembers the status a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requireUser sends anyone without a valid session or API token to the login
+// page and records every successful change in the audit log against the
+// acting user.
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token, ok := bearerToken(r); ok {
+			if r = tokenAuth(w, r, token); r == nil {
+				return
+			}
+		} else {
+			var user *User
+			if c, err := r.Cookie(sessionCookie); err == nil {
+				u, err := sessionUser(c.Value)
+				if err != nil {
+					http.Error(w, "Failed to load session", http.StatusInternalServerError)
+					return
+				}
+				user = u
+			}
+			if user == nil {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+			households, err := userHouseholds(user.ID)
+			if err != nil {
+				http.Error(w, "Failed to load data", http.StatusInternalServerError)
+				return
+			}
+			if len(households) == 0 {
+				http.Error(w, "Your account isn't a member of any household yet. Ask an admin to add you.", http.StatusForbidden)
+				return
+			}
+			r = withHousehold(withUser(r, user), pickHousehold(r, households), households)
+		}
+		user := currentUser(r)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		outcome := &changeOutcome{}
+		r = r.WithContext(context.WithValue(r.Context(), auditKey, outcome))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status < http.StatusBadRequest && !outcome.failed {
+			if err := recordAudit(householdID(r), user, r.URL.Path, auditDetail(r)); err != nil {
+				slog.Error("audit failed", "err", err)
+			}
+		}
+	})
+}
+
+// changeOutcome lets a handler tell requireUser that a change it answered
+// with a redirect didn't happen, so it isn't audited.
+type changeOutcome struct {
+	failed bool
+}
+
+// noteChangeFailed keeps a failed change out of the audit log.
+func noteChangeFailed(r *http.Request) {
+	if o, ok := r.Context().Value(auditKey).(*changeOutcome); ok {
+		o.failed = true
+	}
+}
+
+// auditDetail summarises which record a change was about from its form.
+func auditDetail(r *http.Request) string {
+	var parts []string
+	for _, key := range []string{"id", "name", "meal", "date"} {
+		if v := r.PostFormValue(key); v != "" {
+			parts = append(parts, key+"="+v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// requireAdmin restricts a handler to admin accounts.
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if u := currentUser(r); u == nil || !u.Admin {
+			http.Error(w, "Admins only", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// safeNext keeps post-login redirects on this site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// loginPage is the data for the login form.
+type loginPage struct {
+	Next     string
+	Username string
+	Error    string
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	page := loginPage{Next: safeNext(r.FormValue("next"))}
+	if r.Method != http.MethodPost {
+		render(w, r, "login.html", page)
+		return
+	}
+	page.Username = strings.TrimSpace(r.FormValue("username"))
+	user, err := loadUserByName(page.Username)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || !checkPassword(user.PasswordHash, r.FormValue("password")) {
+		page.Error = "Wrong username or password."
+		renderStatus(w, r, http.StatusUnauthorized, "login.html", page)
+		return
+	}
+	token, err := createSession(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err := recordAudit(0, user, "/login", ""); err != nil {
+		slog.Error("audit failed", "err", err)
+	}
+	http.Redirect(w, r, page.Next, http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := deleteSession(c.Value); err != nil {
+			http.Error(w, "Failed to save data", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// usersPage is the data for the account admin page.
+type usersPage struct {
+	Users      []User
+	Households []Household
+	Members    map[int][]int
+	Audit      []AuditEntry
+	Error      string
+}
+
+// IsMember reports whether a user belongs to a household.
+func (p usersPage) IsMember(householdID, userID int) bool {
+	return containsInt(p.Members[householdID], userID)
+}
+
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	renderUsers(w, r, "")
+}
+
+func renderUsers(w http.ResponseWriter, r *http.Request, errMsg string) {
+	users, err := loadUsers()
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	households, err := loadHouseholds()
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	members, err := householdMembers()
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	audit, err := loadAuditLog(100)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusOK
+	if errMsg != "" {
+		status = http.StatusBadRequest
+	}
+	renderStatus(w, r, status, "users.html", usersPage{
+		Users:      users,
+		Households: households,
+		Members:    members,
+		Audit:      audit,
+		Error:      errMsg,
+	})
+}
+
+func addUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	u, err := createUser(r.FormValue("username"), r.FormValue("password"), r.FormValue("admin") == "on")
+	if err != nil {
+		renderUsers(w, r, err.Error())
+		return
+	}
+	// New accounts join the admin's current household unless others are
+	// picked.
+	households := []int{householdID(r)}
+	if picked := r.Form["household"]; len(picked) > 0 {
+		households = households[:0]
+		for _, v := range picked {
+			if id, err := strconv.Atoi(v); err == nil {
+				households = append(households, id)
+			}
+		}
+	}
+	for _, hh := range households {
+		if err := addHouseholdMember(hh, u.ID); err != nil {
+			saveFailed(w, r, "/users", err)
+			return
+		}
+	}
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
+
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	if u := currentUser(r); u != nil && u.ID == id {
+		renderUsers(w, r, "You can't delete your own account.")
+		return
+	}
+	if err := deleteUser(id); err != nil {
+		saveFailed(w, r, "/users", err)
+		return
+	}
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
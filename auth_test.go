@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loginAs creates a user in the default household and returns a session
+// cookie for them.
+func loginAs(t *testing.T, username string, admin bool) *http.Cookie {
+	t.Helper()
+	u, err := createUser(username, "correct horse", admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addHouseholdMember(defaultHouseholdID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	token, err := createSession(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: sessionCookie, Value: token}
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	useTempDB(t)
+
+	if _, err := createUser("", "long enough", false); err == nil {
+		t.Error("expected an error for an empty username")
+	}
+	if _, err := createUser("sam", "short", false); err == nil {
+		t.Error("expected an error for a short password")
+	}
+	if _, err := createUser("sam", "long enough", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createUser("SAM", "long enough", false); err == nil {
+		t.Error("expected usernames to be unique ignoring case")
+	}
+}
+
+func TestEnsureAdmin(t *testing.T) {
+	useTempDB(t)
+
+	if err := ensureAdmin("", ""); err == nil {
+		t.Fatal("expected an error when there are no users and no admin credentials")
+	}
+	if err := ensureAdmin("admin", "s3cret-pass"); err != nil {
+		t.Fatal(err)
+	}
+	// Once an account exists the credentials are ignored.
+	if err := ensureAdmin("", ""); err != nil {
+		t.Errorf("expected no error once users exist, got %v", err)
+	}
+	u, err := loadUserByName("admin")
+	if err != nil || u == nil || !u.Admin {
+		t.Fatalf("expected an admin account, got %+v, %v", u, err)
+	}
+	if !checkPassword(u.PasswordHash, "s3cret-pass") || u.PasswordHash == "s3cret-pass" {
+		t.Error("expected the password to be stored hashed")
+	}
+}
+
+func TestRoutesRequireLogin(t *testing.T) {
+	setupHandlerTest(t)
+
+	for _, path := range []string{"/", "/pantry/delete"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("id=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, req)
+
+		if w.Code != http.StatusSeeOther || !strings.HasPrefix(w.Header().Get("Location"), "/login") {
+			t.Errorf("%s: expected a redirect to /login, got %d %q", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the login page to be public, got %d", w.Code)
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if _, err := createUser("sam", "correct horse", false); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"username": {"sam"}, "password": {"wrong"}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	loginHandler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong password, got %d", w.Code)
+	}
+
+	form = url.Values{"username": {"sam"}, "password": {"correct horse"}, "next": {"//evil.example"}}
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	loginHandler(w, req)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("expected a redirect to /, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly session cookie, got %+v", cookies)
+	}
+	u, err := sessionUser(cookies[0].Value)
+	if err != nil || u == nil || u.Username != "sam" {
+		t.Errorf("expected the session to belong to sam, got %+v, %v", u, err)
+	}
+}
+
+func TestMutationsAreAuditedWithUser(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+
+	form := url.Values{"name": {"Rice"}, csrfFormField: {sessionCSRFToken(cookie.Value)}}
+	req := httptest.NewRequest(http.MethodPost, "/pantry/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+
+	entries, err := loadAuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Username != "sam" || entries[0].Action != "/pantry/add" ||
+		entries[0].Detail != "name=Rice" {
+		t.Errorf("expected one audit entry for sam adding Rice, got %+v", entries)
+	}
+}
+
+func TestFailedSavesAreNotAudited(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+	failing := requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		saveFailed(w, r, "/", errors.New("disk full"))
+	}))
+
+	form := url.Values{"name": {"Rice"}}
+	req := httptest.NewRequest(http.MethodPost, "/pantry/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	failing.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected the failed save to redirect back, got %d", w.Code)
+	}
+
+	entries, err := loadAuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected a failed save not to be audited, got %+v", entries)
+	}
+}
+
+func TestUsersPageIsAdminOnly(t *testing.T) {
+	setupHandlerTest(t)
+	member := loginAs(t, "sam", false)
+	admin := loginAs(t, "alex", true)
+
+	for _, tc := range []struct {
+		cookie *http.Cookie
+		want   int
+	}{{member, http.StatusForbidden}, {admin, http.StatusOK}} {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.AddCookie(tc.cookie)
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("expected %d, got %d", tc.want, w.Code)
+		}
+	}
+}
+
+func TestLogoutEndsSession(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set(csrfHeader, sessionCSRFToken(cookie.Value))
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+
+	if u, err := sessionUser(cookie.Value); err != nil || u != nil {
+		t.Errorf("expected the session to be gone, got %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// batchUse is one pantry item used in a batch cook. An empty Amount means the
+// whole item was used.
+type batchUse struct {
+	ItemID int
+	Amount string
+}
+
+// applyBatchCook takes the used ingredients out of the pantry and adds meal to
+// the freezer with their provenance recorded. The meal inherits the tags of
+// everything that went into it, so allergens carry over. Items that are used
+// up are removed. It fails without changing store if an amount can't be taken from
+// its item.
+func applyBatchCook(store *Store, meal FreezerMeal, uses []batchUse) error {
+	items := make(map[int]*PantryItem, len(store.PantryItems))
+	for i := range store.PantryItems {
+		items[store.PantryItems[i].ID] = &store.PantryItems[i]
+	}
+
+	remaining := make(map[int]PantryItem)
+	usedUp := make(map[int]bool)
+	meal.Ingredients = nil
+	for _, use := range uses {
+		item, ok := items[use.ItemID]
+		if !ok {
+			return fmt.Errorf("pantry item %d no longer exists", use.ItemID)
+		}
+		ing := FreezerMealIngredient{PantryItemID: item.ID, Name: item.Name, Category: item.Category}
+		amount := strings.TrimSpace(use.Amount)
+		if amount == "" {
+			ing.Quantity = item.Quantity
+			usedUp[item.ID] = true
+		} else {
+			q, ok := parseQuantity(amount)
+			if !ok {
+				return fmt.Errorf("%q is not an amount (for %s)", amount, item.Name)
+			}
+			left := *item
+			left.Batches = append([]Batch(nil), item.Batches...)
+			empty, ok := consumeItem(&left, q)
+			if !ok {
+				return fmt.Errorf("can't take %s from %s (%q)", q, item.Name, item.Quantity)
+			}
+			ing.Quantity = q.String()
+			remaining[item.ID] = left
+			usedUp[item.ID] = empty
+		}
+		meal.Ingredients = append(meal.Ingredients, ing)
+		meal.Tags = mergeTags(meal.Tags, item.Tags...)
+	}
+	sortTags(meal.Tags)
+
+	kept := store.PantryItems[:0]
+	for _, item := range store.PantryItems {
+		if usedUp[item.ID] {
+			continue
+		}
+		if left, ok := remaining[item.ID]; ok {
+			item = left
+		}
+		kept = append(kept, item)
+	}
+	store.PantryItems = kept
+
+	meal.ID = store.NextMealID
+	store.NextMealID++
+	store.FreezerMeals = append(store.FreezerMeals, meal)
+	return nil
+}
+
+// batchCookPage is the data for the batch-cook form. Amounts holds suggested
+// amounts per pantry item when the form is prefilled from a recipe.
+type batchCookPage struct {
+	PantryItems []PantryItem
+	Recipes     []Recipe
+	Recipe      *Recipe
+	Today       string
+	Amounts     map[int]string
+}
+
+// IsUsed reports whether the prefill marks a pantry item as used.
+func (p batchCookPage) IsUsed(id int) bool {
+	_, ok := p.Amounts[id]
+	return ok
+}
+
+// batchCookHandler shows the batch-cook form, optionally prefilled from a
+// recipe given by ?recipe=<id>.
+func batchCookHandler(w http.ResponseWriter, r *http.Request) {
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	recipes, err := loadRecipes(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(store.PantryItems, func(i, j int) bool {
+		return strings.ToLower(store.PantryItems[i].Name) < strings.ToLower(store.PantryItems[j].Name)
+	})
+	page := batchCookPage{
+		PantryItems: store.PantryItems,
+		Recipes:     recipes,
+		Today:       today(),
+		Amounts:     make(map[int]string),
+	}
+	if id, err := strconv.Atoi(r.FormValue("recipe")); err == nil {
+		for i := range recipes {
+			if recipes[i].ID == id {
+				page.Recipe = &recipes[i]
+			}
+		}
+		if page.Recipe != nil {
+			for _, ing := range page.Recipe.Ingredients {
+				if ing.PantryItemID != 0 {
+					page.Amounts[ing.PantryItemID] = ing.AmountString()
+				}
+			}
+		}
+	}
+	render(w, r, "batchcook.html", page)
+}
+
+// cookBatchHandler records a batch cook. Each used item is a "use" value of
+// its ID, with an optional "amount-<id>" field (blank means all of it).
+func cookBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/batch-cook", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Redirect(w, r, "/batch-cook", http.StatusSeeOther)
+		return
+	}
+	var uses []batchUse
+	for _, v := range r.Form["use"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		uses = append(uses, batchUse{ItemID: id, Amount: r.FormValue("amount-" + v)})
+	}
+
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	meal := FreezerMeal{
+		Name:        name,
+		Portions:    strings.TrimSpace(r.FormValue("portions")),
+		DateFrozen:  r.FormValue("date_frozen"),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Tags:        formTags(r),
+	}
+	if err := applyBatchCook(store, meal, uses); err != nil {
+		http.Error(w, "Could not record batch cook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveStore(householdID(r), store); err != nil {
+		saveFailed(w, r, "/batch-cook", err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// IngredientSummary lists a batch-cooked meal's ingredients for its card,
+// e.g. "Rice (200 g), Kidney Beans".
+func (m FreezerMeal) IngredientSummary() string {
+	parts := make([]string, 0, len(m.Ingredients))
+	for _, ing := range m.Ingredients {
+		if ing.Quantity != "" {
+			parts = append(parts, ing.Name+" ("+ing.Quantity+")")
+		} else {
+			parts = append(parts, ing.Name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestApplyBatchCook(t *testing.T) {
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Beef Mince", Quantity: "500 g", Category: "Other"},
+			{ID: 2, Name: "Kidney Beans", Quantity: "3 cans", Category: "Canned Goods"},
+			{ID: 3, Name: "Rice", Quantity: "1 kg", Category: "Dry Goods"},
+		},
+		NextPantryID: 4,
+		NextMealID:   7,
+	}
+	meal := FreezerMeal{Name: "Chilli", Portions: "6", DateFrozen: "2026-10-18"}
+	err := applyBatchCook(store, meal, []batchUse{{ItemID: 1}, {ItemID: 2, Amount: "2 tins"}})
+	if err != nil {
+		t.Fatalf("applyBatchCook: %v", err)
+	}
+
+	if len(store.PantryItems) != 2 {
+		t.Fatalf("mince should be used up, got %+v", store.PantryItems)
+	}
+	if store.PantryItems[0].Name != "Kidney Beans" || store.PantryItems[0].Quantity != "1 can" {
+		t.Errorf("expected 1 can of beans left, got %+v", store.PantryItems[0])
+	}
+	if len(store.FreezerMeals) != 1 || store.FreezerMeals[0].ID != 7 || store.NextMealID != 8 {
+		t.Fatalf("expected meal 7 to be added, got %+v", store.FreezerMeals)
+	}
+	got := store.FreezerMeals[0]
+	if len(got.Ingredients) != 2 || got.Ingredients[0].Quantity != "500 g" ||
+		got.Ingredients[1].Quantity != "2 cans" || got.Ingredients[1].Category != "Canned Goods" {
+		t.Errorf("unexpected provenance: %+v", got.Ingredients)
+	}
+	if got.IngredientSummary() != "Beef Mince (500 g), Kidney Beans (2 cans)" {
+		t.Errorf("unexpected summary %q", got.IngredientSummary())
+	}
+}
+
+func TestApplyBatchCookIncompatibleAmount(t *testing.T) {
+	store := &Store{
+		PantryItems: []PantryItem{{ID: 1, Name: "Rice", Quantity: "1 kg"}},
+		NextMealID:  1,
+	}
+	err := applyBatchCook(store, FreezerMeal{Name: "Risotto"}, []batchUse{{ItemID: 1, Amount: "2 cans"}})
+	if err == nil {
+		t.Fatal("expected an error for an incompatible amount")
+	}
+	if len(store.FreezerMeals) != 0 || store.PantryItems[0].Quantity != "1 kg" {
+		t.Error("store should be unchanged after a failed batch cook")
+	}
+}
+
+func TestCookBatchHandlerSavesProvenance(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Lentils", Quantity: "500 g"}},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 2,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{
+		"name":        {"Dal"},
+		"portions":    {"4"},
+		"date_frozen": {"2026-10-18"},
+		"use":         {"1"},
+		"amount-1":    {"200g"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/batch-cook/cook", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	cookBatchHandler(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d: %s", w.Code, w.Body.String())
+	}
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.PantryItems[0].Quantity != "300 g" {
+		t.Errorf("expected 300 g lentils left, got %q", store.PantryItems[0].Quantity)
+	}
+	if len(store.FreezerMeals) != 1 || len(store.FreezerMeals[0].Ingredients) != 1 ||
+		store.FreezerMeals[0].Ingredients[0].Name != "Lentils" {
+		t.Errorf("expected the meal to record its ingredients, got %+v", store.FreezerMeals)
+	}
+}
+
+func TestBatchCookHandlerPrefillsFromRecipe(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Lentils", Quantity: "500 g"}},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 2,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := insertRecipe(defaultHouseholdID, &Recipe{Name: "Dal", Servings: "4", Ingredients: []RecipeIngredient{
+		{Name: "lentils", Amount: 250, Unit: "g", PantryItemID: 1},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/batch-cook?recipe=1", nil)
+	w := httptest.NewRecorder()
+	batchCookHandler(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `value="250 g"`) || !strings.Contains(body, "checked") {
+		t.Errorf("expected the form to be prefilled from the recipe, got %d", w.Code)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortBatches orders batches first-expiry-first-out: earliest expiry first,
+// those without an expiry last, then oldest purchase first.
+func sortBatches(batches []Batch) {
+	sort.SliceStable(batches, func(i, j int) bool {
+		ei, ej := batches[i].Expiry, batches[j].Expiry
+		if ei != ej {
+			if ei == "" || ej == "" {
+				return ej == ""
+			}
+			return ei < ej
+		}
+		return batches[i].Purchased < batches[j].Purchased
+	})
+}
+
+// NearestExpiry is the soonest expiry date of an item's batches, or its own
+// expiry date if it has none.
+func (item PantryItem) NearestExpiry() string {
+	if len(item.Batches) == 0 {
+		return item.Expiry
+	}
+	nearest := ""
+	for _, b := range item.Batches {
+		if b.Expiry != "" && (nearest == "" || b.Expiry < nearest) {
+			nearest = b.Expiry
+		}
+	}
+	return nearest
+}
+
+// syncBatches orders an item's batches and sets its quantity to their total
+// and its expiry to the nearest of theirs. Items without batches are left as
+// they are.
+func (item *PantryItem) syncBatches() {
+	if len(item.Batches) == 0 {
+		return
+	}
+	sortBatches(item.Batches)
+	item.Expiry = item.NearestExpiry()
+	item.Quantity = batchTotal(item.Batches)
+}
+
+// batchTotal adds up batch quantities, in the first batch's unit, when they
+// can all be compared; otherwise it lists them, e.g. "2 cans + 1 jar".
+func batchTotal(batches []Batch) string {
+	var parts []string
+	var total Quantity
+	summable := true
+	for _, b := range batches {
+		if b.Quantity == "" {
+			continue
+		}
+		parts = append(parts, b.Quantity)
+		q, ok := parseQuantity(b.Quantity)
+		switch {
+		case !ok:
+			summable = false
+		case len(parts) == 1:
+			total = q
+		case !q.compatible(total):
+			summable = false
+		default:
+			total.Amount += q.in(total.Unit)
+		}
+	}
+	if !summable || len(parts) < 2 {
+		return strings.Join(parts, " + ")
+	}
+	return total.String()
+}
+
+// consumeItem takes use from a pantry item. Batches are used earliest expiry
+// first and dropped once empty. It reports whether the item is used up; ok is
+// false, and nothing is taken, when a quantity can't be compared with use.
+func consumeItem(item *PantryItem, use Quantity) (usedUp, ok bool) {
+	if len(item.Batches) == 0 {
+		left, empty, ok := consumeQuantity(item.Quantity, use)
+		if ok {
+			item.Quantity = left
+		}
+		return empty, ok
+	}
+	sortBatches(item.Batches)
+	amounts := make([]Quantity, len(item.Batches))
+	for i, b := range item.Batches {
+		q, parsed := parseQuantity(b.Quantity)
+		if !parsed || !use.compatible(q) {
+			return false, false
+		}
+		amounts[i] = q
+	}
+	need := use.Amount
+	kept := item.Batches[:0]
+	for i, b := range item.Batches {
+		have := amounts[i]
+		if need > 1e-9 {
+			take := math.Min(Quantity{Amount: need, Unit: use.Unit}.in(have.Unit), have.Amount)
+			need -= Quantity{Amount: take, Unit: have.Unit}.in(use.Unit)
+			have.Amount -= take
+			if have.Amount <= 1e-9 {
+				continue
+			}
+			b.Quantity = have.String()
+		}
+		kept = append(kept, b)
+	}
+	item.Batches = kept
+	if len(item.Batches) == 0 {
+		item.Quantity = ""
+		return true, true
+	}
+	item.syncBatches()
+	return false, true
+}
+
+// validateBatch tidies a batch's fields and reports what is wrong with them.
+func validateBatch(b *Batch) fieldErrors {
+	b.Quantity = strings.TrimSpace(b.Quantity)
+	b.Expiry = strings.TrimSpace(b.Expiry)
+	b.Purchased = strings.TrimSpace(b.Purchased)
+	errs := fieldErrors{}
+	errs.check(b.Quantity != "", "quantity", "Quantity is required.")
+	errs.checkLength("quantity", "Quantity", b.Quantity, maxQuantityLength)
+	errs.checkDate("expiry", "Expiry date", b.Expiry)
+	errs.checkDate("purchased", "Purchase date", b.Purchased)
+	return errs
+}
+
+// addBatchHandler adds a batch to the pantry item in "id". An item's first
+// batch is added alongside what it already held, which becomes a batch of
+// its own.
+func addBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	i := pantryIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	b := Batch{Quantity: r.FormValue("quantity"), Expiry: r.FormValue("expiry"), Purchased: r.FormValue("purchased")}
+	if errs := validateBatch(&b); len(errs) > 0 {
+		renderItem(w, r, http.StatusUnprocessableEntity, formState{Modal: "batch", Values: r.Form, Errors: errs})
+		return
+	}
+	item := &store.PantryItems[i]
+	if len(item.Batches) == 0 && (item.Quantity != "" || item.Expiry != "") {
+		item.Batches = []Batch{{Quantity: item.Quantity, Expiry: item.Expiry}}
+	}
+	item.Batches = append(item.Batches, b)
+	item.syncBatches()
+	back := "/pantry/item?id=" + strconv.Itoa(id)
+	if err := saveStore(hh, store); err != nil {
+		saveFailed(w, r, back, err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Added a batch of "+b.Quantity+" to "+item.Name+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// deleteBatchHandler removes the batch at position "batch" of the pantry item
+// in "id". Removing the last batch leaves the item empty rather than
+// deleting it.
+func deleteBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	i := pantryIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	item := &store.PantryItems[i]
+	n, err := strconv.Atoi(r.FormValue("batch"))
+	if err != nil || n < 0 || n >= len(item.Batches) {
+		http.Error(w, "Invalid or missing batch", http.StatusBadRequest)
+		return
+	}
+	item.Batches = append(item.Batches[:n], item.Batches[n+1:]...)
+	if len(item.Batches) == 0 {
+		item.Quantity, item.Expiry = "", ""
+	}
+	item.syncBatches()
+	back := "/pantry/item?id=" + strconv.Itoa(id)
+	if err := saveStore(hh, store); err != nil {
+		saveFailed(w, r, back, err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Removed a batch of "+item.Name+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestSyncBatches(t *testing.T) {
+	item := PantryItem{Name: "Beans", Batches: []Batch{
+		{Quantity: "1 can"},
+		{Quantity: "2 cans", Expiry: "2025-03-01"},
+		{Quantity: "1 can", Expiry: "2025-01-15"},
+	}}
+	item.syncBatches()
+	if item.Quantity != "4 cans" || item.Expiry != "2025-01-15" {
+		t.Errorf("expected 4 cans expiring 2025-01-15, got %q %q", item.Quantity, item.Expiry)
+	}
+	if item.Batches[0].Expiry != "2025-01-15" || item.Batches[2].Expiry != "" {
+		t.Errorf("expected batches earliest expiry first, none last, got %+v", item.Batches)
+	}
+
+	mixed := PantryItem{Batches: []Batch{{Quantity: "2 cans"}, {Quantity: "1 jar"}}}
+	mixed.syncBatches()
+	if mixed.Quantity != "2 cans + 1 jar" {
+		t.Errorf("expected incomparable batches to be listed, got %q", mixed.Quantity)
+	}
+}
+
+func TestConsumeItemFEFO(t *testing.T) {
+	item := PantryItem{Batches: []Batch{
+		{Quantity: "500 g", Expiry: "2025-06-01"},
+		{Quantity: "250 g", Expiry: "2025-02-01"},
+	}}
+	item.syncBatches()
+
+	if empty, ok := consumeItem(&item, Quantity{Amount: 0.3, Unit: "kg"}); !ok || empty {
+		t.Fatalf("expected 300 g to be taken, got empty=%v ok=%v", empty, ok)
+	}
+	if len(item.Batches) != 1 || item.Batches[0].Quantity != "450 g" || item.Expiry != "2025-06-01" {
+		t.Errorf("expected the earlier batch used first, got %+v (%q)", item.Batches, item.Expiry)
+	}
+	if item.Quantity != "450 g" {
+		t.Errorf("expected the total to follow, got %q", item.Quantity)
+	}
+
+	if _, ok := consumeItem(&item, Quantity{Amount: 1, Unit: "l"}); ok {
+		t.Error("expected litres not to be taken from grams")
+	}
+	if empty, ok := consumeItem(&item, Quantity{Amount: 1, Unit: "kg"}); !ok || !empty {
+		t.Errorf("expected the item to be used up, got empty=%v ok=%v", empty, ok)
+	}
+}
+
+func TestSortPantryItemsUsesNearestBatch(t *testing.T) {
+	items := []PantryItem{
+		{Name: "Rice", Expiry: "2025-05-01"},
+		{Name: "Beans", Batches: []Batch{{Quantity: "1 can", Expiry: "2025-09-01"}, {Quantity: "1 can", Expiry: "2025-02-01"}}},
+	}
+	sortPantryItems(items)
+	if items[0].Name != "Beans" {
+		t.Errorf("expected Beans first by its nearest batch, got %s", items[0].Name)
+	}
+}
+
+func TestBatchHandlers(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Beans", Quantity: "1 can", Expiry: "2025-05-01", Category: "Canned Goods"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postForm(addBatchHandler, "/pantry/batches/add", url.Values{"id": {"1"}, "expiry": {"soon"}}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a batch without a quantity, got %d", w.Code)
+	}
+	w := postForm(addBatchHandler, "/pantry/batches/add", url.Values{"id": {"1"}, "quantity": {"2 cans"}, "expiry": {"2025-02-01"}, "purchased": {"2025-01-01"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := store.PantryItems[0]
+	if len(item.Batches) != 2 || item.Quantity != "3 cans" || item.Expiry != "2025-02-01" {
+		t.Fatalf("expected the old stock kept as a batch, got %+v", item)
+	}
+	if item.Batches[0].Purchased != "2025-01-01" {
+		t.Errorf("expected batches saved in FEFO order, got %+v", item.Batches)
+	}
+
+	// Editing the item keeps its batches and their totals.
+	postForm(editPantryHandler, "/pantry/edit", url.Values{"id": {"1"}, "version": {strconv.Itoa(item.Version)}, "name": {"Baked beans"}, "quantity": {"99 cans"}, "category": {"Canned Goods"}})
+	store, _ = loadStore(defaultHouseholdID)
+	if item := store.PantryItems[0]; item.Name != "Baked beans" || len(item.Batches) != 2 || item.Quantity != "3 cans" {
+		t.Errorf("expected an edit to keep the batches, got %+v", item)
+	}
+
+	if w := postForm(deleteBatchHandler, "/pantry/batches/delete", url.Values{"id": {"1"}, "batch": {"5"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown batch, got %d", w.Code)
+	}
+	postForm(deleteBatchHandler, "/pantry/batches/delete", url.Values{"id": {"1"}, "batch": {"0"}})
+	store, _ = loadStore(defaultHouseholdID)
+	if item := store.PantryItems[0]; len(item.Batches) != 1 || item.Quantity != "1 can" || item.Expiry != "2025-05-01" {
+		t.Errorf("expected one batch left, got %+v", item)
+	}
+}
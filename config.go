@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the server's configuration. Each setting comes from, in rising
+// order of precedence, its default, the TOML config file, an environment
+// variable and a command-line flag.
+type Config struct {
+	// Listen is the address to serve on, such as ":8080" or "127.0.0.1:80".
+	Listen string `toml:"listen"`
+	// Database is the path of the SQLite database file.
+	Database string `toml:"database"`
+	// BaseURL is the public address of the site, used in links sent
+	// elsewhere, such as notifications. Optional.
+	BaseURL string `toml:"base_url"`
+	// Dev loads templates and static files from Assets on every request, so
+	// they can be edited without rebuilding. Otherwise the copies built into
+	// the binary are used and Assets is ignored.
+	Dev bool `toml:"dev"`
+	// Assets is the directory holding the templates and static directories in
+	// dev mode.
+	Assets string `toml:"assets"`
+	// Currency is the ISO 4217 code purchases default to, such as "GBP".
+	Currency      string             `toml:"currency"`
+	Warnings      WarningConfig      `toml:"warnings"`
+	Notifications NotificationConfig `toml:"notifications"`
+	Log           LogConfig          `toml:"log"`
+}
+
+// WarningConfig sets when items are flagged on the inventory.
+type WarningConfig struct {
+	// ExpiryDays is how close to its expiry date a pantry item counts as
+	// expiring soon.
+	ExpiryDays int `toml:"expiry_days"`
+	// FreezerAgingDays and FreezerOldDays are the ages at which a freezer
+	// meal is marked as getting old and as old.
+	FreezerAgingDays int `toml:"freezer_aging_days"`
+	FreezerOldDays   int `toml:"freezer_old_days"`
+}
+
+// NotificationConfig sets up the expiry webhook. Notifications are off
+// unless WebhookURL is set.
+type NotificationConfig struct {
+	WebhookURL string        `toml:"webhook_url"`
+	Interval   time.Duration `toml:"interval"`
+}
+
+// LogConfig sets how the server logs. Format is "text" or "json" and Level
+// one of debug, info, warn or error; store operations are logged at debug.
+type LogConfig struct {
+	Format string `toml:"format"`
+	Level  string `toml:"level"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:   ":8080",
+		Database: "data.db",
+		Assets:   ".",
+		Currency: "GBP",
+		Warnings: WarningConfig{
+			ExpiryDays:       7,
+			FreezerAgingDays: 30,
+			FreezerOldDays:   90,
+		},
+		Notifications: NotificationConfig{Interval: 24 * time.Hour},
+		Log:           LogConfig{Format: "text", Level: "info"},
+	}
+}
+
+// config is the configuration the server is running with. Tests use the
+// defaults.
+var config = defaultConfig()
+
+// configSetting ties one setting to its environment variable and flag.
+type configSetting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+var configSettings = []configSetting{
+	{"listen", "CUPBOARD_LISTEN", "address to listen on, e.g. :8080", false, func(c *Config, v string) error {
+		c.Listen = v
+		return nil
+	}},
+	{"db", "CUPBOARD_DB", "path of the SQLite database file", false, func(c *Config, v string) error {
+		c.Database = v
+		return nil
+	}},
+	{"base-url", "CUPBOARD_BASE_URL", "public URL of the site, e.g. https://cupboard.example.com", false, func(c *Config, v string) error {
+		c.BaseURL = v
+		return nil
+	}},
+	{"dev", "CUPBOARD_DEV", "load templates and static files from -assets on every request", true, func(c *Config, v string) error {
+		dev, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		c.Dev = dev
+		return nil
+	}},
+	{"assets", "CUPBOARD_ASSETS", "directory containing the templates and static directories, used with -dev", false, func(c *Config, v string) error {
+		c.Assets = v
+		return nil
+	}},
+	{"currency", "CUPBOARD_CURRENCY", "currency code purchases default to, e.g. GBP", false, func(c *Config, v string) error {
+		c.Currency = v
+		return nil
+	}},
+	{"expiry-days", "CUPBOARD_EXPIRY_DAYS", "days before its expiry date that an item is flagged", false, func(c *Config, v string) error {
+		return setInt(&c.Warnings.ExpiryDays, v)
+	}},
+	{"freezer-aging-days", "CUPBOARD_FREEZER_AGING_DAYS", "age in days at which a freezer meal is marked as getting old", false, func(c *Config, v string) error {
+		return setInt(&c.Warnings.FreezerAgingDays, v)
+	}},
+	{"freezer-old-days", "CUPBOARD_FREEZER_OLD_DAYS", "age in days at which a freezer meal is marked as old", false, func(c *Config, v string) error {
+		return setInt(&c.Warnings.FreezerOldDays, v)
+	}},
+	{"webhook-url", "CUPBOARD_WEBHOOK_URL", "URL to POST expiring items to; empty disables notifications", false, func(c *Config, v string) error {
+		c.Notifications.WebhookURL = v
+		return nil
+	}},
+	{"notify-interval", "CUPBOARD_NOTIFY_INTERVAL", "how often to check for expiring items, e.g. 24h", false, func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.New("must be a duration like 24h")
+		}
+		c.Notifications.Interval = d
+		return nil
+	}},
+	{"log-format", "CUPBOARD_LOG_FORMAT", "log format: text or json", false, func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"log-level", "CUPBOARD_LOG_LEVEL", "lowest level logged: debug, info, warn or error", false, func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return errors.New("must be a whole number")
+	}
+	*dst = n
+	return nil
+}
+
+// settingFlag holds a setting's flag until it is applied over the file and
+// environment. Boolean settings may be given without a value.
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string     { return f.value }
+func (f *settingFlag) Set(v string) error { f.value = v; return nil }
+func (f *settingFlag) IsBoolFlag() bool   { return f.isBool }
+
+// configFlags are the configuration flags registered on a flag set.
+type configFlags struct {
+	fs     *flag.FlagSet
+	file   *string
+	values map[string]*settingFlag
+}
+
+// newConfigFlags registers -config and a flag for every setting on fs.
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{
+		fs:     fs,
+		file:   fs.String("config", "", "path of a TOML config file (env CUPBOARD_CONFIG)"),
+		values: make(map[string]*settingFlag),
+	}
+	for _, s := range configSettings {
+		f := &settingFlag{isBool: s.isBool}
+		fs.Var(f, s.flag, s.usage+" (env "+s.env+")")
+		cf.values[s.flag] = f
+	}
+	return cf
+}
+
+// load builds the configuration once fs has been parsed, reading the config
+// file and environment variables through getenv, and validates it.
+func (cf *configFlags) load(getenv func(string) string) (Config, error) {
+	c := defaultConfig()
+
+	path := *cf.file
+	if path == "" {
+		path = getenv("CUPBOARD_CONFIG")
+	}
+	if path != "" {
+		if err := loadConfigFile(&c, path); err != nil {
+			return c, err
+		}
+	}
+
+	var errs []error
+	// PORT is still honoured for hosts that set it, below CUPBOARD_LISTEN.
+	if port := getenv("PORT"); port != "" {
+		c.Listen = ":" + port
+	}
+	for _, s := range configSettings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(&c, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	set := make(map[string]bool)
+	cf.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range configSettings {
+		if set[s.flag] {
+			if err := s.set(&c, cf.values[s.flag].value); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return c, errors.Join(errs...)
+	}
+	return c, c.validate()
+}
+
+// loadConfigFile applies a TOML config file on top of c. Unknown keys are an
+// error so typos don't go unnoticed.
+func loadConfigFile(c *Config, path string) error {
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("config file %s: unknown setting %s", path, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// validate reports every problem with the configuration at once.
+func (c Config) validate() error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil {
+		bad("listen: %q is not an address like :8080", c.Listen)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		bad("listen: %q has no valid port", c.Listen)
+	}
+
+	if c.Database == "" {
+		bad("database: a path is required")
+	} else if dir := filepath.Dir(c.Database); !isDir(dir) {
+		bad("database: directory %s does not exist", dir)
+	}
+
+	if c.BaseURL != "" && !isHTTPURL(c.BaseURL) {
+		bad("base_url: %q must be an absolute http or https URL", c.BaseURL)
+	}
+
+	if c.Dev {
+		for _, sub := range []string{"templates", "static"} {
+			if dir := filepath.Join(c.Assets, sub); !isDir(dir) {
+				bad("assets: %s has no %s directory", c.Assets, sub)
+			}
+		}
+	}
+
+	if !isCurrencyCode(c.Currency) {
+		bad("currency: %q must be a three-letter code like GBP", c.Currency)
+	}
+
+	w := c.Warnings
+	if w.ExpiryDays < 0 {
+		bad("warnings.expiry_days: must not be negative")
+	}
+	if w.FreezerAgingDays <= 0 || w.FreezerOldDays <= 0 {
+		bad("warnings: freezer ages must be positive")
+	} else if w.FreezerAgingDays >= w.FreezerOldDays {
+		bad("warnings: freezer_aging_days (%d) must be less than freezer_old_days (%d)", w.FreezerAgingDays, w.FreezerOldDays)
+	}
+
+	n := c.Notifications
+	if n.WebhookURL != "" && !isHTTPURL(n.WebhookURL) {
+		bad("notifications.webhook_url: %q must be an absolute http or https URL", n.WebhookURL)
+	}
+	if n.Interval < time.Minute {
+		bad("notifications.interval: %s is shorter than a minute", n.Interval)
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		bad("log.format: %q must be text or json", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		bad("log.level: %q must be debug, info, warn or error", c.Log.Level)
+	}
+
+	return errors.Join(errs...)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
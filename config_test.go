@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadTestConfig parses args as command-line flags and loads the
+// configuration with env as the environment.
+func loadTestConfig(t *testing.T, args []string, env map[string]string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cf := newConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cf.load(func(key string) string { return env[key] })
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cupboard.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := loadTestConfig(t, nil, nil)
+	if err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+	if cfg.Listen != ":8080" || cfg.Database != "data.db" || cfg.Warnings.ExpiryDays != 7 {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfigFile(t, `
+listen = ":9000"
+database = "`+filepath.ToSlash(filepath.Join(dir, "file.db"))+`"
+base_url = "https://cupboard.example.com"
+
+[warnings]
+expiry_days = 3
+
+[notifications]
+webhook_url = "https://hooks.example.com/cupboard"
+interval = "6h"
+`)
+
+	cfg, err := loadTestConfig(t, []string{"-config", path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9000" || cfg.Warnings.ExpiryDays != 3 || cfg.Notifications.Interval != 6*time.Hour {
+		t.Errorf("file settings not applied: %+v", cfg)
+	}
+	if cfg.Warnings.FreezerOldDays != 90 {
+		t.Errorf("settings missing from the file should keep their defaults, got %d", cfg.Warnings.FreezerOldDays)
+	}
+
+	// The environment overrides the file, and PORT is below CUPBOARD_LISTEN.
+	env := map[string]string{"CUPBOARD_CONFIG": path, "PORT": "7000", "CUPBOARD_EXPIRY_DAYS": "5"}
+	cfg, err = loadTestConfig(t, nil, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":7000" || cfg.Warnings.ExpiryDays != 5 {
+		t.Errorf("env not applied over the file: %+v", cfg)
+	}
+	env["CUPBOARD_LISTEN"] = "127.0.0.1:7001"
+	if cfg, _ = loadTestConfig(t, nil, env); cfg.Listen != "127.0.0.1:7001" {
+		t.Errorf("CUPBOARD_LISTEN should win over PORT, got %q", cfg.Listen)
+	}
+
+	// Flags override everything.
+	cfg, err = loadTestConfig(t, []string{"-listen", ":6000", "-expiry-days", "1"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":6000" || cfg.Warnings.ExpiryDays != 1 {
+		t.Errorf("flags not applied over env: %+v", cfg)
+	}
+}
+
+func TestConfigRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{"bad listen", []string{"-listen", "8080"}, nil, []string{"listen:"}},
+		{"bad port", []string{"-listen", ":99999"}, nil, []string{"no valid port"}},
+		{"missing db directory", []string{"-db", filepath.Join(t.TempDir(), "nope", "data.db")}, nil, []string{"database: directory"}},
+		{"relative base url", []string{"-base-url", "cupboard.local"}, nil, []string{"base_url:"}},
+		{"no assets", []string{"-dev", "-assets", t.TempDir()}, nil, []string{"no templates directory", "no static directory"}},
+		{"bad currency", []string{"-currency", "pounds"}, nil, []string{"currency:"}},
+		{"ages out of order", []string{"-freezer-aging-days", "100"}, nil, []string{"freezer_aging_days (100)"}},
+		{"bad webhook", []string{"-webhook-url", "ftp://example.com"}, nil, []string{"webhook_url:"}},
+		{"short interval", []string{"-notify-interval", "1s"}, nil, []string{"shorter than a minute"}},
+		{"not a number", nil, map[string]string{"CUPBOARD_EXPIRY_DAYS": "soon"}, []string{"CUPBOARD_EXPIRY_DAYS: must be a whole number"}},
+		{"not a bool", nil, map[string]string{"CUPBOARD_DEV": "sometimes"}, []string{"CUPBOARD_DEV: must be true or false"}},
+		{"not a duration", []string{"-notify-interval", "daily"}, nil, []string{"-notify-interval: must be a duration"}},
+		{"bad log format", []string{"-log-format", "xml"}, nil, []string{"log.format:"}},
+		{"bad log level", nil, map[string]string{"CUPBOARD_LOG_LEVEL": "loud"}, []string{"log.level:"}},
+		{"several at once", []string{"-listen", "x", "-base-url", "y"}, nil, []string{"listen:", "base_url:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, tt.args, tt.env)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	path := writeConfigFile(t, "listen = \":8080\"\nexpiry_days = 3\n[warnings]\nexpiry_dayz = 2\n")
+	_, err := loadTestConfig(t, []string{"-config", path}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown setting expiry_days, warnings.expiry_dayz") {
+		t.Errorf("expected unknown settings to be reported, got %v", err)
+	}
+
+	path = writeConfigFile(t, "listen = 8080\n")
+	if _, err := loadTestConfig(t, []string{"-config", path}, nil); err == nil {
+		t.Error("expected a type error")
+	}
+
+	if _, err := loadTestConfig(t, []string{"-config", filepath.Join(t.TempDir(), "missing.toml")}, nil); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+}
+
+func TestSendExpiryNotices(t *testing.T) {
+	useTempDB(t)
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Milk", Expiry: time.Now().AddDate(0, 0, 2).Format("2006-01-02")},
+			{ID: 2, Name: "Rice", Expiry: time.Now().AddDate(1, 0, 0).Format("2006-01-02")},
+		},
+		NextPantryID: 3,
+		NextMealID:   1,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []expiryNotice
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n expiryNotice
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		got = append(got, n)
+	}))
+	defer hook.Close()
+
+	if err := sendExpiryNotices(t.Context(), hook.Client(), hook.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Items) != 1 || got[0].Items[0].Name != "Milk" {
+		t.Errorf("expected one notice for Milk, got %+v", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errConflict is returned by writeStore when an item the save changes or
+// deletes was changed or deleted by another save since it was loaded.
+var errConflict = errors.New("item changed elsewhere")
+
+// pantryConflicts reports whether saving mine, made to version of an item,
+// would overwrite changes made since: the item is now at another version
+// and mine doesn't already match it.
+func pantryConflicts(version int, mine, current PantryItem) bool {
+	return version != current.Version && pantryChecksum(mine) != pantryChecksum(current)
+}
+
+// mealConflicts is pantryConflicts for freezer meals.
+func mealConflicts(version int, mine, current FreezerMeal) bool {
+	return version != current.Version && mealChecksum(mine) != mealChecksum(current)
+}
+
+// formVersion reads the version an edit form was filled from. It writes a
+// 400 if there is none or it isn't a number.
+func formVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil || version < 1 {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+// conflictRow is a field of an item as the user left it and as it now is.
+type conflictRow struct {
+	Label  string
+	Mine   string
+	Theirs string
+}
+
+// Differs reports whether the two sides disagree on the field.
+func (c conflictRow) Differs() bool { return c.Mine != c.Theirs }
+
+// hiddenField is a posted form value, carried by the conflict screen so the
+// user's edit can be saved after all.
+type hiddenField struct {
+	Name  string
+	Value string
+}
+
+// conflictPage is the data for the screen shown when an edit was made to an
+// item that has changed since the form was opened.
+type conflictPage struct {
+	Kind    string
+	Name    string
+	Action  string
+	ID      int
+	Version int
+	Rows    []conflictRow
+	Fields  []hiddenField
+}
+
+// postedFields returns the fields of the form r posted that the conflict
+// screen passes on: everything but the ID, version and CSRF token, which it
+// sets itself.
+func postedFields(r *http.Request) []hiddenField {
+	var fields []hiddenField
+	keys := make([]string, 0, len(r.PostForm))
+	for k := range r.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "id" || k == "version" || k == csrfFormField {
+			continue
+		}
+		for _, v := range r.PostForm[k] {
+			fields = append(fields, hiddenField{Name: k, Value: v})
+		}
+	}
+	return fields
+}
+
+// renderPantryConflict shows mine, an edit of the pantry item current that
+// changed since the edit form was opened, beside the item as it now is.
+func renderPantryConflict(w http.ResponseWriter, r *http.Request, mine, current PantryItem) {
+	locs, err := loadLocations(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	renderStatus(w, r, http.StatusConflict, "conflict.html", conflictPage{
+		Kind:    "pantry item",
+		Name:    current.Name,
+		Action:  "/pantry/edit",
+		ID:      current.ID,
+		Version: current.Version,
+		Rows: []conflictRow{
+			{"Name", mine.Name, current.Name},
+			{"Quantity", mine.Quantity, current.Quantity},
+			{"Category", mine.Category, current.Category},
+			{"Expiry", mine.Expiry, current.Expiry},
+			{"Notes", mine.Notes, current.Notes},
+			{"Where", locs.Describe(mine.LocationID, mine.Position), locs.Describe(current.LocationID, current.Position)},
+			{"Tags", strings.Join(mine.Tags, ", "), strings.Join(current.Tags, ", ")},
+		},
+		Fields: postedFields(r),
+	})
+}
+
+// renderMealConflict is renderPantryConflict for freezer meals.
+func renderMealConflict(w http.ResponseWriter, r *http.Request, mine, current FreezerMeal) {
+	locs, err := loadLocations(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	renderStatus(w, r, http.StatusConflict, "conflict.html", conflictPage{
+		Kind:    "freezer meal",
+		Name:    current.Name,
+		Action:  "/freezer/edit",
+		ID:      current.ID,
+		Version: current.Version,
+		Rows: []conflictRow{
+			{"Name", mine.Name, current.Name},
+			{"Portions", mine.Portions, current.Portions},
+			{"Date frozen", mine.DateFrozen, current.DateFrozen},
+			{"Description", mine.Description, current.Description},
+			{"Where", locs.Describe(mine.LocationID, mine.Position), locs.Describe(current.LocationID, current.Position)},
+			{"Tags", strings.Join(mine.Tags, ", "), strings.Join(current.Tags, ", ")},
+		},
+		Fields: postedFields(r),
+	})
+}
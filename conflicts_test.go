@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// seedRiceAtVersion2 stores a pantry item and a freezer meal, then changes
+// the item as another user would, taking it to version 2.
+func seedRiceAtVersion2(t *testing.T) {
+	t.Helper()
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice", Quantity: "1 kg", Category: "Dry Goods"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextPantryID: 2,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	store.PantryItems[0].Quantity = "500 g"
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	setupHandlerTest(t)
+	seedRiceAtVersion2(t)
+
+	form := url.Values{"id": {"1"}, "version": {"1"}, "name": {"Rice"}, "quantity": {"2 kg"}, "category": {"Dry Goods"}}
+	w := postForm(editPantryHandler, "/pantry/edit", form)
+	body := w.Body.String()
+	if w.Code != http.StatusConflict || !strings.Contains(body, "was changed while you were editing") {
+		t.Fatalf("expected 409 with the conflict screen, got %d", w.Code)
+	}
+	if !strings.Contains(body, "2 kg") || !strings.Contains(body, "500 g") || !strings.Contains(body, `name="version" value="2"`) {
+		t.Error("expected both quantities and a form to keep the edit against version 2")
+	}
+	if store, _ := loadStore(defaultHouseholdID); store.PantryItems[0].Quantity != "500 g" {
+		t.Errorf("expected the conflicting edit not saved, got %+v", store.PantryItems[0])
+	}
+
+	// Keeping the edit posts it again against the current version.
+	form.Set("version", "2")
+	if w := postForm(editPantryHandler, "/pantry/edit", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303 keeping the edit, got %d", w.Code)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if item := store.PantryItems[0]; item.Quantity != "2 kg" || item.Version != 3 {
+		t.Errorf("expected 2 kg at version 3, got %+v", item)
+	}
+
+	// An edit from a stale form that matches what is saved isn't a conflict.
+	if w := postForm(editPantryHandler, "/pantry/edit", form); w.Code != http.StatusSeeOther {
+		t.Errorf("expected an edit matching the saved item to go through, got %d", w.Code)
+	}
+	if w := postForm(editFreezerHandler, "/freezer/edit", url.Values{"id": {"1"}, "version": {"x"}, "name": {"Chilli"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad version, got %d", w.Code)
+	}
+	form.Del("version")
+	if w := postForm(editPantryHandler, "/pantry/edit", form); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an edit without a version, got %d", w.Code)
+	}
+}
+
+func TestOverlappingSaves(t *testing.T) {
+	useTempDB(t)
+	seedRiceAtVersion2(t)
+
+	// Two saves from copies loaded at the same time, changing different
+	// items, both stand.
+	mine, _ := loadStore(defaultHouseholdID)
+	theirs, _ := loadStore(defaultHouseholdID)
+	mine.PantryItems[0].Quantity = "2 kg"
+	theirs.FreezerMeals[0].Portions = "1"
+	if err := saveStore(defaultHouseholdID, theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, mine); err != nil {
+		t.Fatalf("expected a save of another item to go through, got %v", err)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if store.PantryItems[0].Quantity != "2 kg" || store.FreezerMeals[0].Portions != "1" {
+		t.Fatalf("expected both saves kept, got %+v and %+v", store.PantryItems[0], store.FreezerMeals[0])
+	}
+
+	// Two changing the same item: the later is refused and writes nothing,
+	// not even its change to the meal.
+	mine, _ = loadStore(defaultHouseholdID)
+	theirs, _ = loadStore(defaultHouseholdID)
+	theirs.PantryItems[0].Quantity = "1 kg"
+	mine.PantryItems[0].Notes = "basmati"
+	mine.FreezerMeals[0].Portions = "3"
+	if err := saveStore(defaultHouseholdID, theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, mine); !errors.Is(err, errConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	store, _ = loadStore(defaultHouseholdID)
+	if item := store.PantryItems[0]; item.Quantity != "1 kg" || item.Notes != "" || item.Version != 4 || store.FreezerMeals[0].Portions != "1" {
+		t.Errorf("expected only the first save kept, got %+v and %+v", item, store.FreezerMeals[0])
+	}
+
+	// Deleting an item changed since, or changing one deleted since, is
+	// refused too.
+	mine, _ = loadStore(defaultHouseholdID)
+	theirs, _ = loadStore(defaultHouseholdID)
+	theirs.FreezerMeals[0].Portions = "4"
+	mine.FreezerMeals = nil
+	if err := saveStore(defaultHouseholdID, theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, mine); !errors.Is(err, errConflict) {
+		t.Errorf("expected deleting a changed meal to conflict, got %v", err)
+	}
+	mine, _ = loadStore(defaultHouseholdID)
+	theirs, _ = loadStore(defaultHouseholdID)
+	theirs.PantryItems = nil
+	mine.PantryItems[0].Quantity = "3 kg"
+	if err := saveStore(defaultHouseholdID, theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, mine); !errors.Is(err, errConflict) {
+		t.Errorf("expected changing a deleted item to conflict, got %v", err)
+	}
+	if store, _ := loadStore(defaultHouseholdID); len(store.PantryItems) != 0 || len(store.FreezerMeals) != 1 {
+		t.Errorf("expected the item to stay deleted and the meal kept, got %+v", store)
+	}
+}
+
+// putItem sends a PUT to an API item handler, as the mux would route it.
+func putItem(handler http.HandlerFunc, path, id, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPut, path+id, strings.NewReader(body))
+	r.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestAPIUpdateConflict(t *testing.T) {
+	setupHandlerTest(t)
+	seedRiceAtVersion2(t)
+
+	if w := putItem(apiPantryItemHandler, "/api/pantry/", "1", `{"name":"Rice"}`); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"version"`) {
+		t.Errorf("expected 422 without a version, got %d %s", w.Code, w.Body.String())
+	}
+	w := putItem(apiPantryItemHandler, "/api/pantry/", "1", `{"name":"Rice","quantity":"2 kg","version":1}`)
+	var conflict struct {
+		Current PantryItem `json:"current"`
+	}
+	if w.Code != http.StatusConflict || json.NewDecoder(w.Body).Decode(&conflict) != nil || conflict.Current.Quantity != "500 g" {
+		t.Fatalf("expected 409 with the current item, got %d", w.Code)
+	}
+
+	w = putItem(apiPantryItemHandler, "/api/pantry/", "1", `{"name":"Rice","quantity":"2 kg","version":2}`)
+	var saved PantryItem
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&saved) != nil || saved.Version != 3 {
+		t.Errorf("expected the update saved at version 3, got %d %+v", w.Code, saved)
+	}
+	if w := putItem(apiFreezerItemHandler, "/api/freezer/", "1", `{"name":"Chilli","portions":"1","version":1}`); w.Code != http.StatusOK {
+		t.Errorf("expected the meal updated, got %d %s", w.Code, w.Body.String())
+	}
+	if w := putItem(apiFreezerItemHandler, "/api/freezer/", "9", `{"name":"Soup","version":1}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown meal, got %d", w.Code)
+	}
+}
+
+func TestOverlappingSavesOfLegacyItem(t *testing.T) {
+	setupHandlerTest(t)
+	insertLegacyRice(t)
+
+	// Both copies load the item at version 1 with nothing saved to compare
+	// against; the second save must still see the first.
+	mine, _ := loadStore(defaultHouseholdID)
+	theirs, _ := loadStore(defaultHouseholdID)
+	theirs.PantryItems[0].Quantity = "500 g"
+	mine.PantryItems[0].Quantity = "2 kg"
+	if err := saveStore(defaultHouseholdID, theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, mine); !errors.Is(err, errConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if store, _ := loadStore(defaultHouseholdID); store.PantryItems[0].Quantity != "500 g" {
+		t.Errorf("expected the first save kept, got %+v", store.PantryItems[0])
+	}
+
+	// So must an edit form opened before the first save.
+	form := url.Values{"id": {"1"}, "version": {"1"}, "name": {"Rice"}, "quantity": {"2 kg"}}
+	if w := postForm(editPantryHandler, "/pantry/edit", form); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an edit made to version 1, got %d", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// csrfCookie holds a random per-browser token. Scripts can read it so API
+	// calls can echo it back in csrfHeader (the double-submit pattern).
+	csrfCookie = "csrf"
+	csrfHeader = "X-CSRF-Token"
+	// csrfFormField is the hidden input every form posts the token in.
+	csrfFormField = "csrf_token"
+)
+
+// sessionCSRFToken derives the per-session token forms must post. It is
+// tied to the session cookie, which other sites can neither read nor guess.
+func sessionCSRFToken(session string) string {
+	return hashToken("csrf:" + session)
+}
+
+// csrfToken returns the token forms on this request's page must post.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey).(string)
+	return token
+}
+
+// csrfField is the hidden input carrying the token, for use inside forms.
+func csrfField(r *http.Request) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFormField + `" value="` +
+		template.HTMLEscapeString(csrfToken(r)) + `">`)
+}
+
+// isSafeMethod reports whether a method only reads.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// csrfProtect rejects changes that don't prove they came from one of our own
+// pages. Forms post the per-session token (or, before login, the csrf cookie
+// value) in csrfFormField; scripts send it, or the csrf cookie value, in the
+// X-CSRF-Token header. Requests authenticated with a bearer token carry no
+// cookies a browser could replay, so they are let through.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookieToken string
+		if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+			cookieToken = c.Value
+		} else {
+			token, err := newToken()
+			if err != nil {
+				http.Error(w, "Failed to start session", http.StatusInternalServerError)
+				return
+			}
+			cookieToken = token
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     "/",
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		expected := cookieToken
+		if c, err := r.Cookie(sessionCookie); err == nil && c.Value != "" {
+			expected = sessionCSRFToken(c.Value)
+		}
+		if !isSafeMethod(r.Method) && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			if status, msg := checkCSRF(w, r, expected, cookieToken); status != 0 {
+				http.Error(w, msg, status)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey, expected)))
+	})
+}
+
+// checkCSRF returns the status and message to reject a change with, or 0.
+// The form is parsed on r itself so outer middleware, such as the audit
+// log, can still read it.
+func checkCSRF(w http.ResponseWriter, r *http.Request, expected, cookieToken string) (int, string) {
+	if header := r.Header.Get(csrfHeader); header != "" {
+		if tokensEqual(header, expected) || tokensEqual(header, cookieToken) {
+			return 0, ""
+		}
+		return http.StatusForbidden, "Invalid CSRF token"
+	}
+	if err := parseForm(w, r); err != nil {
+		return http.StatusBadRequest, "Upload too large or malformed"
+	}
+	if !tokensEqual(r.PostFormValue(csrfFormField), expected) {
+		return http.StatusForbidden, "Invalid or missing CSRF token. Reload the page and try again."
+	}
+	return 0, ""
+}
+
+// parseForm parses a posted form so its token can be checked. Uploads are
+// capped here because once parsed, handlers can no longer limit the body.
+func parseForm(w http.ResponseWriter, r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.ParseForm()
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecipeUpload)
+	if err := r.ParseMultipartForm(maxRecipeUpload); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return nil
+}
+
+func tokensEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFRejectsMissingOrWrongToken(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice"}},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 2,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cookie := loginAs(t, "sam", false)
+
+	for _, token := range []string{"", "forged", sessionCSRFToken("another session")} {
+		form := url.Values{"id": {"1"}}
+		if token != "" {
+			form.Set(csrfFormField, token)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/pantry/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("token %q: expected 403, got %d", token, w.Code)
+		}
+	}
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.PantryItems) != 1 {
+		t.Fatalf("expected the item to survive forged requests, got %+v", store.PantryItems)
+	}
+
+	form := url.Values{"id": {"1"}, csrfFormField: {sessionCSRFToken(cookie.Value)}}
+	req := httptest.NewRequest(http.MethodPost, "/pantry/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected the session's token to be accepted, got %d", w.Code)
+	}
+}
+
+func TestCSRFDoubleSubmitHeader(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+
+	for _, tc := range []struct {
+		header string
+		want   int
+	}{{"browser-token", http.StatusSeeOther}, {"guessed", http.StatusForbidden}} {
+		req := httptest.NewRequest(http.MethodPost, "/shopping/add", strings.NewReader("name=Milk"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, tc.header)
+		req.AddCookie(cookie)
+		req.AddCookie(&http.Cookie{Name: csrfCookie, Value: "browser-token"})
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("header %q: expected %d, got %d", tc.header, tc.want, w.Code)
+		}
+	}
+}
+
+func TestFormsCarryCSRFToken(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	field := `name="csrf_token" value="` + sessionCSRFToken(cookie.Value) + `"`
+	if forms, fields := strings.Count(body, `method="POST"`), strings.Count(body, field); forms == 0 || forms != fields {
+		t.Errorf("expected every one of the %d forms to carry the token, found %d", forms, fields)
+	}
+}
+
+func TestLoginRequiresCookieToken(t *testing.T) {
+	setupHandlerTest(t)
+	if _, err := createUser("sam", "correct horse", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The login page hands out the cookie its form's token must match.
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	var browser *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookie {
+			browser = c
+		}
+	}
+	if browser == nil {
+		t.Fatal("expected the login page to set a csrf cookie")
+	}
+	if !strings.Contains(w.Body.String(), `value="`+browser.Value+`"`) {
+		t.Error("expected the login form to carry the cookie's token")
+	}
+
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{{"", http.StatusForbidden}, {browser.Value, http.StatusSeeOther}} {
+		form := url.Values{"username": {"sam"}, "password": {"correct horse"}, csrfFormField: {tc.token}}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(browser)
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("token %q: expected %d, got %d", tc.token, tc.want, w.Code)
+		}
+	}
+}
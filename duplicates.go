@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// findDuplicate returns the pantry item that item looks like a copy of: the
+// same name once normalised, or one close enough to be the same product.
+func findDuplicate(item PantryItem, items []PantryItem) (PantryItem, bool) {
+	others := make([]PantryItem, 0, len(items))
+	for _, other := range items {
+		if other.ID != item.ID {
+			others = append(others, other)
+		}
+	}
+	match, _, ok := bestPantryMatch(item.Name, others)
+	return match, ok
+}
+
+// topUp adds a new purchase of an item to the existing one. Stock with a
+// different expiry date is kept as a batch of its own, so it's still used
+// earliest expiry first; otherwise the quantities are added together.
+func topUp(existing *PantryItem, added PantryItem) {
+	expiriesDiffer := added.Expiry != "" && existing.Expiry != "" && added.Expiry != existing.Expiry
+	if len(existing.Batches) > 0 || len(added.Batches) > 0 || expiriesDiffer {
+		existing.Batches = append(itemBatches(*existing), itemBatches(added)...)
+	} else {
+		existing.Quantity = batchTotal([]Batch{{Quantity: existing.Quantity}, {Quantity: added.Quantity}})
+		existing.Expiry = earliestExpiry(existing.Expiry, added.Expiry)
+	}
+	if existing.Category == "" {
+		existing.Category = added.Category
+	}
+	if existing.LocationID == 0 {
+		existing.LocationID, existing.Position = added.LocationID, added.Position
+	}
+	existing.Notes = mergeNotes(existing.Notes, added.Notes)
+	existing.Tags = mergeTags(existing.Tags, added.Tags...)
+	sortTags(existing.Tags)
+	existing.syncBatches()
+}
+
+// itemBatches returns an item's batches, or its stock as a single batch if
+// it has none.
+func itemBatches(item PantryItem) []Batch {
+	if len(item.Batches) > 0 {
+		return item.Batches
+	}
+	if item.Quantity == "" && item.Expiry == "" {
+		return nil
+	}
+	return []Batch{{Quantity: item.Quantity, Expiry: item.Expiry}}
+}
+
+// earliestExpiry returns the earlier of two expiry dates, ignoring blanks.
+func earliestExpiry(a, b string) string {
+	if a == "" || (b != "" && b < a) {
+		return b
+	}
+	return a
+}
+
+// mergeNotes joins two items' notes, leaving out repeats.
+func mergeNotes(a, b string) string {
+	switch {
+	case b == "" || strings.Contains(a, b):
+		return a
+	case a == "" || strings.Contains(b, a):
+		return b
+	}
+	return a + "\n" + b
+}
+
+// duplicateGroups finds sets of pantry items that look like the same
+// product, each ordered by ID so the oldest item comes first.
+func duplicateGroups(items []PantryItem) [][]PantryItem {
+	sorted := append([]PantryItem(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	grouped := make(map[int]bool)
+	var groups [][]PantryItem
+	for i, item := range sorted {
+		if grouped[item.ID] {
+			continue
+		}
+		group := []PantryItem{item}
+		for _, other := range sorted[i+1:] {
+			if !grouped[other.ID] && nameSimilarity(item.Name, other.Name) >= matchThreshold {
+				group = append(group, other)
+				grouped[other.ID] = true
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// mergeItems folds the items in ids into the one with keepID: quantities are
+// combined, the earliest expiry kept and notes and tags merged. Freezer
+// meals made from the merged items are pointed at the kept one. It returns
+// the merged item.
+func mergeItems(store *Store, keepID int, ids []int) (*PantryItem, error) {
+	i := pantryIndex(store, keepID)
+	if i < 0 {
+		return nil, fmt.Errorf("pantry item %d no longer exists", keepID)
+	}
+	merge := make(map[int]bool)
+	for _, id := range ids {
+		if id == keepID {
+			continue
+		}
+		if pantryIndex(store, id) < 0 {
+			return nil, fmt.Errorf("pantry item %d no longer exists", id)
+		}
+		merge[id] = true
+	}
+	kept := store.PantryItems[i]
+	items := store.PantryItems[:0]
+	for _, item := range store.PantryItems {
+		if merge[item.ID] {
+			topUp(&kept, item)
+			continue
+		}
+		items = append(items, item)
+	}
+	store.PantryItems = items
+	for m := range store.FreezerMeals {
+		for n, ing := range store.FreezerMeals[m].Ingredients {
+			if merge[ing.PantryItemID] {
+				store.FreezerMeals[m].Ingredients[n].PantryItemID = keepID
+			}
+		}
+	}
+	i = pantryIndex(store, keepID)
+	store.PantryItems[i] = kept
+	return &store.PantryItems[i], nil
+}
+
+// saveMerge saves a store after mergeItems and, in the same transaction,
+// moves the merged items' price history and recipe matches to the kept item.
+func saveMerge(householdID int, store *Store, keepID int, merged []int) (err error) {
+	defer observeDB("save_merge", time.Now(), &err)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range merged {
+		if id == keepID {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE purchases SET pantry_item_id = ? WHERE pantry_item_id = ? AND household_id = ?", keepID, id, householdID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			"UPDATE recipe_ingredients SET pantry_item_id = ? WHERE pantry_item_id = ? AND recipe_id IN (SELECT id FROM recipes WHERE household_id = ?)",
+			keepID, id, householdID,
+		); err != nil {
+			return err
+		}
+	}
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
+		return err
+	}
+	return commitAndPublish(tx, events)
+}
+
+// duplicatesHandler lists pantry items that look like the same product.
+func duplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "duplicates.html", duplicateGroups(store.PantryItems))
+}
+
+// mergeDuplicatesHandler merges the items posted as "merge" into the one in
+// "id".
+func mergeDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/pantry/duplicates", http.StatusSeeOther)
+		return
+	}
+	keepID, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	var ids []int
+	for _, v := range r.Form["merge"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid item to merge", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	kept, err := mergeItems(store, keepID, ids)
+	if err != nil {
+		http.Error(w, "Could not merge: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveMerge(hh, store, keepID, ids); err != nil {
+		saveFailed(w, r, "/pantry/duplicates", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Merged the duplicates into "+kept.Name+".")
+	http.Redirect(w, r, "/pantry/duplicates", http.StatusSeeOther)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAddPantryDetectsDuplicates(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Tinned Tomatoes", Quantity: "2 cans", Category: "Canned Goods"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"name": {"tinned tomato"}, "quantity": {"3 cans"}}
+	w := postForm(addPantryHandler, "/pantry/add", form)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "Top up Tinned Tomatoes") {
+		t.Fatalf("expected 409 offering a top-up, got %d", w.Code)
+	}
+
+	form.Set("top_up", "1")
+	if w := postForm(addPantryHandler, "/pantry/add", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if len(store.PantryItems) != 1 || store.PantryItems[0].Quantity != "5 cans" {
+		t.Fatalf("expected the tomatoes topped up to 5 cans, got %+v", store.PantryItems)
+	}
+
+	form.Del("top_up")
+	form.Set("duplicate", "add")
+	postForm(addPantryHandler, "/pantry/add", form)
+	if store, _ := loadStore(defaultHouseholdID); len(store.PantryItems) != 2 {
+		t.Errorf("expected a separate item when asked, got %+v", store.PantryItems)
+	}
+}
+
+func TestTopUpKeepsDifferentExpiriesAsBatches(t *testing.T) {
+	existing := PantryItem{Name: "Beans", Quantity: "1 can", Expiry: "2025-06-01", Notes: "Top shelf"}
+	topUp(&existing, PantryItem{Name: "beans", Quantity: "2 cans", Expiry: "2025-03-01", Notes: "Top shelf", Tags: []string{"vegan"}})
+	if len(existing.Batches) != 2 || existing.Quantity != "3 cans" || existing.Expiry != "2025-03-01" {
+		t.Errorf("expected two batches totalling 3 cans, got %+v", existing)
+	}
+	if existing.Notes != "Top shelf" || len(existing.Tags) != 1 {
+		t.Errorf("expected notes and tags merged without repeats, got %+v", existing)
+	}
+}
+
+func TestDuplicateGroups(t *testing.T) {
+	groups := duplicateGroups([]PantryItem{
+		{ID: 3, Name: "tinned tomatoes"},
+		{ID: 1, Name: "Tinned Tomatoes"},
+		{ID: 2, Name: "Rice"},
+		{ID: 4, Name: "Tinned tomato"},
+	})
+	if len(groups) != 1 || len(groups[0]) != 3 || groups[0][0].ID != 1 {
+		t.Errorf("expected one group of three tomatoes, oldest first, got %+v", groups)
+	}
+}
+
+func TestMergeDuplicatesHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Plain Flour", Quantity: "500 g", Expiry: "2025-09-01", Notes: "Open bag"},
+			{ID: 2, Name: "plain flour", Quantity: "1 kg", Notes: "For bread"},
+			{ID: 3, Name: "Sugar", Quantity: "1 kg"},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Bread", Ingredients: []FreezerMealIngredient{{PantryItemID: 2, Name: "plain flour"}}}},
+		NextPantryID: 4,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addPurchase(defaultHouseholdID, &Purchase{PantryItemID: 2, Price: Money{Amount: 90, Currency: "GBP"}, Date: "2025-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postForm(mergeDuplicatesHandler, "/pantry/duplicates/merge", url.Values{"id": {"1"}, "merge": {"1", "9"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown item, got %d", w.Code)
+	}
+	if w := postForm(mergeDuplicatesHandler, "/pantry/duplicates/merge", url.Values{"id": {"1"}, "merge": {"1", "2"}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.PantryItems) != 2 {
+		t.Fatalf("expected the flours merged, got %+v", store.PantryItems)
+	}
+	flour := store.PantryItems[pantryIndex(store, 1)]
+	if flour.Quantity != "1500 g" || flour.Expiry != "2025-09-01" || flour.Notes != "Open bag\nFor bread" {
+		t.Errorf("unexpected merged item: %+v", flour)
+	}
+	if store.FreezerMeals[0].Ingredients[0].PantryItemID != 1 {
+		t.Errorf("expected the freezer meal to point at the kept item, got %+v", store.FreezerMeals[0].Ingredients)
+	}
+	if purchases, _ := loadPurchases(defaultHouseholdID, 1); len(purchases) != 1 {
+		t.Errorf("expected the price history moved to the kept item, got %+v", purchases)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Kinds of item event.
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDeleted = "deleted"
+)
+
+// itemEvent tells open pages that a pantry item or freezer meal was
+// created, updated or deleted, so they can show the change without a
+// reload.
+type itemEvent struct {
+	Type    string `json:"type"`
+	Kind    string `json:"kind"`
+	ID      int    `json:"id"`
+	Version int    `json:"version,omitempty"`
+	// household is whose item it is; only that household's pages hear of it.
+	household int
+}
+
+// eventBuffer is how many events a subscriber can fall behind by before it
+// is dropped. A dropped page reconnects and refreshes everything.
+const eventBuffer = 64
+
+// eventHub passes item events from the requests that save them to the
+// /events streams of the household's open pages.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan itemEvent]int
+	closed bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan itemEvent]int)}
+}
+
+// itemEvents is the server's event hub. writeStore's callers publish to it
+// once their transaction commits.
+var itemEvents = newEventHub()
+
+// subscribe returns a channel of a household's events and a function to
+// stop listening. The channel is closed if the subscriber falls too far
+// behind or the hub closes.
+func (h *eventHub) subscribe(householdID int) (<-chan itemEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan itemEvent, eventBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = householdID
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends events to the subscribers of their household. It never
+// blocks: a subscriber whose buffer is full is dropped instead.
+func (h *eventHub) publish(events ...itemEvent) {
+	if len(events) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, hh := range h.subs {
+		for _, ev := range events {
+			if ev.household != hh {
+				continue
+			}
+			select {
+			case ch <- ev:
+				continue
+			default:
+			}
+			delete(h.subs, ch)
+			close(ch)
+			break
+		}
+	}
+}
+
+// close ends every stream, so a shutting-down server isn't kept waiting by
+// pages that would otherwise stay connected.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// eventHeartbeat is how often an idle stream sends a comment, so proxies
+// don't time it out and dead connections are noticed.
+const eventHeartbeat = 25 * time.Second
+
+// eventsHandler streams the household's item events as Server-Sent Events,
+// each an "item" event with an itemEvent as its JSON data.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// A stream outlives the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events, stop := itemEvents.subscribe(householdID(r))
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Stop nginx buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: item\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// commitAndPublish commits tx and then publishes the events writeStore
+// returned for it. Nothing is published if the commit fails.
+func commitAndPublish(tx *sql.Tx, events []itemEvent) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	itemEvents.publish(events...)
+	return nil
+}
+
+// appendItemEvent adds an event of type typ for an item saved at version,
+// unless typ is "".
+func appendItemEvent(events []itemEvent, typ, kind string, id, version, householdID int) []itemEvent {
+	if typ == "" {
+		return events
+	}
+	return append(events, itemEvent{Type: typ, Kind: kind, ID: id, Version: version, household: householdID})
+}
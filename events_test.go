@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useEventHub gives the test its own event hub.
+func useEventHub(t *testing.T) {
+	t.Helper()
+	orig := itemEvents
+	itemEvents = newEventHub()
+	t.Cleanup(func() { itemEvents = orig })
+}
+
+// drain returns the events waiting on ch.
+func drain(ch <-chan itemEvent) []itemEvent {
+	var events []itemEvent
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventHubScopesByHousehold(t *testing.T) {
+	hub := newEventHub()
+	home, stopHome := hub.subscribe(1)
+	other, stopOther := hub.subscribe(2)
+	defer stopOther()
+
+	hub.publish(itemEvent{Type: eventCreated, Kind: "pantry", ID: 7, Version: 1, household: 1})
+	if got := drain(home); len(got) != 1 || got[0].ID != 7 {
+		t.Errorf("expected household 1 to hear of item 7, got %+v", got)
+	}
+	if got := drain(other); len(got) != 0 {
+		t.Errorf("expected household 2 to hear nothing, got %+v", got)
+	}
+
+	stopHome()
+	if _, ok := <-home; ok {
+		t.Error("expected stopping to close the channel")
+	}
+	stopHome() // stopping twice is harmless
+}
+
+func TestEventHubDropsSlowSubscribers(t *testing.T) {
+	hub := newEventHub()
+	ch, stop := hub.subscribe(1)
+	defer stop()
+
+	for i := 0; i <= eventBuffer; i++ {
+		hub.publish(itemEvent{Type: eventUpdated, Kind: "pantry", ID: i, household: 1})
+	}
+	if got := len(drain(ch)); got != eventBuffer {
+		t.Errorf("expected the %d buffered events, got %d", eventBuffer, got)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected a subscriber that fell behind to be dropped")
+	}
+
+	hub.close()
+	late, _ := hub.subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("expected subscribing to a closed hub to give a closed channel")
+	}
+}
+
+func TestSaveStorePublishesItemEvents(t *testing.T) {
+	useTempDB(t)
+	useEventHub(t)
+	ch, stop := itemEvents.subscribe(defaultHouseholdID)
+	defer stop()
+
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Rice", Quantity: "1 kg"},
+			{ID: 2, Name: "Oats", Quantity: "500 g"},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextPantryID: 3,
+		NextMealID:   2,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeEvents(drain(ch)); got != "created pantry 1 v1, created pantry 2 v1, created freezer 1 v1" {
+		t.Errorf("unexpected events for a new store: %s", got)
+	}
+
+	loaded, _ := loadStore(defaultHouseholdID)
+	loaded.PantryItems[pantryIndex(loaded, 1)].Quantity = "750 g"
+	loaded.PantryItems = loaded.PantryItems[:pantryIndex(loaded, 2)]
+	if err := saveStore(defaultHouseholdID, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeEvents(drain(ch)); got != "updated pantry 1 v2, deleted pantry 2 v0" {
+		t.Errorf("unexpected events for an edit and a delete: %s", got)
+	}
+
+	// Saving with nothing changed tells nobody anything.
+	loaded, _ = loadStore(defaultHouseholdID)
+	if err := saveStore(defaultHouseholdID, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(ch); len(got) != 0 {
+		t.Errorf("expected no events for an unchanged save, got %+v", got)
+	}
+}
+
+func describeEvents(events []itemEvent) string {
+	var parts []string
+	for _, ev := range events {
+		parts = append(parts, ev.Type+" "+ev.Kind+" "+strconv.Itoa(ev.ID)+" v"+strconv.Itoa(ev.Version))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestEventsHandlerStreamsItemEvents(t *testing.T) {
+	useEventHub(t)
+	srv := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for the stream")
+			return ""
+		}
+	}
+
+	// The retry line is only sent once the handler has subscribed.
+	if line := next(); line != "retry: 5000" {
+		t.Fatalf("expected the stream to open with a retry delay, got %q", line)
+	}
+	next()
+	itemEvents.publish(
+		itemEvent{Type: eventCreated, Kind: "pantry", ID: 9, Version: 1, household: defaultHouseholdID + 1},
+		itemEvent{Type: eventUpdated, Kind: "freezer", ID: 4, Version: 3, household: defaultHouseholdID},
+	)
+	if line := next(); line != "event: item" {
+		t.Fatalf("expected an item event, got %q", line)
+	}
+	data, ok := strings.CutPrefix(next(), "data: ")
+	if !ok {
+		t.Fatal("expected the event's data")
+	}
+	var ev itemEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != eventUpdated || ev.Kind != "freezer" || ev.ID != 4 || ev.Version != 3 {
+		t.Errorf("expected only this household's update of meal 4, got %+v", ev)
+	}
+
+	// Closing the hub, as a shutting-down server does, ends the stream.
+	itemEvents.close()
+	for range lines {
+	}
+}
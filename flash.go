@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const flashCookie = "flash"
+
+// Flash kinds, which style the toast.
+const (
+	flashSuccess = "success"
+	flashError   = "error"
+)
+
+// flash is a one-off notice shown on the next page the user sees, such as
+// "Added Rice to the pantry." after a post-redirect-get.
+type flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+var (
+	flashKeyOnce sync.Once
+	flashKey     []byte
+)
+
+// flashSigningKey returns the key flash cookies are signed with. It is made
+// fresh each run; a restart only loses notices that hadn't been shown yet.
+func flashSigningKey() []byte {
+	flashKeyOnce.Do(func() {
+		flashKey = make([]byte, 32)
+		if _, err := rand.Read(flashKey); err != nil {
+			fatal("failed to create flash key", "err", err)
+		}
+	})
+	return flashKey
+}
+
+func signFlash(payload string) string {
+	mac := hmac.New(sha256.New, flashSigningKey())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// readFlashes returns the notices in the request's flash cookie, ignoring a
+// cookie that has been tampered with.
+func readFlashes(r *http.Request) []flash {
+	c, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signFlash(payload))) {
+		return nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	var flashes []flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
+
+// addFlash queues a notice for the next page shown, after any not yet shown.
+func addFlash(w http.ResponseWriter, r *http.Request, kind, message string) {
+	flashes := append(readFlashes(r), flash{Kind: kind, Message: message})
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		slog.Error("flash failed", "err", err)
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    payload + "." + signFlash(payload),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// takeFlashes returns the queued notices and clears them so they are shown
+// once. It must be called before the response is written.
+func takeFlashes(w http.ResponseWriter, r *http.Request) []flash {
+	flashes := readFlashes(r)
+	if _, err := r.Cookie(flashCookie); err == nil {
+		http.SetCookie(w, &http.Cookie{Name: flashCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	}
+	return flashes
+}
+
+// saveFailed tells the user their change wasn't saved and sends them back to
+// the page they came from, instead of leaving them on a bare error page. The
+// redirect isn't a success, so the change isn't audited.
+func saveFailed(w http.ResponseWriter, r *http.Request, back string, err error) {
+	noteChangeFailed(r)
+	if errors.Is(err, errConflict) {
+		addFlash(w, r, flashError, "Someone else changed the same thing at the same time, so your changes weren't saved. Please check and try again.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	slog.Error("save failed", "path", r.URL.Path, "err", err)
+	addFlash(w, r, flashError, "Your changes couldn't be saved. Please try again.")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// flashCookieFrom returns the flash cookie a response set.
+func flashCookieFrom(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == flashCookie {
+			return c
+		}
+	}
+	t.Fatal("expected a flash cookie")
+	return nil
+}
+
+func TestFlashShownOnceAfterRedirect(t *testing.T) {
+	setupHandlerTest(t)
+
+	w := postForm(addPantryHandler, "/pantry/add", url.Values{"name": {"Rice"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	cookie := flashCookieFrom(t, w)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	indexHandler(w, req)
+	if !strings.Contains(w.Body.String(), "Added Rice to the pantry.") {
+		t.Error("expected the index to show the flash")
+	}
+	if cleared := flashCookieFrom(t, w); cleared.MaxAge >= 0 {
+		t.Errorf("expected the flash cookie to be cleared once shown, got %+v", cleared)
+	}
+}
+
+func TestFlashesQueueAndRejectTampering(t *testing.T) {
+	w := httptest.NewRecorder()
+	addFlash(w, httptest.NewRequest(http.MethodGet, "/", nil), flashSuccess, "first")
+	first := flashCookieFrom(t, w)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(first)
+	w = httptest.NewRecorder()
+	addFlash(w, req, flashError, "second")
+	both := flashCookieFrom(t, w)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(both)
+	if got := readFlashes(req); len(got) != 2 || got[0].Message != "first" || got[1].Kind != flashError {
+		t.Errorf("expected both flashes in order, got %+v", got)
+	}
+
+	payload, _, _ := strings.Cut(both.Value, ".")
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: flashCookie, Value: payload + ".forged"})
+	if got := readFlashes(req); got != nil {
+		t.Errorf("expected a forged flash to be ignored, got %+v", got)
+	}
+}
+
+func TestSaveFailedRedirectsWithError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/pantry/add", nil)
+	w := httptest.NewRecorder()
+	saveFailed(w, req, "/", errors.New("disk full"))
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Errorf("expected a redirect to /, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(flashCookieFrom(t, w))
+	if got := readFlashes(req); len(got) != 1 || got[0].Kind != flashError {
+		t.Errorf("expected an error flash, got %+v", got)
+	}
+}
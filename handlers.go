@@ -1,11 +1,11 @@
 package main
 
 import (
-	"log"
+	"errors"
 	"net/http"
 	"sort"
 	"strconv"
-	"strings"
+	"time"
 )
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -13,17 +13,89 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	store, err := loadStore()
+	renderIndex(w, r, http.StatusOK, formState{})
+}
+
+// renderIndex shows the inventory. A failed form is shown reopened with its
+// errors, under the given status.
+func renderIndex(w http.ResponseWriter, r *http.Request, status int, form formState) {
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+
+	alloc, err := loadAllocation(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	tags, err := loadTags(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	locs, err := loadLocations(hh)
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
 
-	// Sort pantry items: expiring soonest first, no expiry at the end, then alphabetically
-	sort.Slice(store.PantryItems, func(i, j int) bool {
-		ei, ej := store.PantryItems[i].Expiry, store.PantryItems[j].Expiry
+	// The pantry's value is of everything in it, not just what the filter
+	// shows.
+	values, err := loadValuation(hh, store.PantryItems)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+
+	filter := parseTagFilter(r)
+	filter.apply(store)
+	sortPantryItems(store.PantryItems)
+	sortFreezerMeals(store.FreezerMeals)
+
+	page := indexPage{Store: store, allocation: alloc, valuation: values, Tags: tags, Locations: locs, Filter: filter, Form: form}
+	renderStatus(w, r, status, "index.html", page)
+}
+
+// indexPage is the data for the main page: the store plus the stock the meal
+// plan has allocated, what the pantry is worth, the tags the inventory can be
+// filtered by, where things can be kept and any form that failed validation.
+type indexPage struct {
+	*Store
+	allocation
+	valuation
+	Tags      []Tag
+	Locations locations
+	Filter    tagFilter
+	Form      formState
+}
+
+// placeField is the place select of one of the index's modals.
+type placeField struct {
+	Modal  string
+	Groups []placeGroup
+	Error  string
+}
+
+// PlaceField returns the place select for modal, keeping what was picked if
+// its form failed validation.
+func (p indexPage) PlaceField(modal string) placeField {
+	return placeField{
+		Modal:  modal,
+		Groups: p.Locations.Places(p.Form.Value(modal, "place")),
+		Error:  p.Form.Error(modal, "place"),
+	}
+}
+
+// sortPantryItems orders items by their nearest expiry, soonest first, no
+// expiry at the end, then alphabetically.
+func sortPantryItems(items []PantryItem) {
+	sort.Slice(items, func(i, j int) bool {
+		ei, ej := items[i].NearestExpiry(), items[j].NearestExpiry()
 		if ei == "" && ej == "" {
-			return store.PantryItems[i].Name < store.PantryItems[j].Name
+			return items[i].Name < items[j].Name
 		}
 		if ei == "" {
 			return false
@@ -33,19 +105,24 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return ei < ej
 	})
+}
 
-	// Sort freezer meals: oldest first (eat those first), then alphabetically
-	sort.Slice(store.FreezerMeals, func(i, j int) bool {
-		di, dj := store.FreezerMeals[i].DateFrozen, store.FreezerMeals[j].DateFrozen
+// sortFreezerMeals orders meals oldest first (eat those first), then
+// alphabetically.
+func sortFreezerMeals(meals []FreezerMeal) {
+	sort.Slice(meals, func(i, j int) bool {
+		di, dj := meals[i].DateFrozen, meals[j].DateFrozen
 		if di == dj {
-			return store.FreezerMeals[i].Name < store.FreezerMeals[j].Name
+			return meals[i].Name < meals[j].Name
 		}
 		return di < dj
 	})
+}
 
-	if err := tmpl.Execute(w, store); err != nil {
-		log.Println("Template error:", err)
-	}
+// invalidForm re-renders the index with modal reopened, the user's input
+// kept and errs shown against their fields.
+func invalidForm(w http.ResponseWriter, r *http.Request, modal string, tags []string, errs fieldErrors) {
+	renderIndex(w, r, http.StatusUnprocessableEntity, formState{Modal: modal, Values: r.PostForm, Tags: tags, Errors: errs})
 }
 
 func addPantryHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,29 +130,61 @@ func addPantryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	store, err := loadStore()
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	item := pantryItemFromForm(r)
+	errs := validatePantryItem(&item)
+	if err := validatePlace(householdID(r), errs, "place", item.LocationID, item.Position); err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	store.PantryItems = append(store.PantryItems, PantryItem{
-		ID:       store.NextPantryID,
-		Name:     name,
-		Quantity: strings.TrimSpace(r.FormValue("quantity")),
-		Category: r.FormValue("category"),
-		Expiry:   r.FormValue("expiry"),
-		Notes:    strings.TrimSpace(r.FormValue("notes")),
-	})
+	if len(errs) > 0 {
+		invalidForm(w, r, "add-pantry", item.Tags, errs)
+		return
+	}
+	if v := r.FormValue("top_up"); v != "" {
+		topUpPantryItem(w, r, store, v, item)
+		return
+	}
+	if r.FormValue("duplicate") != "add" {
+		if dup, ok := findDuplicate(item, store.PantryItems); ok {
+			renderIndex(w, r, http.StatusConflict, formState{Modal: "add-pantry", Values: r.PostForm, Tags: item.Tags, Duplicate: &dup})
+			return
+		}
+	}
+	item.ID = store.NextPantryID
+	store.PantryItems = append(store.PantryItems, item)
 	store.NextPantryID++
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	if err := saveStore(householdID(r), store); err != nil {
+		saveFailed(w, r, "/", err)
 		return
 	}
+	addFlash(w, r, flashSuccess, "Added "+item.Name+" to the pantry.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// topUpPantryItem adds item to the existing pantry item with the ID in v,
+// for when an add turned out to be more of something already stocked.
+func topUpPantryItem(w http.ResponseWriter, r *http.Request, store *Store, v string, item PantryItem) {
+	id, err := strconv.Atoi(v)
+	i := -1
+	if err == nil {
+		i = pantryIndex(store, id)
+	}
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	existing := &store.PantryItems[i]
+	topUp(existing, item)
+	if err := saveStore(householdID(r), store); err != nil {
+		saveFailed(w, r, "/", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Topped up "+existing.Name+".")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -84,35 +193,59 @@ func editPantryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	id, ok := formID(w, r)
+	if !ok {
 		return
 	}
-	store, err := loadStore()
+	version, ok := formVersion(w, r)
+	if !ok {
+		return
+	}
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	i := pantryIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
 		return
 	}
-	for i := range store.PantryItems {
-		if store.PantryItems[i].ID == id {
-			store.PantryItems[i].Name = name
-			store.PantryItems[i].Quantity = strings.TrimSpace(r.FormValue("quantity"))
-			store.PantryItems[i].Category = r.FormValue("category")
-			store.PantryItems[i].Expiry = r.FormValue("expiry")
-			store.PantryItems[i].Notes = strings.TrimSpace(r.FormValue("notes"))
-			break
-		}
+	item := pantryItemFromForm(r)
+	errs := validatePantryItem(&item)
+	if err := validatePlace(householdID(r), errs, "place", item.LocationID, item.Position); err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if len(errs) > 0 {
+		invalidForm(w, r, "edit-pantry", item.Tags, errs)
+		return
+	}
+	item.ID = id
+	// Batches are edited on the item's page; they set its quantity and
+	// expiry.
+	item.Batches = store.PantryItems[i].Batches
+	item.syncBatches()
+	// Someone else may have saved the item since the form was opened.
+	if pantryConflicts(version, item, store.PantryItems[i]) {
+		renderPantryConflict(w, r, item, store.PantryItems[i])
+		return
 	}
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	store.PantryItems[i] = item
+	if err := saveStore(householdID(r), store); err != nil {
+		// Or between loading the item and saving it.
+		if errors.Is(err, errConflict) {
+			if store, err := loadStore(householdID(r)); err == nil {
+				if i := pantryIndex(store, id); i >= 0 {
+					renderPantryConflict(w, r, item, store.PantryItems[i])
+					return
+				}
+			}
+		}
+		saveFailed(w, r, "/", err)
 		return
 	}
+	addFlash(w, r, flashSuccess, "Updated "+item.Name+".")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -121,57 +254,75 @@ func deletePantryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	id, ok := formID(w, r)
+	if !ok {
 		return
 	}
-	store, err := loadStore()
+	outcome, ok := removalOutcome(w, r)
+	if !ok {
+		return
+	}
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	items := make([]PantryItem, 0, len(store.PantryItems))
-	for _, item := range store.PantryItems {
-		if item.ID != id {
-			items = append(items, item)
-		}
+	i := pantryIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
 	}
-	store.PantryItems = items
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	name := store.PantryItems[i].Name
+	if err := removePantryItem(householdID(r), store, i, outcome); err != nil {
+		saveFailed(w, r, "/", err)
 		return
 	}
+	addFlash(w, r, flashSuccess, removedMessage(name, outcome))
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// removePantryItem takes the item at i out of store and saves it, logging
+// what became of the item, valued from its price history, unless outcome is
+// blank.
+func removePantryItem(householdID int, store *Store, i int, outcome string) error {
+	removed := store.PantryItems[i]
+	values, err := loadValuation(householdID, []PantryItem{removed})
+	if err != nil {
+		return err
+	}
+	value, _ := values.value(removed.ID)
+	store.PantryItems = append(store.PantryItems[:i], store.PantryItems[i+1:]...)
+	return saveRemoval(householdID, store, pantryRemoval(removed, outcome, value, time.Now()))
+}
+
 func addFreezerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	store, err := loadStore()
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	meal := freezerMealFromForm(r)
+	errs := validateFreezerMeal(&meal)
+	if err := validatePlace(householdID(r), errs, "place", meal.LocationID, meal.Position); err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	store.FreezerMeals = append(store.FreezerMeals, FreezerMeal{
-		ID:          store.NextMealID,
-		Name:        name,
-		Portions:    strings.TrimSpace(r.FormValue("portions")),
-		DateFrozen:  r.FormValue("date_frozen"),
-		Description: strings.TrimSpace(r.FormValue("description")),
-	})
+	if len(errs) > 0 {
+		invalidForm(w, r, "add-freezer", meal.Tags, errs)
+		return
+	}
+	meal.ID = store.NextMealID
+	store.FreezerMeals = append(store.FreezerMeals, meal)
 	store.NextMealID++
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	if err := saveStore(householdID(r), store); err != nil {
+		saveFailed(w, r, "/", err)
 		return
 	}
+	addFlash(w, r, flashSuccess, "Added "+meal.Name+" to the freezer.")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -180,34 +331,55 @@ func editFreezerHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := formVersion(w, r)
+	if !ok {
 		return
 	}
-	store, err := loadStore()
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	name := strings.TrimSpace(r.FormValue("name"))
-	if name == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	i := freezerIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
 		return
 	}
-	for i := range store.FreezerMeals {
-		if store.FreezerMeals[i].ID == id {
-			store.FreezerMeals[i].Name = name
-			store.FreezerMeals[i].Portions = strings.TrimSpace(r.FormValue("portions"))
-			store.FreezerMeals[i].DateFrozen = r.FormValue("date_frozen")
-			store.FreezerMeals[i].Description = strings.TrimSpace(r.FormValue("description"))
-			break
-		}
+	meal := freezerMealFromForm(r)
+	errs := validateFreezerMeal(&meal)
+	if err := validatePlace(householdID(r), errs, "place", meal.LocationID, meal.Position); err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if len(errs) > 0 {
+		invalidForm(w, r, "edit-freezer", meal.Tags, errs)
+		return
 	}
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	meal.ID = id
+	// Batch-cook ingredients aren't editable, so keep them.
+	meal.Ingredients = store.FreezerMeals[i].Ingredients
+	if mealConflicts(version, meal, store.FreezerMeals[i]) {
+		renderMealConflict(w, r, meal, store.FreezerMeals[i])
 		return
 	}
+	store.FreezerMeals[i] = meal
+	if err := saveStore(householdID(r), store); err != nil {
+		if errors.Is(err, errConflict) {
+			if store, err := loadStore(householdID(r)); err == nil {
+				if i := freezerIndex(store, id); i >= 0 {
+					renderMealConflict(w, r, meal, store.FreezerMeals[i])
+					return
+				}
+			}
+		}
+		saveFailed(w, r, "/", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Updated "+meal.Name+".")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -216,26 +388,61 @@ func deleteFreezerHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	id, err := strconv.Atoi(r.FormValue("id"))
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	outcome, ok := removalOutcome(w, r)
+	if !ok {
 		return
 	}
-	store, err := loadStore()
+	store, err := loadStore(householdID(r))
 	if err != nil {
 		http.Error(w, "Failed to load data", http.StatusInternalServerError)
 		return
 	}
-	meals := make([]FreezerMeal, 0, len(store.FreezerMeals))
-	for _, meal := range store.FreezerMeals {
-		if meal.ID != id {
-			meals = append(meals, meal)
-		}
+	i := freezerIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
 	}
-	store.FreezerMeals = meals
-	if err := saveStore(store); err != nil {
-		http.Error(w, "Failed to save data", http.StatusInternalServerError)
+	removed := store.FreezerMeals[i]
+	store.FreezerMeals = append(store.FreezerMeals[:i], store.FreezerMeals[i+1:]...)
+	if err := saveRemoval(householdID(r), store, freezerRemoval(removed, outcome, time.Now())); err != nil {
+		saveFailed(w, r, "/", err)
 		return
 	}
+	addFlash(w, r, flashSuccess, removedMessage(removed.Name, outcome))
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// removedMessage confirms a delete, saying what became of the item.
+func removedMessage(name, outcome string) string {
+	switch outcome {
+	case outcomeEaten:
+		return "Marked " + name + " as eaten."
+	case outcomeBinned:
+		return "Binned " + name + "; it's in the waste log."
+	}
+	return "Deleted " + name + "."
+}
+
+// pantryIndex returns the position of the item with id, or -1.
+func pantryIndex(store *Store, id int) int {
+	for i, item := range store.PantryItems {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// freezerIndex returns the position of the meal with id, or -1.
+func freezerIndex(store *Store, id int) int {
+	for i, meal := range store.FreezerMeals {
+		if meal.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -51,7 +51,7 @@ func TestIndexHandlerShowsPantryItem(t *testing.T) {
 		NextPantryID: 2,
 		NextMealID:   1,
 	}
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatal(err)
 	}
 
@@ -90,12 +90,15 @@ func TestAddPantryHandlerEmptyName(t *testing.T) {
 	w := httptest.NewRecorder()
 	addPantryHandler(w, req)
 
-	if w.Code != http.StatusSeeOther {
-		t.Errorf("expected 303, got %d", w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Name is required.") {
+		t.Errorf("expected the form to be shown again with an error")
 	}
 
 	// Nothing should have been stored.
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -123,7 +126,7 @@ func TestAddPantryHandlerAddsItem(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -155,7 +158,7 @@ func TestEditPantryHandlerUpdatesItem(t *testing.T) {
 	setupHandlerTest(t)
 
 	// Seed an item to edit.
-	if err := saveStore(&Store{
+	if err := saveStore(defaultHouseholdID, &Store{
 		PantryItems:  []PantryItem{{ID: 1, Name: "Old Name", Quantity: "1"}},
 		FreezerMeals: []FreezerMeal{},
 		NextPantryID: 2,
@@ -166,6 +169,7 @@ func TestEditPantryHandlerUpdatesItem(t *testing.T) {
 
 	form := url.Values{
 		"id":       {"1"},
+		"version":  {"1"},
 		"name":     {"New Name"},
 		"quantity": {"5"},
 		"category": {"Snacks"},
@@ -181,7 +185,7 @@ func TestEditPantryHandlerUpdatesItem(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -198,7 +202,7 @@ func TestEditPantryHandlerUpdatesItem(t *testing.T) {
 func TestEditPantryHandlerEmptyName(t *testing.T) {
 	setupHandlerTest(t)
 
-	if err := saveStore(&Store{
+	if err := saveStore(defaultHouseholdID, &Store{
 		PantryItems:  []PantryItem{{ID: 1, Name: "Keep Me"}},
 		FreezerMeals: []FreezerMeal{},
 		NextPantryID: 2,
@@ -207,18 +211,21 @@ func TestEditPantryHandlerEmptyName(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	form := url.Values{"id": {"1"}, "name": {""}}
+	form := url.Values{"id": {"1"}, "version": {"1"}, "name": {""}}
 	req := httptest.NewRequest(http.MethodPost, "/pantry/edit", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 	editPantryHandler(w, req)
 
-	if w.Code != http.StatusSeeOther {
-		t.Errorf("expected 303, got %d", w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Name is required.") {
+		t.Errorf("expected the form to be shown again with an error")
 	}
 
 	// Name must be unchanged.
-	store, _ := loadStore()
+	store, _ := loadStore(defaultHouseholdID)
 	if store.PantryItems[0].Name != "Keep Me" {
 		t.Errorf("name should not change when empty name submitted")
 	}
@@ -241,7 +248,7 @@ func TestDeletePantryHandlerRedirectsOnGet(t *testing.T) {
 func TestDeletePantryHandlerDeletesItem(t *testing.T) {
 	setupHandlerTest(t)
 
-	if err := saveStore(&Store{
+	if err := saveStore(defaultHouseholdID, &Store{
 		PantryItems:  []PantryItem{{ID: 1, Name: "Delete Me"}, {ID: 2, Name: "Keep Me"}},
 		FreezerMeals: []FreezerMeal{},
 		NextPantryID: 3,
@@ -260,7 +267,7 @@ func TestDeletePantryHandlerDeletesItem(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -304,7 +311,7 @@ func TestAddFreezerHandlerAddsMeal(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -326,11 +333,14 @@ func TestAddFreezerHandlerEmptyName(t *testing.T) {
 	w := httptest.NewRecorder()
 	addFreezerHandler(w, req)
 
-	if w.Code != http.StatusSeeOther {
-		t.Errorf("expected 303, got %d", w.Code)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Name is required.") {
+		t.Errorf("expected the form to be shown again with an error")
 	}
 
-	store, _ := loadStore()
+	store, _ := loadStore(defaultHouseholdID)
 	if len(store.FreezerMeals) != 0 {
 		t.Errorf("expected 0 meals after empty-name add, got %d", len(store.FreezerMeals))
 	}
@@ -353,7 +363,7 @@ func TestEditFreezerHandlerRedirectsOnGet(t *testing.T) {
 func TestEditFreezerHandlerUpdatesMeal(t *testing.T) {
 	setupHandlerTest(t)
 
-	if err := saveStore(&Store{
+	if err := saveStore(defaultHouseholdID, &Store{
 		PantryItems:  []PantryItem{},
 		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Old Stew", Portions: "2", DateFrozen: "2026-01-01"}},
 		NextPantryID: 1,
@@ -364,6 +374,7 @@ func TestEditFreezerHandlerUpdatesMeal(t *testing.T) {
 
 	form := url.Values{
 		"id":          {"1"},
+		"version":     {"1"},
 		"name":        {"New Stew"},
 		"portions":    {"4"},
 		"date_frozen": {"2026-02-01"},
@@ -378,7 +389,7 @@ func TestEditFreezerHandlerUpdatesMeal(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -405,7 +416,7 @@ func TestDeleteFreezerHandlerRedirectsOnGet(t *testing.T) {
 func TestDeleteFreezerHandlerDeletesMeal(t *testing.T) {
 	setupHandlerTest(t)
 
-	if err := saveStore(&Store{
+	if err := saveStore(defaultHouseholdID, &Store{
 		PantryItems:  []PantryItem{},
 		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Gone"}, {ID: 2, Name: "Stays"}},
 		NextPantryID: 1,
@@ -424,7 +435,7 @@ func TestDeleteFreezerHandlerDeletesMeal(t *testing.T) {
 		t.Errorf("expected 303, got %d", w.Code)
 	}
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatal(err)
 	}
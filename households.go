@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultHouseholdID is the household created on first run. Data from before
+// households existed belongs to it, as do command-line recipe imports unless
+// -household says otherwise.
+const defaultHouseholdID = 1
+
+const householdCookie = "household"
+
+func loadHouseholds() ([]Household, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryHouseholds(db, "SELECT id, name FROM households ORDER BY name COLLATE NOCASE")
+}
+
+// userHouseholds returns the households a user is a member of.
+func userHouseholds(userID int) ([]Household, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryHouseholds(db, `
+		SELECT h.id, h.name FROM households h
+		JOIN household_members m ON m.household_id = h.id
+		WHERE m.user_id = ?
+		ORDER BY h.name COLLATE NOCASE`, userID)
+}
+
+func queryHouseholds(db *sql.DB, query string, args ...any) ([]Household, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	households := []Household{}
+	for rows.Next() {
+		var h Household
+		if err := rows.Scan(&h.ID, &h.Name); err != nil {
+			return nil, err
+		}
+		households = append(households, h)
+	}
+	return households, rows.Err()
+}
+
+func createHousehold(name string) (*Household, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("household name is required")
+	}
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	res, err := db.Exec("INSERT INTO households (name) VALUES (?)", name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Household{ID: int(id), Name: name}, nil
+}
+
+func addHouseholdMember(householdID, userID int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("INSERT OR IGNORE INTO household_members (household_id, user_id) VALUES (?, ?)", householdID, userID)
+	return err
+}
+
+func removeHouseholdMember(householdID, userID int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM household_members WHERE household_id = ? AND user_id = ?", householdID, userID)
+	return err
+}
+
+// householdMembers maps each household ID to the IDs of its members.
+func householdMembers() (map[int][]int, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT household_id, user_id FROM household_members")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make(map[int][]int)
+	for rows.Next() {
+		var hh, user int
+		if err := rows.Scan(&hh, &user); err != nil {
+			return nil, err
+		}
+		members[hh] = append(members[hh], user)
+	}
+	return members, rows.Err()
+}
+
+func withHousehold(r *http.Request, current Household, all []Household) *http.Request {
+	ctx := context.WithValue(r.Context(), householdKey, current)
+	return r.WithContext(context.WithValue(ctx, householdsKey, all))
+}
+
+// currentHousehold returns the household a request acts on. Outside
+// requireUser, such as in handler tests, it is the default household.
+func currentHousehold(r *http.Request) Household {
+	if h, ok := r.Context().Value(householdKey).(Household); ok {
+		return h
+	}
+	return Household{ID: defaultHouseholdID, Name: "Home"}
+}
+
+// householdID is the ID every storage call in a handler is scoped by.
+func householdID(r *http.Request) int {
+	return currentHousehold(r).ID
+}
+
+// memberHouseholds returns the households the current user can switch to.
+func memberHouseholds(r *http.Request) []Household {
+	all, _ := r.Context().Value(householdsKey).([]Household)
+	return all
+}
+
+// pickHousehold chooses the household named by the household cookie if the
+// user is a member of it, and otherwise their first household.
+func pickHousehold(r *http.Request, households []Household) Household {
+	if c, err := r.Cookie(householdCookie); err == nil {
+		if id, err := strconv.Atoi(c.Value); err == nil {
+			for _, h := range households {
+				if h.ID == id {
+					return h
+				}
+			}
+		}
+	}
+	return households[0]
+}
+
+// switchHouseholdHandler remembers which household the user is working in.
+func switchHouseholdHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("household"))
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	for _, h := range memberHouseholds(r) {
+		if h.ID == id {
+			http.SetCookie(w, &http.Cookie{
+				Name:     householdCookie,
+				Value:    strconv.Itoa(id),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+	http.Error(w, "You are not a member of that household", http.StatusForbidden)
+}
+
+func addHouseholdHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	h, err := createHousehold(r.FormValue("name"))
+	if err != nil {
+		renderUsers(w, r, err.Error())
+		return
+	}
+	// The admin who creates a household can use it straight away.
+	if u := currentUser(r); u != nil {
+		if err := addHouseholdMember(h.ID, u.ID); err != nil {
+			saveFailed(w, r, "/users", err)
+			return
+		}
+	}
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
+
+// householdMemberHandler adds ("action" add) or removes a user from a
+// household.
+func householdMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	hh, err1 := strconv.Atoi(r.FormValue("household_id"))
+	user, err2 := strconv.Atoi(r.FormValue("user_id"))
+	if err1 != nil || err2 != nil {
+		http.Redirect(w, r, "/users", http.StatusSeeOther)
+		return
+	}
+	var err error
+	if r.FormValue("action") == "add" {
+		err = addHouseholdMember(hh, user)
+	} else {
+		err = removeHouseholdMember(hh, user)
+	}
+	if err != nil {
+		saveFailed(w, r, "/users", err)
+		return
+	}
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// seedTwoHouseholds gives the default household a pantry item and freezer
+// meal, and a second household "Flat 2" its own, returning the second.
+func seedTwoHouseholds(t *testing.T) *Household {
+	t.Helper()
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "4"}},
+		NextPantryID: 2,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := createHousehold("Flat 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(other.ID, &Store{
+		PantryItems:  []PantryItem{{ID: 2, Name: "Caviar"}},
+		FreezerMeals: []FreezerMeal{{ID: 2, Name: "Lobster bisque", Portions: "2"}},
+		NextPantryID: 3,
+		NextMealID:   3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return other
+}
+
+func postForm(handler http.HandlerFunc, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestStoreIsScopedByHousehold(t *testing.T) {
+	useTempDB(t)
+	other := seedTwoHouseholds(t)
+
+	home, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(home.PantryItems) != 1 || home.PantryItems[0].Name != "Rice" || len(home.FreezerMeals) != 1 {
+		t.Errorf("expected only the default household's items, got %+v", home)
+	}
+	flat, err := loadStore(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flat.PantryItems) != 1 || flat.PantryItems[0].Name != "Caviar" {
+		t.Errorf("expected only Flat 2's items, got %+v", flat.PantryItems)
+	}
+}
+
+func TestHandlersCannotTouchAnotherHouseholdsItems(t *testing.T) {
+	setupHandlerTest(t)
+	other := seedTwoHouseholds(t)
+
+	// Handler tests act on the default household, so IDs 2 belong to Flat 2.
+	postForm(editPantryHandler, "/pantry/edit", url.Values{"id": {"2"}, "name": {"Stolen"}})
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"2"}})
+	postForm(editFreezerHandler, "/freezer/edit", url.Values{"id": {"2"}, "name": {"Stolen"}})
+	postForm(deleteFreezerHandler, "/freezer/delete", url.Values{"id": {"2"}})
+
+	flat, err := loadStore(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flat.PantryItems) != 1 || flat.PantryItems[0].Name != "Caviar" ||
+		len(flat.FreezerMeals) != 1 || flat.FreezerMeals[0].Name != "Lobster bisque" {
+		t.Errorf("expected Flat 2's items to be untouched, got %+v", flat)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	indexHandler(w, req)
+	if strings.Contains(w.Body.String(), "Caviar") {
+		t.Error("expected the index not to show another household's items")
+	}
+}
+
+func TestCannotPlanOrMatchAnotherHouseholdsRecords(t *testing.T) {
+	setupHandlerTest(t)
+	other := seedTwoHouseholds(t)
+	recipe := &Recipe{Name: "Toast", Ingredients: []RecipeIngredient{{Raw: "bread", Name: "bread"}}}
+	if err := insertRecipe(other.ID, recipe); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, meal := range []string{"freezer:2", "recipe:1"} {
+		w := postForm(addPlanHandler, "/plan/add", url.Values{"date": {"2026-10-20"}, "meal": {meal}, "portions": {"1"}})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", meal, w.Code)
+		}
+	}
+
+	w := postForm(matchIngredientHandler, "/recipes/match", url.Values{"recipe_id": {"1"}, "id": {"1"}, "pantry_item_id": {"1"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 matching another household's recipe, got %d", w.Code)
+	}
+	if err := setIngredientMatch(other.ID, recipe.ID, 1, 1); err != errNotInHousehold {
+		t.Errorf("expected errNotInHousehold matching to another household's item, got %v", err)
+	}
+	if got, err := loadRecipe(defaultHouseholdID, recipe.ID); err != nil || got != nil {
+		t.Errorf("expected another household's recipe not to load, got %+v, %v", got, err)
+	}
+}
+
+func TestHouseholdCookieRequiresMembership(t *testing.T) {
+	setupHandlerTest(t)
+	other := seedTwoHouseholds(t)
+	cookie := loginAs(t, "sam", false)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	req.AddCookie(&http.Cookie{Name: householdCookie, Value: "2"})
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if body := w.Body.String(); strings.Contains(body, "Caviar") || !strings.Contains(body, "Rice") {
+		t.Error("expected a non-member's household cookie to be ignored")
+	}
+
+	form := url.Values{"household": {"2"}, csrfFormField: {sessionCSRFToken(cookie.Value)}}
+	req = httptest.NewRequest(http.MethodPost, "/household", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 switching to a household sam isn't in, got %d", w.Code)
+	}
+
+	// Once sam joins Flat 2 the cookie picks it.
+	u, err := loadUserByName("sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addHouseholdMember(other.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	req.AddCookie(&http.Cookie{Name: householdCookie, Value: "2"})
+	w = httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "Caviar") || strings.Contains(body, "Rice") {
+		t.Error("expected the member's chosen household to be shown")
+	}
+}
+
+func TestUserWithoutHouseholdIsForbidden(t *testing.T) {
+	setupHandlerTest(t)
+	u, err := createUser("sam", "correct horse", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := createSession(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a user in no household, got %d", w.Code)
+	}
+}
+
+func TestInitDBAddsHouseholdColumn(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// A pantry table from before households existed.
+	if _, err := db.Exec("CREATE TABLE pantry_items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO pantry_items (id, name) VALUES (1, 'Rice')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := initDB(db); err != nil {
+		t.Fatal(err)
+	}
+	var hh int
+	if err := db.QueryRow("SELECT household_id FROM pantry_items WHERE id = 1").Scan(&hh); err != nil {
+		t.Fatal(err)
+	}
+	if hh != defaultHouseholdID {
+		t.Errorf("expected existing rows to join the default household, got %d", hh)
+	}
+}
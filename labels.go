@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// labelLayout is a kind of label stock a freezer label can be printed on.
+type labelLayout struct {
+	Key  string
+	Name string
+	// PerSheet is how many labels fit on a sheet, or 1 for a roll.
+	PerSheet int
+}
+
+// maxLabelCopies caps how many labels are printed at once: a sheet's worth.
+const maxLabelCopies = 14
+
+// labelLayouts are the supported label stocks, the default first.
+var labelLayouts = []labelLayout{
+	{Key: "avery", Name: "Avery L7163 sheet (14 per A4)", PerSheet: 14},
+	{Key: "thermal", Name: "62 mm thermal roll", PerSheet: 1},
+}
+
+// findLabelLayout returns the layout with key, or the default if there is
+// none.
+func findLabelLayout(key string) labelLayout {
+	for _, l := range labelLayouts {
+		if l.Key == key {
+			return l
+		}
+	}
+	return labelLayouts[0]
+}
+
+// qrSVG draws text as a QR code in SVG, one unit per module with the
+// standard four-module quiet zone, so it prints sharply at any size.
+func qrSVG(text string) (template.HTML, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	const quiet = 4
+	var path strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	size := code.Size + 2*quiet
+	// The SVG is built only from numbers, so it is safe to embed as is.
+	return template.HTML(fmt.Sprintf(
+		`<svg class="qr" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges" role="img" aria-label="QR code"><rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, size, size, path.String(),
+	)), nil
+}
+
+// siteURL is the address phones should use to reach the site: the
+// configured base URL or, without one, the address the request came to.
+func siteURL(r *http.Request) string {
+	if config.BaseURL != "" {
+		return strings.TrimRight(config.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// mealPath is the path of a freezer meal's page.
+func mealPath(id int) string { return "/freezer/" + strconv.Itoa(id) }
+
+// pathID reads the "{id}" path segment, writing a 404 if it isn't a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	return id, true
+}
+
+// loadMeal loads the freezer meal in the "{id}" path segment and the
+// household's locations, writing an error response if either can't be had.
+func loadMeal(w http.ResponseWriter, r *http.Request) (*FreezerMeal, locations, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	i := freezerIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	locs, err := loadLocations(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return &store.FreezerMeals[i], locs, true
+}
+
+// mealPage is the data for a freezer meal's page, which its label's QR code
+// opens.
+type mealPage struct {
+	Meal     *FreezerMeal
+	Where    string
+	Layouts  []labelLayout
+	Portions int
+}
+
+// mealHandler shows a freezer meal with a button to use a portion of it.
+func mealHandler(w http.ResponseWriter, r *http.Request) {
+	meal, locs, ok := loadMeal(w, r)
+	if !ok {
+		return
+	}
+	render(w, r, "meal.html", mealPage{
+		Meal:     meal,
+		Where:    locs.Describe(meal.LocationID, meal.Position),
+		Layouts:  labelLayouts,
+		Portions: portionCount(meal.Portions),
+	})
+}
+
+// labelPage is the data for a printable freezer label.
+type labelPage struct {
+	Meal    *FreezerMeal
+	Where   string
+	URL     string
+	QR      template.HTML
+	Layout  labelLayout
+	Layouts []labelLayout
+	Copies  int
+	// Labels has an entry per label printed, for ranging over.
+	Labels []struct{}
+}
+
+// labelHandler renders a print-ready label for a freezer meal on the label
+// stock in "layout", "copies" of it, with its short code and a QR code of
+// its quick actions page.
+func labelHandler(w http.ResponseWriter, r *http.Request) {
+	meal, locs, ok := loadMeal(w, r)
+	if !ok {
+		return
+	}
+	layout := findLabelLayout(r.URL.Query().Get("layout"))
+	copies, err := strconv.Atoi(r.URL.Query().Get("copies"))
+	if err != nil || copies < 1 {
+		copies = 1
+	}
+	copies = min(copies, maxLabelCopies)
+	url := siteURL(r) + quickPath(meal.Code())
+	code, err := qrSVG(url)
+	if err != nil {
+		http.Error(w, "Failed to draw the QR code", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "label.html", labelPage{
+		Meal:    meal,
+		Where:   locs.Describe(meal.LocationID, meal.Position),
+		URL:     url,
+		QR:      code,
+		Layout:  layout,
+		Layouts: labelLayouts,
+		Copies:  copies,
+		Labels:  make([]struct{}, copies),
+	})
+}
+
+// usePortionHandler takes one portion out of the freezer meal in "id", as
+// when a tub is taken out after scanning its label. The last portion
+// removes the meal and logs it as eaten.
+func usePortionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	i := freezerIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	name := store.FreezerMeals[i].Name
+	left, finished, err := takePortion(hh, store, i)
+	if err != nil {
+		saveFailed(w, r, mealPath(id), err)
+		return
+	}
+	if finished {
+		addFlash(w, r, flashSuccess, "That was the last of "+name+"; it's off the freezer list.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Took a portion of "+name+"; "+left+" left.")
+	http.Redirect(w, r, mealPath(id), http.StatusSeeOther)
+}
+
+// takePortion takes a portion of the meal at i out of store and saves it.
+// The last portion removes the meal and logs it as eaten, and finished says
+// so; otherwise left is the portions remaining.
+func takePortion(householdID int, store *Store, i int) (left string, finished bool, err error) {
+	meal := store.FreezerMeals[i]
+	useFreezerPortions(store, meal.ID, 1)
+	if j := freezerIndex(store, meal.ID); j >= 0 {
+		return store.FreezerMeals[j].Portions, false, saveStore(householdID, store)
+	}
+	return "", true, saveRemoval(householdID, store, freezerRemoval(meal, outcomeEaten, time.Now()))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestQRSVG(t *testing.T) {
+	svg, err := qrSVG("http://pantry.local/freezer/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A version 3 code is 29 modules, plus the quiet zone either side.
+	if s := string(svg); !strings.HasPrefix(s, "<svg") || !strings.Contains(s, `viewBox="0 0 37 37"`) || !strings.Contains(s, "M4 4h1v1h-1z") {
+		t.Errorf("unexpected QR SVG: %.120s", s)
+	}
+}
+
+// getMeal requests a freezer meal page, or its label with query, as the mux
+// would route it.
+func getMeal(handler http.HandlerFunc, id, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/freezer/"+id+query, nil)
+	r.SetPathValue("id", id)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestLabelHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		FreezerMeals: []FreezerMeal{{ID: 3, Name: "Lentil Soup", Portions: "4", DateFrozen: "2025-02-01"}},
+		NextMealID:   4,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	orig := config.BaseURL
+	config.BaseURL = "https://pantry.example.com/"
+	t.Cleanup(func() { config.BaseURL = orig })
+
+	w := getMeal(labelHandler, "3", "?layout=thermal&copies=3")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "label-thermal") || strings.Count(body, `<svg class="qr"`) != 3 {
+		t.Fatalf("expected three thermal labels with QR codes, got %d", w.Code)
+	}
+	if !strings.Contains(body, "Frozen 2025-02-01") || !strings.Contains(body, "4 portions") {
+		t.Error("expected the date frozen and portions on the label")
+	}
+	if w := getMeal(labelHandler, "3", "?copies=99"); strings.Count(w.Body.String(), `<svg class="qr"`) != maxLabelCopies || !strings.Contains(w.Body.String(), "label-avery") {
+		t.Error("expected at most a sheet of Avery labels by default")
+	}
+	if w := getMeal(labelHandler, "9", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown meal, got %d", w.Code)
+	}
+	if w := getMeal(mealHandler, "3", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Use a portion") {
+		t.Errorf("expected the meal page to offer a portion, got %d", w.Code)
+	}
+}
+
+func TestUsePortionHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{"id": {"1"}}
+	if w := postForm(usePortionHandler, "/freezer/use", form); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/freezer/1" {
+		t.Fatalf("expected a redirect back to the meal, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if store, _ := loadStore(defaultHouseholdID); store.FreezerMeals[0].Portions != "1" {
+		t.Errorf("expected a portion left, got %+v", store.FreezerMeals)
+	}
+
+	if w := postForm(usePortionHandler, "/freezer/use", form); w.Header().Get("Location") != "/" {
+		t.Errorf("expected a redirect home once the meal is finished, got %q", w.Header().Get("Location"))
+	}
+	if store, _ := loadStore(defaultHouseholdID); len(store.FreezerMeals) != 0 {
+		t.Errorf("expected the meal gone, got %+v", store.FreezerMeals)
+	}
+	months, err := monthlyRemovals(defaultHouseholdID, "2000-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eaten := 0
+	for _, outcomes := range months {
+		if totals, ok := outcomes[outcomeEaten]; ok {
+			eaten += totals.Count
+		}
+	}
+	if eaten != 1 {
+		t.Errorf("expected the meal logged as eaten, got %+v", months)
+	}
+}
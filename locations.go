@@ -0,0 +1,545 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Location kinds.
+const (
+	locationFreezer = "freezer"
+	locationPantry  = "pantry"
+)
+
+// errLocationNotFound is returned when saving or deleting a location the
+// household doesn't have.
+var errLocationNotFound = errors.New("location not found")
+
+// maxCompartments caps how many drawers, shelves or bins a location has.
+const maxCompartments = 30
+
+// Place is where an item is kept, as posted by the location selects:
+// "<location id>:<compartment>", or "" when it isn't placed.
+func (item PantryItem) Place() string { return placeValue(item.LocationID, item.Position) }
+
+func (m FreezerMeal) Place() string { return placeValue(m.LocationID, m.Position) }
+
+func placeValue(locationID int, position string) string {
+	if locationID == 0 {
+		return ""
+	}
+	return strconv.Itoa(locationID) + ":" + position
+}
+
+// parsePlace reads a posted place. Anything unreadable is treated as not
+// placed and caught by checkPlace.
+func parsePlace(v string) (locationID int, position string) {
+	idText, position, _ := strings.Cut(v, ":")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return 0, ""
+	}
+	return id, position
+}
+
+// locations is a household's locations, with helpers for the templates.
+type locations []Location
+
+func (ls locations) find(id int) *Location {
+	for i := range ls {
+		if ls[i].ID == id {
+			return &ls[i]
+		}
+	}
+	return nil
+}
+
+// Describe names a place, e.g. "Chest freezer › Drawer 2", or "" when the
+// item isn't placed.
+func (ls locations) Describe(locationID int, position string) string {
+	l := ls.find(locationID)
+	if l == nil {
+		return ""
+	}
+	if position == "" {
+		return l.Name
+	}
+	return l.Name + " › " + position
+}
+
+// placeGroup is a location's compartments as options of a place select.
+type placeGroup struct {
+	Label   string
+	Options []placeOption
+}
+
+type placeOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// Places lists every compartment as select options, marking selected.
+func (ls locations) Places(selected string) []placeGroup {
+	groups := make([]placeGroup, 0, len(ls))
+	for _, l := range ls {
+		g := placeGroup{Label: l.Name}
+		for _, c := range l.Compartments {
+			v := placeValue(l.ID, c)
+			g.Options = append(g.Options, placeOption{Value: v, Label: c, Selected: v == selected})
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// checkPlace records an error against field unless locationID is zero or one
+// of locs and position is blank or one of its compartments.
+func (e fieldErrors) checkPlace(field string, locs locations, locationID int, position string) {
+	if locationID == 0 && position == "" {
+		return
+	}
+	l := locs.find(locationID)
+	ok := l != nil
+	if ok && position != "" {
+		ok = false
+		for _, c := range l.Compartments {
+			ok = ok || c == position
+		}
+	}
+	e.check(ok, field, "Pick a place from the list.")
+}
+
+// validatePlace checks an item's place against a household's locations,
+// recording any error against field.
+func validatePlace(householdID int, errs fieldErrors, field string, locationID int, position string) error {
+	if locationID == 0 && position == "" {
+		return nil
+	}
+	locs, err := loadLocations(householdID)
+	if err != nil {
+		return err
+	}
+	errs.checkPlace(field, locs, locationID, position)
+	return nil
+}
+
+// validateLocation tidies a location's fields and reports what is wrong with
+// them, if anything.
+func validateLocation(l *Location) fieldErrors {
+	l.Name = strings.TrimSpace(l.Name)
+	errs := fieldErrors{}
+	errs.check(l.Name != "", "name", "Name is required.")
+	errs.checkLength("name", "Name", l.Name, maxNameLength)
+	errs.check(l.Kind == locationFreezer || l.Kind == locationPantry, "kind", "Pick freezer or pantry.")
+	seen := make(map[string]bool)
+	compartments := l.Compartments[:0]
+	for _, c := range l.Compartments {
+		c = strings.Join(strings.Fields(c), " ")
+		if c == "" || seen[strings.ToLower(c)] {
+			continue
+		}
+		seen[strings.ToLower(c)] = true
+		errs.check(utf8.RuneCountInString(c) <= maxTagLength && !strings.Contains(c, ":"), "compartments", "Each drawer, shelf or bin needs a name of at most 40 characters, without a colon.")
+		compartments = append(compartments, c)
+	}
+	l.Compartments = compartments
+	errs.check(len(l.Compartments) > 0, "compartments", "List at least one drawer, shelf or bin.")
+	errs.check(len(l.Compartments) <= maxCompartments, "compartments", "Use at most 30 drawers, shelves or bins.")
+	return errs
+}
+
+// loadLocations returns a household's locations, freezers first.
+func loadLocations(householdID int) (locations, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, name, kind FROM locations WHERE household_id = ?
+		ORDER BY kind = 'freezer' DESC, name COLLATE NOCASE`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	locs := locations{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.ID, &l.Name, &l.Kind); err != nil {
+			return nil, err
+		}
+		index[l.ID] = len(locs)
+		locs = append(locs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows2, err := db.Query(`
+		SELECT location_id, name FROM location_compartments
+		WHERE location_id IN (SELECT id FROM locations WHERE household_id = ?)
+		ORDER BY location_id, position`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var locationID int
+		var name string
+		if err := rows2.Scan(&locationID, &name); err != nil {
+			return nil, err
+		}
+		if i, ok := index[locationID]; ok {
+			locs[i].Compartments = append(locs[i].Compartments, name)
+		}
+	}
+	return locs, rows2.Err()
+}
+
+// saveLocation adds a location, or replaces the one with l.ID. Items in a
+// compartment that no longer exists stay in the location, unplaced within
+// it.
+func saveLocation(householdID int, l *Location) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if l.ID == 0 {
+		res, err := tx.Exec("INSERT INTO locations (household_id, name, kind) VALUES (?, ?, ?)", householdID, l.Name, l.Kind)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		l.ID = int(id)
+	} else {
+		res, err := tx.Exec("UPDATE locations SET name = ?, kind = ? WHERE id = ? AND household_id = ?", l.Name, l.Kind, l.ID, householdID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errLocationNotFound
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM location_compartments WHERE location_id = ?", l.ID); err != nil {
+		return err
+	}
+	for i, c := range l.Compartments {
+		if _, err := tx.Exec("INSERT INTO location_compartments (location_id, position, name) VALUES (?, ?, ?)", l.ID, i, c); err != nil {
+			return err
+		}
+	}
+	// Whatever was in a compartment that has gone stays in the location.
+	// The items go through writeStore so their versions go up and open
+	// pages hear of the change.
+	store, err := readStore(tx, householdID)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool, len(l.Compartments))
+	for _, c := range l.Compartments {
+		kept[c] = true
+	}
+	for i := range store.PantryItems {
+		if item := &store.PantryItems[i]; item.LocationID == l.ID && !kept[item.Position] {
+			item.Position = ""
+		}
+	}
+	for i := range store.FreezerMeals {
+		if meal := &store.FreezerMeals[i]; meal.LocationID == l.ID && !kept[meal.Position] {
+			meal.Position = ""
+		}
+	}
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
+		return err
+	}
+	return commitAndPublish(tx, events)
+}
+
+// deleteLocation removes a location. Whatever was in it is left unplaced.
+func deleteLocation(householdID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM locations WHERE id = ? AND household_id = ?", id, householdID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errLocationNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM location_compartments WHERE location_id = ?", id); err != nil {
+		return err
+	}
+	store, err := readStore(tx, householdID)
+	if err != nil {
+		return err
+	}
+	for i := range store.PantryItems {
+		if item := &store.PantryItems[i]; item.LocationID == id {
+			item.LocationID, item.Position = 0, ""
+		}
+	}
+	for i := range store.FreezerMeals {
+		if meal := &store.FreezerMeals[i]; meal.LocationID == id {
+			meal.LocationID, meal.Position = 0, ""
+		}
+	}
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
+		return err
+	}
+	return commitAndPublish(tx, events)
+}
+
+// compartmentView is what is kept in one drawer, shelf or bin. Found marks
+// it as holding something a "where is it" search matched.
+type compartmentView struct {
+	Name  string
+	Items []PantryItem
+	Meals []FreezerMeal
+	Found bool
+}
+
+// markFound sets Found on every compartment holding something query matches.
+func (c *compartmentView) markFound(query string) {
+	for _, item := range c.Items {
+		c.Found = c.Found || matchesWhere(query, item.Name)
+	}
+	for _, meal := range c.Meals {
+		c.Found = c.Found || matchesWhere(query, meal.Name)
+	}
+}
+
+// Empty reports whether nothing is kept in the compartment.
+func (c compartmentView) Empty() bool { return len(c.Items) == 0 && len(c.Meals) == 0 }
+
+// locationMap is a location laid out compartment by compartment. Loose holds
+// what is in the location without a compartment.
+type locationMap struct {
+	Location
+	Compartments []compartmentView
+	Loose        compartmentView
+}
+
+// CompartmentList is the location's compartments one per line, as edited.
+func (l Location) CompartmentList() string { return strings.Join(l.Compartments, "\n") }
+
+// whereAnswer says where something matching a search is kept.
+type whereAnswer struct {
+	Name     string
+	Amount   string
+	Freezer  bool
+	Where    string
+	ItemPath string
+}
+
+// locationsPage is the data for the locations page: a map of each location,
+// the answers to a "where is it" search and any location form that failed
+// validation.
+type locationsPage struct {
+	Maps     []locationMap
+	Unplaced compartmentView
+	Query    string
+	Found    []whereAnswer
+	Form     formState
+}
+
+// buildLocationMaps sorts a store's items into their locations and
+// compartments.
+func buildLocationMaps(locs locations, store *Store) ([]locationMap, compartmentView) {
+	maps := make([]locationMap, len(locs))
+	slot := make(map[string]*compartmentView)
+	loose := make(map[int]*compartmentView)
+	for i, l := range locs {
+		maps[i] = locationMap{Location: l, Loose: compartmentView{Name: "Not in a " + compartmentWord(l.Kind)}}
+		maps[i].Compartments = make([]compartmentView, len(l.Compartments))
+		for j, c := range l.Compartments {
+			maps[i].Compartments[j].Name = c
+			slot[placeValue(l.ID, c)] = &maps[i].Compartments[j]
+		}
+		loose[l.ID] = &maps[i].Loose
+	}
+	unplaced := compartmentView{Name: "Not placed"}
+	find := func(locationID int, position string) *compartmentView {
+		if c, ok := slot[placeValue(locationID, position)]; ok {
+			return c
+		}
+		if c, ok := loose[locationID]; ok {
+			return c
+		}
+		return &unplaced
+	}
+	for _, item := range store.PantryItems {
+		c := find(item.LocationID, item.Position)
+		c.Items = append(c.Items, item)
+	}
+	for _, meal := range store.FreezerMeals {
+		c := find(meal.LocationID, meal.Position)
+		c.Meals = append(c.Meals, meal)
+	}
+	return maps, unplaced
+}
+
+// compartmentWord is what a location's compartments are usually called.
+func compartmentWord(kind string) string {
+	if kind == locationFreezer {
+		return "drawer"
+	}
+	return "shelf"
+}
+
+// matchesWhere reports whether name is what a "where is it" search for query
+// is after: it contains the words searched for, or is close enough to them.
+func matchesWhere(query, name string) bool {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(name), strings.ToLower(query)) || nameSimilarity(query, name) >= matchThreshold
+}
+
+// whereIs finds the items and meals whose names match query and says where
+// each is kept, meals first.
+func whereIs(query string, locs locations, store *Store) []whereAnswer {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	where := func(locationID int, position string) string {
+		if w := locs.Describe(locationID, position); w != "" {
+			return w
+		}
+		return "Not placed yet"
+	}
+	var found []whereAnswer
+	for _, m := range store.FreezerMeals {
+		if matchesWhere(query, m.Name) {
+			found = append(found, whereAnswer{Name: m.Name, Amount: m.Portions, Freezer: true, Where: where(m.LocationID, m.Position)})
+		}
+	}
+	for _, item := range store.PantryItems {
+		if matchesWhere(query, item.Name) {
+			found = append(found, whereAnswer{Name: item.Name, Amount: item.Quantity, Where: where(item.LocationID, item.Position), ItemPath: "/pantry/item?id=" + strconv.Itoa(item.ID)})
+		}
+	}
+	return found
+}
+
+func locationsHandler(w http.ResponseWriter, r *http.Request) {
+	renderLocations(w, r, http.StatusOK, formState{})
+}
+
+// renderLocations shows the locations page, answering the "q" search if
+// there is one.
+func renderLocations(w http.ResponseWriter, r *http.Request, status int, form formState) {
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	locs, err := loadLocations(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	sortPantryItems(store.PantryItems)
+	sortFreezerMeals(store.FreezerMeals)
+	page := locationsPage{Query: r.URL.Query().Get("q"), Form: form}
+	page.Maps, page.Unplaced = buildLocationMaps(locs, store)
+	page.Found = whereIs(page.Query, locs, store)
+	for i := range page.Maps {
+		for j := range page.Maps[i].Compartments {
+			page.Maps[i].Compartments[j].markFound(page.Query)
+		}
+		page.Maps[i].Loose.markFound(page.Query)
+	}
+	renderStatus(w, r, status, "locations.html", page)
+}
+
+// saveLocationHandler adds a location, or updates the one in "id". Its
+// compartments are posted one per line in "compartments".
+func saveLocationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/locations", http.StatusSeeOther)
+		return
+	}
+	l := Location{
+		Name:         r.FormValue("name"),
+		Kind:         r.FormValue("kind"),
+		Compartments: strings.Split(r.FormValue("compartments"), "\n"),
+	}
+	modal := "add-location"
+	if v := r.FormValue("id"); v != "" {
+		id, ok := formID(w, r)
+		if !ok {
+			return
+		}
+		l.ID = id
+		modal = "edit-location"
+	}
+	if errs := validateLocation(&l); len(errs) > 0 {
+		renderLocations(w, r, http.StatusUnprocessableEntity, formState{Modal: modal, Values: r.PostForm, Errors: errs})
+		return
+	}
+	if err := saveLocation(householdID(r), &l); errors.Is(err, errLocationNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		saveFailed(w, r, "/locations", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Saved "+l.Name+".")
+	http.Redirect(w, r, "/locations", http.StatusSeeOther)
+}
+
+func deleteLocationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/locations", http.StatusSeeOther)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	if err := deleteLocation(householdID(r), id); errors.Is(err, errLocationNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		saveFailed(w, r, "/locations", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Deleted the location; what was in it is no longer placed.")
+	http.Redirect(w, r, "/locations", http.StatusSeeOther)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateLocation(t *testing.T) {
+	l := Location{Name: " Chest freezer ", Kind: locationFreezer, Compartments: []string{"Top ", "", "top", "Bottom  basket"}}
+	if errs := validateLocation(&l); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if l.Name != "Chest freezer" || strings.Join(l.Compartments, "|") != "Top|Bottom basket" {
+		t.Errorf("expected tidied fields without repeats, got %+v", l)
+	}
+
+	bad := Location{Kind: "garage", Compartments: []string{"A:1"}}
+	errs := validateLocation(&bad)
+	for _, field := range []string{"name", "kind", "compartments"} {
+		if errs[field] == "" {
+			t.Errorf("expected an error for %s, got %v", field, errs)
+		}
+	}
+}
+
+func TestCheckPlace(t *testing.T) {
+	locs := locations{{ID: 1, Name: "Freezer", Compartments: []string{"Drawer 1", "Drawer 2"}}}
+	tests := []struct {
+		place string
+		ok    bool
+	}{
+		{"", true},
+		{"1:Drawer 2", true},
+		{"1:", true},
+		{"1:Drawer 9", false},
+		{"2:Drawer 1", false},
+		{"rubbish", true},
+	}
+	for _, tt := range tests {
+		errs := fieldErrors{}
+		id, pos := parsePlace(tt.place)
+		errs.checkPlace("place", locs, id, pos)
+		if (len(errs) == 0) != tt.ok {
+			t.Errorf("%q: expected ok=%v, got %v", tt.place, tt.ok, errs)
+		}
+	}
+	if got := locs.Describe(1, "Drawer 2"); got != "Freezer › Drawer 2" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+func TestSaveLocationClearsRemovedCompartments(t *testing.T) {
+	useTempDB(t)
+	useEventHub(t)
+	l := Location{Name: "Chest freezer", Kind: locationFreezer, Compartments: []string{"Top", "Bottom"}}
+	if err := saveLocation(defaultHouseholdID, &l); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, &Store{
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", LocationID: l.ID, Position: "Bottom"}},
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	events, stop := itemEvents.subscribe(defaultHouseholdID)
+	defer stop()
+
+	l.Compartments = []string{"Top"}
+	if err := saveLocation(defaultHouseholdID, &l); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if m := store.FreezerMeals[0]; m.LocationID != l.ID || m.Position != "" || m.Version != 2 {
+		t.Errorf("expected the chilli left in the freezer without a drawer at version 2, got %+v", m)
+	}
+	// Open pages and offline copies hear that the meal moved.
+	if got := describeEvents(drain(events)); got != "updated freezer 1 v2" {
+		t.Errorf("expected an update for the chilli, got %q", got)
+	}
+	if err := saveLocation(2, &l); err != errLocationNotFound {
+		t.Errorf("expected another household's location not to be found, got %v", err)
+	}
+
+	if err := deleteLocation(defaultHouseholdID, l.ID); err != nil {
+		t.Fatal(err)
+	}
+	store, _ = loadStore(defaultHouseholdID)
+	if m := store.FreezerMeals[0]; m.LocationID != 0 || m.Version != 3 {
+		t.Errorf("expected the chilli unplaced at version 3 once the freezer is gone, got %+v", m)
+	}
+	if got := describeEvents(drain(events)); got != "updated freezer 1 v3" {
+		t.Errorf("expected an update for the chilli, got %q", got)
+	}
+	if locs, _ := loadLocations(defaultHouseholdID); len(locs) != 0 {
+		t.Errorf("expected no locations left, got %+v", locs)
+	}
+}
+
+func TestDeleteOtherHouseholdsLocation(t *testing.T) {
+	setupHandlerTest(t)
+	cabin, err := createHousehold("Cabin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Location{Name: "Larder", Kind: locationPantry}
+	if err := saveLocation(cabin.ID, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleteLocation(defaultHouseholdID, l.ID); !errors.Is(err, errLocationNotFound) {
+		t.Errorf("expected another household's location not to be found, got %v", err)
+	}
+	if w := postForm(deleteLocationHandler, "/locations/delete", url.Values{"id": {strconv.Itoa(l.ID)}}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting another household's location, got %d", w.Code)
+	}
+	if locs, _ := loadLocations(cabin.ID); len(locs) != 1 {
+		t.Errorf("expected the cabin's larder kept, got %+v", locs)
+	}
+}
+
+func TestLocationHandlers(t *testing.T) {
+	setupHandlerTest(t)
+	if w := postForm(saveLocationHandler, "/locations/save", url.Values{"name": {"Freezer"}, "kind": {"freezer"}}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 without compartments, got %d", w.Code)
+	}
+	form := url.Values{"name": {"Freezer"}, "kind": {"freezer"}, "compartments": {"Drawer 1\r\nDrawer 2\r\n"}}
+	if w := postForm(saveLocationHandler, "/locations/save", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	locs, err := loadLocations(defaultHouseholdID)
+	if err != nil || len(locs) != 1 || len(locs[0].Compartments) != 2 {
+		t.Fatalf("expected a freezer with two drawers, got %+v, %v", locs, err)
+	}
+	place := locs[0].Compartments[1]
+
+	w := postForm(addFreezerHandler, "/freezer/add", url.Values{"name": {"Chilli"}, "place": {"9:Drawer 1"}})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Pick a place from the list") {
+		t.Errorf("expected 422 for an unknown place, got %d", w.Code)
+	}
+	if w := postForm(addFreezerHandler, "/freezer/add", url.Values{"name": {"Chilli con carne"}, "portions": {"2"}, "place": {placeValue(locs[0].ID, place)}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/locations?q=chili", nil)
+	w = httptest.NewRecorder()
+	locationsHandler(w, r)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Freezer › Drawer 2") || !strings.Contains(body, "compartment-found") {
+		t.Errorf("expected the chilli found in drawer 2, got %d", w.Code)
+	}
+}
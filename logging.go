@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// newLogger returns a logger writing to w in the configured format, dropping
+// anything below the configured level. The config has been validated, so an
+// unknown level can't happen.
+func newLogger(w io.Writer, c LogConfig) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// fatal logs an error that stops the server and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestLog collects what the request log line needs to know from handlers
+// further down the chain, such as who the user turned out to be.
+type requestLog struct {
+	user string
+}
+
+// noteRequestUser records the acting user for the request log line.
+func noteRequestUser(r *http.Request, u *User) {
+	if l, ok := r.Context().Value(requestLogKey).(*requestLog); ok && u != nil {
+		l.user = u.Username
+	}
+}
+
+// observeRequests logs every request and records it in the request metrics,
+// labelled by the route pattern it matched in mux rather than its path, so
+// the number of series stays bounded.
+func observeRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		l := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey, l))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		observeRequest(r.Method, route, rec.status, elapsed)
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case route == "/healthz" || route == "/metrics" || route == "/static/" || route == "/events":
+			// Probes, scrapes, assets and event streams would drown out
+			// everything else.
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", elapsed),
+			slog.String("user", l.user),
+		)
+	})
+}
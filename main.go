@@ -1,28 +1,153 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
+	importRecipes := flag.Bool("import-recipes", false, "import the recipe files given as arguments (JSON-LD or Markdown) and exit")
+	household := flag.Int("household", defaultHouseholdID, "household ID that -import-recipes imports into")
+	adminUser := flag.String("admin-user", os.Getenv("CUPBOARD_ADMIN_USER"), "username of the admin account created on first run")
+	adminPassword := flag.String("admin-password", os.Getenv("CUPBOARD_ADMIN_PASSWORD"), "password of the admin account created on first run")
+	configFlags := newConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := configFlags.load(os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	config = cfg
+	dbFile = config.Database
+	slog.SetDefault(newLogger(os.Stderr, config.Log))
+
+	if *importRecipes {
+		if err := runRecipeImport(*household, flag.Args()); err != nil {
+			fatal("recipe import failed", "err", err)
+		}
+		return
+	}
+
+	if err := ensureAdmin(*adminUser, *adminPassword); err != nil {
+		fatal("failed to create the admin account", "err", err)
+	}
+
 	initTemplates()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go runNotifier(ctx, config.Notifications)
+	slog.Info("starting server", "listen", config.Listen, "database", config.Database, "dev", config.Dev)
+	if err := runServer(ctx, newServer(config.Listen, routes())); err != nil {
+		fatal("server failed", "err", err)
+	}
+	slog.Info("stopped")
+}
+
+// routes registers every handler. Everything except the login page, the
+// health check, static files and the service worker requires a logged-in
+// user, and every request is logged and counted in the metrics. Admin pages
+// that change accounts, households or merge items need a browser session, so
+// an admin's API token can't be used to create accounts.
+func routes() http.Handler {
 	mux := http.NewServeMux()
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.HandleFunc("/static/", staticHandler)
+	mux.HandleFunc("/sw.js", serviceWorkerHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/metrics", requireAdmin(metricsHandler))
+	mux.HandleFunc("/login", loginHandler)
+	mux.HandleFunc("/logout", logoutHandler)
+	mux.HandleFunc("/users", requireSession(requireAdmin(usersHandler)))
+	mux.HandleFunc("/users/add", requireSession(requireAdmin(addUserHandler)))
+	mux.HandleFunc("/users/delete", requireSession(requireAdmin(deleteUserHandler)))
+	mux.HandleFunc("/households/add", requireSession(requireAdmin(addHouseholdHandler)))
+	mux.HandleFunc("/households/members", requireSession(requireAdmin(householdMemberHandler)))
+	mux.HandleFunc("/household", switchHouseholdHandler)
 	mux.HandleFunc("/", indexHandler)
+	mux.HandleFunc("/events", eventsHandler)
 	mux.HandleFunc("/pantry/add", addPantryHandler)
 	mux.HandleFunc("/pantry/edit", editPantryHandler)
 	mux.HandleFunc("/pantry/delete", deletePantryHandler)
+	mux.HandleFunc("/pantry/item", itemHandler)
+	mux.HandleFunc("/pantry/purchases/add", addPurchaseHandler)
+	mux.HandleFunc("/pantry/purchases/delete", deletePurchaseHandler)
+	mux.HandleFunc("/pantry/batches/add", addBatchHandler)
+	mux.HandleFunc("/pantry/batches/delete", deleteBatchHandler)
+	mux.HandleFunc("/pantry/duplicates", requireAdmin(duplicatesHandler))
+	mux.HandleFunc("/pantry/duplicates/merge", requireSession(requireAdmin(mergeDuplicatesHandler)))
+	mux.HandleFunc("/pantry/receipt", receiptHandler)
+	mux.HandleFunc("/pantry/receipt/review", reviewReceiptHandler)
+	mux.HandleFunc("/pantry/receipt/add", addReceiptHandler)
 	mux.HandleFunc("/freezer/add", addFreezerHandler)
+	mux.HandleFunc("/q/{code}", quickHandler)
+	mux.HandleFunc("/q/{code}/use", quickUseHandler)
+	mux.HandleFunc("/q/{code}/empty", quickEmptyHandler)
+	mux.HandleFunc("/q/{code}/move", quickMoveHandler)
+	mux.HandleFunc("/locations", locationsHandler)
+	mux.HandleFunc("/locations/save", saveLocationHandler)
+	mux.HandleFunc("/locations/delete", deleteLocationHandler)
 	mux.HandleFunc("/freezer/edit", editFreezerHandler)
 	mux.HandleFunc("/freezer/delete", deleteFreezerHandler)
+	mux.HandleFunc("/freezer/use", usePortionHandler)
+	mux.HandleFunc("/freezer/{id}", mealHandler)
+	mux.HandleFunc("/freezer/{id}/label", labelHandler)
+	mux.HandleFunc("/batch-cook", batchCookHandler)
+	mux.HandleFunc("/batch-cook/cook", cookBatchHandler)
+	mux.HandleFunc("/recipes", recipesHandler)
+	mux.HandleFunc("/recipes/view", recipeHandler)
+	mux.HandleFunc("/recipes/import", importRecipeHandler)
+	mux.HandleFunc("/recipes/match", matchIngredientHandler)
+	mux.HandleFunc("/recipes/delete", deleteRecipeHandler)
+	mux.HandleFunc("/plan", planHandler)
+	mux.HandleFunc("/plan/add", addPlanHandler)
+	mux.HandleFunc("/plan/delete", deletePlanHandler)
+	mux.HandleFunc("/plan/cooked", cookedPlanHandler)
+	mux.HandleFunc("/plan/shopping", planShoppingHandler)
+	mux.HandleFunc("/shopping", shoppingHandler)
+	mux.HandleFunc("/shopping/add", addShoppingHandler)
+	mux.HandleFunc("/shopping/toggle", toggleShoppingHandler)
+	mux.HandleFunc("/shopping/delete", deleteShoppingHandler)
+	mux.HandleFunc("/shopping/clear", clearShoppingHandler)
+	mux.HandleFunc("/people", peopleHandler)
+	mux.HandleFunc("/people/add", addPersonHandler)
+	mux.HandleFunc("/people/delete", deletePersonHandler)
+	mux.HandleFunc("/stats", statsHandler)
+	mux.HandleFunc("/settings", requireSession(settingsHandler))
+	mux.HandleFunc("/settings/tokens/add", requireSession(addTokenHandler))
+	mux.HandleFunc("/settings/tokens/revoke", requireSession(revokeTokenHandler))
+	mux.HandleFunc("/api/pantry", apiPantryHandler)
+	mux.HandleFunc("/api/freezer", apiFreezerHandler)
+	mux.HandleFunc("/api/pantry/{id}", apiPantryItemHandler)
+	mux.HandleFunc("/api/freezer/{id}", apiFreezerItemHandler)
+	mux.HandleFunc("/api/shopping", apiShoppingHandler)
+	mux.HandleFunc("/api/sync", apiSyncHandler)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	return observeRequests(mux, requireUser(csrfProtect(mux)))
+}
+
+// runRecipeImport imports recipe files from the command line and reports the
+// ingredients that need reviewing.
+func runRecipeImport(householdID int, paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("-import-recipes: no files given")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		recipe, unmatched, err := importRecipe(householdID, path, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Print(describeImport(recipe, unmatched))
 	}
-	log.Printf("Starting server at http://localhost:%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	return nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// matchThreshold is the minimum similarity for two names to be considered
+// the same product.
+const matchThreshold = 0.75
+
+// nameStopWords are descriptive words that don't change which product a name
+// refers to ("large onions" is still onions).
+var nameStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "and": true, "or": true,
+	"fresh": true, "large": true, "small": true, "medium": true, "big": true,
+	"chopped": true, "diced": true, "sliced": true, "minced": true, "grated": true,
+	"finely": true, "roughly": true, "thinly": true, "peeled": true, "crushed": true,
+	"some": true, "few": true, "optional": true,
+}
+
+// normalizeName reduces a product name to a canonical form for comparison:
+// lower case, punctuation removed, stop words dropped and simple plurals
+// singularised ("Tinned Tomatoes" → "tinned tomato").
+func normalizeName(name string) string {
+	return strings.Join(nameTokens(name), " ")
+}
+
+func nameTokens(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if nameStopWords[w] {
+			continue
+		}
+		tokens = append(tokens, singular(w))
+	}
+	return tokens
+}
+
+// singular strips common English plural endings.
+func singular(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 4 && (strings.HasSuffix(w, "oes") || strings.HasSuffix(w, "ches") ||
+		strings.HasSuffix(w, "shes") || strings.HasSuffix(w, "xes")):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// nameSimilarity scores how alike two product names are, from 0 (nothing in
+// common) to 1 (same normalised name). It combines whole-string edit distance
+// with word overlap, and scores a name whose words are all contained in the
+// other ("onion" vs "red onion") as a likely match.
+func nameSimilarity(a, b string) float64 {
+	ta, tb := nameTokens(a), nameTokens(b)
+	na, nb := strings.Join(ta, " "), strings.Join(tb, " ")
+	if na == "" || nb == "" {
+		return 0
+	}
+	if na == nb {
+		return 1
+	}
+	score := stringSimilarity(na, nb)
+
+	matched := 0
+	for _, x := range ta {
+		for _, y := range tb {
+			if stringSimilarity(x, y) >= 0.8 {
+				matched++
+				break
+			}
+		}
+	}
+	dice := 2 * float64(matched) / float64(len(ta)+len(tb))
+	if dice > score {
+		score = dice
+	}
+	if matched >= min(len(ta), len(tb)) {
+		if contained := 0.75 + 0.25*dice; contained > score {
+			score = contained
+		}
+	}
+	return score
+}
+
+// stringSimilarity is 1 minus the normalised Levenshtein distance.
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// bestPantryMatch returns the pantry item whose name is most similar to name,
+// and its score. ok is false when nothing reaches matchThreshold.
+func bestPantryMatch(name string, items []PantryItem) (item PantryItem, score float64, ok bool) {
+	for _, candidate := range items {
+		if s := nameSimilarity(name, candidate.Name); s > score {
+			item, score = candidate, s
+		}
+	}
+	return item, score, score >= matchThreshold
+}
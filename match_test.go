@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	cases := map[string]string{
+		"Tinned Tomatoes":        "tinned tomato",
+		"tinned tomatoes":        "tinned tomato",
+		"  Large  ONIONS, diced": "onion",
+		"Cherries":               "cherry",
+		"Chickpeas (dried)":      "chickpea dried",
+	}
+	for in, want := range cases {
+		if got := normalizeName(in); got != want {
+			t.Errorf("normalizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if s := nameSimilarity("Tinned Tomatoes", "tinned tomato"); s != 1 {
+		t.Errorf("identical normalised names should score 1, got %v", s)
+	}
+	if s := nameSimilarity("onions", "Red Onion"); s < matchThreshold {
+		t.Errorf("contained name should match, got %v", s)
+	}
+	if s := nameSimilarity("chickpeas", "chikpeas"); s < matchThreshold {
+		t.Errorf("typo should match, got %v", s)
+	}
+	if s := nameSimilarity("flour", "coconut milk"); s >= matchThreshold {
+		t.Errorf("unrelated names should not match, got %v", s)
+	}
+	if s := nameSimilarity("", "rice"); s != 0 {
+		t.Errorf("empty name should score 0, got %v", s)
+	}
+}
+
+func TestBestPantryMatch(t *testing.T) {
+	items := []PantryItem{
+		{ID: 1, Name: "Basmati Rice"},
+		{ID: 2, Name: "Chopped Tomatoes"},
+		{ID: 3, Name: "Plain Flour"},
+	}
+	item, _, ok := bestPantryMatch("tomatoes", items)
+	if !ok || item.ID != 2 {
+		t.Errorf("expected tomatoes to match item 2, got %+v ok=%v", item, ok)
+	}
+	if _, _, ok := bestPantryMatch("saffron", items); ok {
+		t.Error("saffron should not match anything")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cupboard_http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cupboard_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cupboard_db_operation_duration_seconds",
+		Help:    "Database operation latency by operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cupboard_db_operation_errors_total",
+		Help: "Failed database operations by operation.",
+	}, []string{"operation"})
+)
+
+// newMetricsRegistry returns a registry of everything /metrics exposes. It is
+// separate from the global registry so only our metrics and the runtime's are
+// published.
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, dbDuration, dbErrors,
+		inventoryCollector{},
+	)
+	return reg
+}
+
+// promHandler is made on first use, once every metric has been declared.
+var promHandler = sync.OnceValue(func() http.Handler {
+	return promhttp.HandlerFor(newMetricsRegistry(), promhttp.HandlerOpts{})
+})
+
+// metricsHandler serves the metrics in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	promHandler().ServeHTTP(w, r)
+}
+
+func observeRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// observeDB times a store operation and logs it. Call it deferred with the
+// operation's start time and a pointer to its error result.
+func observeDB(op string, start time.Time, errp *error) {
+	elapsed := time.Since(start)
+	dbDuration.WithLabelValues(op).Observe(elapsed.Seconds())
+	if err := *errp; err != nil {
+		dbErrors.WithLabelValues(op).Inc()
+		slog.Error("store operation failed", "op", op, "duration", elapsed, "err", err)
+		return
+	}
+	slog.Debug("store operation", "op", op, "duration", elapsed)
+}
+
+// The inventory gauges are labelled by household ID, as names needn't be
+// unique and two series with the same labels would fail the whole scrape.
+// The name is kept alongside for reading.
+var (
+	pantryItemsDesc = prometheus.NewDesc("cupboard_pantry_items",
+		"Pantry items by household and category.", []string{"household_id", "household", "category"}, nil)
+	expiredItemsDesc = prometheus.NewDesc("cupboard_pantry_items_expired",
+		"Pantry items past their expiry date by household.", []string{"household_id", "household"}, nil)
+	expiringItemsDesc = prometheus.NewDesc("cupboard_pantry_items_expiring_soon",
+		"Pantry items within the expiry warning window by household.", []string{"household_id", "household"}, nil)
+	freezerMealsDesc = prometheus.NewDesc("cupboard_freezer_meals",
+		"Freezer meals by household and age bucket (fresh, medium, old).", []string{"household_id", "household", "age"}, nil)
+)
+
+// inventoryCollector reports the inventory gauges, read from the database at
+// scrape time so they are never stale.
+type inventoryCollector struct{}
+
+func (inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pantryItemsDesc
+	ch <- expiredItemsDesc
+	ch <- expiringItemsDesc
+	ch <- freezerMealsDesc
+}
+
+func (inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	households, err := loadHouseholds()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(pantryItemsDesc, err)
+		return
+	}
+	now := time.Now()
+	for _, h := range households {
+		store, err := loadStore(h.ID)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(pantryItemsDesc, err)
+			return
+		}
+		id := strconv.Itoa(h.ID)
+		categories := make(map[string]int)
+		expired, expiring := 0, 0
+		for _, item := range store.PantryItems {
+			categories[item.Category]++
+			if isExpired(item.Expiry, now) {
+				expired++
+			} else if isExpiringSoon(item.Expiry, now) {
+				expiring++
+			}
+		}
+		for category, n := range categories {
+			ch <- prometheus.MustNewConstMetric(pantryItemsDesc, prometheus.GaugeValue, float64(n), id, h.Name, category)
+		}
+		ch <- prometheus.MustNewConstMetric(expiredItemsDesc, prometheus.GaugeValue, float64(expired), id, h.Name)
+		ch <- prometheus.MustNewConstMetric(expiringItemsDesc, prometheus.GaugeValue, float64(expiring), id, h.Name)
+
+		ages := map[string]int{"fresh": 0, "medium": 0, "old": 0}
+		for _, meal := range store.FreezerMeals {
+			ages[freezerAge(meal.DateFrozen, now)]++
+		}
+		for age, n := range ages {
+			ch <- prometheus.MustNewConstMetric(freezerMealsDesc, prometheus.GaugeValue, float64(n), id, h.Name, age)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	setupHandlerTest(t)
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Beans", Category: "Canned Goods", Expiry: "2000-01-01"},
+			{ID: 2, Name: "Soup", Category: "Canned Goods", Expiry: time.Now().AddDate(0, 0, 1).Format("2006-01-02")},
+			{ID: 3, Name: "Rice", Category: "Dry Goods"},
+		},
+		FreezerMeals: []FreezerMeal{
+			{ID: 1, Name: "Chilli", Portions: "2", DateFrozen: time.Now().AddDate(0, 0, -200).Format("2006-01-02")},
+		},
+		NextPantryID: 4,
+		NextMealID:   2,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+
+	// Admins only, so household names and counts aren't public.
+	cookie := loginAs(t, "sam", false)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+
+	cookie = loginAs(t, "admin", true)
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`cupboard_http_requests_total{method="GET",route="/metrics",status="403"}`,
+		`cupboard_http_request_duration_seconds_bucket{method="GET",route="/metrics"`,
+		`cupboard_db_operation_duration_seconds_count{operation="save_store"}`,
+		`cupboard_pantry_items{category="Canned Goods",household="Home",household_id="1"} 2`,
+		`cupboard_pantry_items{category="Dry Goods",household="Home",household_id="1"} 1`,
+		`cupboard_pantry_items_expired{household="Home",household_id="1"} 1`,
+		`cupboard_pantry_items_expiring_soon{household="Home",household_id="1"} 1`,
+		`cupboard_freezer_meals{age="old",household="Home",household_id="1"} 1`,
+		`cupboard_freezer_meals{age="fresh",household="Home",household_id="1"} 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestMetricsWithSameNamedHouseholds(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice", Category: "Dry Goods"}},
+		NextPantryID: 2,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Household names needn't be unique.
+	twin, err := createHousehold("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(twin.ID, &Store{
+		PantryItems:  []PantryItem{{ID: 2, Name: "Oats", Category: "Dry Goods"}},
+		NextPantryID: 3,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := loginAs(t, "admin", true)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with two households called Home, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`cupboard_pantry_items{category="Dry Goods",household="Home",household_id="1"} 1`,
+		`cupboard_pantry_items{category="Dry Goods",household="Home",household_id="` + strconv.Itoa(twin.ID) + `"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestRequestsAreLogged(t *testing.T) {
+	setupHandlerTest(t)
+	var buf bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(newLogger(&buf, LogConfig{Format: "json", Level: "info"}))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	cookie := loginAs(t, "sam", false)
+	req := httptest.NewRequest(http.MethodGet, "/shopping", nil)
+	req.AddCookie(cookie)
+	routes().ServeHTTP(httptest.NewRecorder(), req)
+
+	var line struct {
+		Msg     string `json:"msg"`
+		Method  string `json:"method"`
+		Path    string `json:"path"`
+		Status  int    `json:"status"`
+		Latency int64  `json:"latency"`
+		User    string `json:"user"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON log line, got %q: %v", buf.String(), err)
+	}
+	if line.Msg != "request" || line.Method != "GET" || line.Path != "/shopping" || line.Status != http.StatusOK || line.User != "sam" || line.Latency <= 0 {
+		t.Errorf("unexpected log line: %+v", line)
+	}
+
+	// Health checks are only logged at debug level.
+	buf.Reset()
+	routes().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if buf.Len() != 0 {
+		t.Errorf("expected no log line for /healthz at info level, got %q", buf.String())
+	}
+}
@@ -1,22 +1,90 @@
 package main
 
-// PantryItem represents an item stored in the pantry.
+// PantryItem represents an item stored in the pantry. An item with batches
+// has their total as its Quantity and the nearest of their expiry dates as
+// its Expiry. LocationID and Position say where it is kept, if anywhere.
+// Version goes up each time the item changes, so an offline copy can tell
+// whether it is stale.
 type PantryItem struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Quantity   string   `json:"quantity"`
+	Category   string   `json:"category"`
+	Expiry     string   `json:"expiry"`
+	Notes      string   `json:"notes"`
+	Tags       []string `json:"tags,omitempty"`
+	Batches    []Batch  `json:"batches,omitempty"`
+	LocationID int      `json:"location_id,omitempty"`
+	Position   string   `json:"position,omitempty"`
+	Version    int      `json:"version"`
+}
+
+// Batch is some of a pantry item bought at one time, such as one of three
+// tins of beans with different best-before dates.
+type Batch struct {
+	Quantity  string `json:"quantity"`
+	Expiry    string `json:"expiry"`
+	Purchased string `json:"purchased"`
+}
+
+// FreezerMeal represents a leftover meal stored in the freezer.
+// LocationID and Position say which freezer and drawer it is in, if known.
+// Version counts its changes, like a pantry item's.
+type FreezerMeal struct {
+	ID          int                     `json:"id"`
+	Name        string                  `json:"name"`
+	Portions    string                  `json:"portions"`
+	DateFrozen  string                  `json:"date_frozen"`
+	Description string                  `json:"description"`
+	Ingredients []FreezerMealIngredient `json:"ingredients,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	LocationID  int                     `json:"location_id,omitempty"`
+	Position    string                  `json:"position,omitempty"`
+	Version     int                     `json:"version"`
+}
+
+// Location is somewhere food is kept, such as a chest freezer or the
+// cupboard under the stairs, with its drawers, shelves or bins in order.
+type Location struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind"`
+	Compartments []string `json:"compartments"`
+}
+
+// FreezerMealIngredient records a pantry item that went into a batch-cooked
+// freezer meal. The item's details are copied so they outlive the item.
+type FreezerMealIngredient struct {
+	PantryItemID int    `json:"pantry_item_id"`
+	Name         string `json:"name"`
+	Quantity     string `json:"quantity"`
+	Category     string `json:"category"`
+}
+
+// Purchase records buying a pantry item: what it cost, where and when, and
+// how much was bought.
+type Purchase struct {
+	ID           int    `json:"id"`
+	PantryItemID int    `json:"pantry_item_id"`
+	Price        Money  `json:"price"`
+	Store        string `json:"store"`
+	Date         string `json:"date"`
+	Quantity     string `json:"quantity"`
+}
+
+// Removal records a pantry item or freezer meal taken out of stock and
+// whether it was eaten or binned, so waste can be counted over time.
+type Removal struct {
 	ID       int    `json:"id"`
+	ItemType string `json:"item_type"`
 	Name     string `json:"name"`
 	Quantity string `json:"quantity"`
 	Category string `json:"category"`
 	Expiry   string `json:"expiry"`
-	Notes    string `json:"notes"`
-}
-
-// FreezerMeal represents a leftover meal stored in the freezer.
-type FreezerMeal struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Portions    string `json:"portions"`
-	DateFrozen  string `json:"date_frozen"`
-	Description string `json:"description"`
+	Outcome  string `json:"outcome"`
+	Date     string `json:"date"`
+	// Value is what the item was worth when removed, if it had a price.
+	Value Money `json:"value"`
 }
 
 // Store holds all application data.
@@ -25,4 +93,109 @@ type Store struct {
 	FreezerMeals []FreezerMeal `json:"freezer_meals"`
 	NextPantryID int           `json:"next_pantry_id"`
 	NextMealID   int           `json:"next_meal_id"`
+
+	// loaded is each item's version and checksum when the store was read,
+	// which writeStore checks against what is saved by then. A Store made
+	// from scratch has none, and replaces whatever the household had.
+	loaded *storeVersions
+}
+
+// Recipe is a recipe imported from schema.org JSON-LD or a Markdown file.
+type Recipe struct {
+	ID           int                `json:"id"`
+	Name         string             `json:"name"`
+	Servings     string             `json:"servings"`
+	Source       string             `json:"source"`
+	Instructions string             `json:"instructions"`
+	Ingredients  []RecipeIngredient `json:"ingredients"`
+}
+
+// RecipeIngredient is one parsed ingredient line of a recipe. PantryItemID is
+// zero when the ingredient could not be matched to a pantry item.
+type RecipeIngredient struct {
+	ID           int     `json:"id"`
+	RecipeID     int     `json:"recipe_id"`
+	Raw          string  `json:"raw"`
+	Amount       float64 `json:"amount"`
+	Unit         string  `json:"unit"`
+	Name         string  `json:"name"`
+	Note         string  `json:"note"`
+	PantryItemID int     `json:"pantry_item_id"`
+	MatchScore   float64 `json:"match_score"`
+}
+
+// MealPlanEntry is a meal planned for a day: either portions of a freezer
+// meal or servings of a recipe. Exactly one of FreezerMealID and RecipeID is
+// set.
+type MealPlanEntry struct {
+	ID            int    `json:"id"`
+	Date          string `json:"date"`
+	FreezerMealID int    `json:"freezer_meal_id"`
+	RecipeID      int    `json:"recipe_id"`
+	Portions      int    `json:"portions"`
+	PeopleIDs     []int  `json:"people,omitempty"`
+}
+
+// ShoppingItem is a line on the shopping list.
+type ShoppingItem struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Quantity string `json:"quantity"`
+	Source   string `json:"source"`
+	Done     bool   `json:"done"`
+}
+
+// Tag is an allergen or free-form label attached to pantry items and freezer
+// meals.
+type Tag struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Allergen bool   `json:"allergen"`
+}
+
+// Person is a household member. Meals planned for them are checked against
+// the tags they Avoid, such as an allergen or "meat" for a vegetarian.
+type Person struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Avoid []string `json:"avoid"`
+}
+
+// User is an account that can log in. Admins can manage other accounts.
+type User struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Admin        bool   `json:"admin"`
+}
+
+// AuditEntry records a change made through the web interface and who made it.
+type AuditEntry struct {
+	ID        int    `json:"id"`
+	Time      string `json:"time"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Action    string `json:"action"`
+	Detail    string `json:"detail"`
+	Household string `json:"household"`
+}
+
+// Household owns a set of pantry items, freezer meals, recipes and plans.
+// Users see only the households they are members of.
+type Household struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// APIToken lets a script act as a user in one household without logging in.
+// Only a hash of the token itself is stored.
+type APIToken struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	HouseholdID int    `json:"household_id"`
+	Household   string `json:"household"`
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	Created     string `json:"created"`
+	LastUsed    string `json:"last_used"`
 }
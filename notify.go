@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// expiryNotice is the JSON body POSTed to the webhook for a household with
+// pantry items about to expire.
+type expiryNotice struct {
+	Household string       `json:"household"`
+	Items     []PantryItem `json:"items"`
+	URL       string       `json:"url,omitempty"`
+}
+
+// expiryNotices returns a notice for each household with items expiring
+// within the warning window.
+func expiryNotices(now time.Time) ([]expiryNotice, error) {
+	households, err := loadHouseholds()
+	if err != nil {
+		return nil, err
+	}
+	var notices []expiryNotice
+	for _, h := range households {
+		store, err := loadStore(h.ID)
+		if err != nil {
+			return nil, err
+		}
+		var items []PantryItem
+		for _, item := range store.PantryItems {
+			if isExpiringSoon(item.Expiry, now) {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		sortPantryItems(items)
+		notices = append(notices, expiryNotice{Household: h.Name, Items: items, URL: config.BaseURL})
+	}
+	return notices, nil
+}
+
+// sendExpiryNotices POSTs each household's expiring items to the webhook.
+func sendExpiryNotices(ctx context.Context, client *http.Client, webhookURL string) error {
+	notices, err := expiryNotices(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, n := range notices {
+		body, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// runNotifier sends expiry notices at the configured interval until ctx is
+// cancelled. It does nothing unless a webhook URL is configured.
+func runNotifier(ctx context.Context, nc NotificationConfig) {
+	if nc.WebhookURL == "" {
+		return
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	ticker := time.NewTicker(nc.Interval)
+	defer ticker.Stop()
+	for {
+		if err := sendExpiryNotices(ctx, client, nc.WebhookURL); err != nil && ctx.Err() == nil {
+			slog.Error("notification failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
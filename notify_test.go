@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useNotifyConfig sets the expiry window and base URL for the test.
+func useNotifyConfig(t *testing.T) {
+	t.Helper()
+	orig := config
+	t.Cleanup(func() { config = orig })
+	config.Warnings.ExpiryDays = 3
+	config.BaseURL = "https://cupboard.example"
+}
+
+// stockExpiryTest fills the default household and a second one, "Cabin",
+// with items relative to now, and adds a third household with nothing
+// expiring.
+func stockExpiryTest(t *testing.T, now time.Time) {
+	t.Helper()
+	day := func(n int) string { return now.AddDate(0, 0, n).Format("2006-01-02") }
+	home := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Rice", Expiry: day(100)},
+			{ID: 2, Name: "Milk", Expiry: day(2)},
+			{ID: 3, Name: "Beans", Expiry: day(-1)},
+			{ID: 4, Name: "Salt"},
+			{ID: 5, Name: "Yoghurt", Expiry: day(1)},
+		},
+		NextPantryID: 6,
+		NextMealID:   1,
+	}
+	if err := saveStore(defaultHouseholdID, home); err != nil {
+		t.Fatal(err)
+	}
+	cabin, err := createHousehold("Cabin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(cabin.ID, &Store{
+		PantryItems:  []PantryItem{{ID: 6, Name: "Flour", Expiry: day(1)}},
+		NextPantryID: 7,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	quiet, err := createHousehold("Flat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(quiet.ID, &Store{
+		PantryItems:  []PantryItem{{ID: 7, Name: "Pasta", Expiry: day(30)}},
+		NextPantryID: 8,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func noticeItemNames(n expiryNotice) []string {
+	var names []string
+	for _, item := range n.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestExpiryNoticesPickExpiringItems(t *testing.T) {
+	useTempDB(t)
+	useNotifyConfig(t)
+	now := time.Now()
+	stockExpiryTest(t, now)
+
+	notices, err := expiryNotices(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != 2 {
+		t.Fatalf("expected notices for the two households with items expiring, got %+v", notices)
+	}
+	// Expired, undated and far-off items are left out, and the rest come
+	// soonest first. Households come in name order.
+	if got := noticeItemNames(notices[0]); notices[0].Household != "Cabin" || len(got) != 1 || got[0] != "Flour" {
+		t.Errorf("expected Cabin's Flour, got %s %v", notices[0].Household, got)
+	}
+	if got := noticeItemNames(notices[1]); notices[1].Household != "Home" || len(got) != 2 || got[0] != "Yoghurt" || got[1] != "Milk" {
+		t.Errorf("expected Home's Yoghurt then Milk, got %s %v", notices[1].Household, got)
+	}
+	if notices[0].URL != "https://cupboard.example" {
+		t.Errorf("expected the notice to link to the base URL, got %q", notices[0].URL)
+	}
+}
+
+func TestSendExpiryNoticesPostsToWebhook(t *testing.T) {
+	useTempDB(t)
+	useNotifyConfig(t)
+	stockExpiryTest(t, time.Now())
+
+	var (
+		mu       sync.Mutex
+		received []expiryNotice
+		status   = http.StatusNoContent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON POST, got %s %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var n expiryNotice
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("expected a JSON notice: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, n)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	if err := sendExpiryNotices(context.Background(), srv.Client(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].Household != "Cabin" || received[1].Household != "Home" {
+		t.Fatalf("expected a notice per household with items expiring, got %+v", received)
+	}
+	if got := noticeItemNames(received[1]); len(got) != 2 || got[0] != "Yoghurt" {
+		t.Errorf("expected Home's expiring items in the body, got %v", got)
+	}
+
+	// A webhook that refuses the notice is reported.
+	mu.Lock()
+	status = http.StatusInternalServerError
+	mu.Unlock()
+	if err := sendExpiryNotices(context.Background(), srv.Client(), srv.URL); err == nil {
+		t.Error("expected an error when the webhook answers 500")
+	}
+}
+
+func TestRunNotifierOffWithoutWebhook(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		runNotifier(context.Background(), NotificationConfig{Interval: time.Millisecond})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected the notifier to return at once with no webhook configured")
+	}
+}
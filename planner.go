@@ -0,0 +1,746 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// shortfallSource labels shopping list lines generated from the meal plan.
+const shortfallSource = "Meal plan"
+
+// loadMealPlan returns a household's entries dated from..to inclusive,
+// ordered by date. An empty to means no upper bound.
+func loadMealPlan(householdID int, from, to string) ([]MealPlanEntry, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT id, date, freezer_meal_id, recipe_id, portions FROM meal_plan WHERE household_id = ? AND date >= ?"
+	args := []any{householdID, from}
+	if to != "" {
+		query += " AND date <= ?"
+		args = append(args, to)
+	}
+	rows, err := db.Query(query+" ORDER BY date, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []MealPlanEntry{}
+	for rows.Next() {
+		var e MealPlanEntry
+		if err := rows.Scan(&e.ID, &e.Date, &e.FreezerMealID, &e.RecipeID, &e.Portions); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, loadPlanPeople(db, entries)
+}
+
+// loadPlanPeople fills in who each entry is planned for.
+func loadPlanPeople(db *sql.DB, entries []MealPlanEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(entries))
+	for i, e := range entries {
+		index[e.ID] = i
+	}
+	rows, err := db.Query("SELECT entry_id, person_id FROM meal_plan_people ORDER BY entry_id, person_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryID, personID int
+		if err := rows.Scan(&entryID, &personID); err != nil {
+			return err
+		}
+		if i, ok := index[entryID]; ok {
+			entries[i].PeopleIDs = append(entries[i].PeopleIDs, personID)
+		}
+	}
+	return rows.Err()
+}
+
+// loadMealPlanEntry returns one entry, or nil if the household has no entry
+// with that ID.
+func loadMealPlanEntry(householdID, id int) (*MealPlanEntry, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	e := &MealPlanEntry{}
+	err = db.QueryRow("SELECT id, date, freezer_meal_id, recipe_id, portions FROM meal_plan WHERE id = ? AND household_id = ?", id, householdID).
+		Scan(&e.ID, &e.Date, &e.FreezerMealID, &e.RecipeID, &e.Portions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []MealPlanEntry{*e}
+	if err := loadPlanPeople(db, entries); err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+func insertMealPlanEntry(householdID int, e *MealPlanEntry) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO meal_plan (date, freezer_meal_id, recipe_id, portions, household_id) VALUES (?, ?, ?, ?, ?)",
+		e.Date, e.FreezerMealID, e.RecipeID, e.Portions, householdID,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.ID = int(id)
+	for _, personID := range e.PeopleIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO meal_plan_people (entry_id, person_id) VALUES (?, ?)", e.ID, personID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func deleteMealPlanEntry(householdID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM meal_plan_people WHERE entry_id IN (SELECT id FROM meal_plan WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM meal_plan WHERE id = ? AND household_id = ?", id, householdID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// portionCount reads the leading number of a free-text portions field such
+// as "4" or "4 portions". It returns 0 when there is no number.
+func portionCount(portions string) int {
+	n, _, ok := parseAmount(portions)
+	if !ok || n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// recipeScale is the factor to multiply a recipe's ingredients by to make
+// the given number of portions. Recipes without a numeric yield are assumed
+// to make exactly what was planned.
+func recipeScale(recipe *Recipe, portions int) float64 {
+	servings, _, ok := parseAmount(recipe.Servings)
+	if !ok || servings <= 0 || portions <= 0 {
+		return 1
+	}
+	return float64(portions) / servings
+}
+
+// allocation is the stock reserved by upcoming meal plan entries.
+type allocation struct {
+	portions map[int]int        // freezer meal ID → portions reserved
+	stock    map[int][]Quantity // pantry item ID → amounts reserved
+	names    map[int]string     // pantry item ID → ingredient name, for deleted items
+	missing  []neededIngredient // ingredients not matched to any pantry item
+}
+
+// neededIngredient totals an unmatched ingredient across planned recipes.
+type neededIngredient struct {
+	name    string
+	amounts []Quantity
+}
+
+// computeAllocation totals what the given entries reserve. Freezer entries
+// reserve portions; recipe entries reserve their matched ingredients, scaled
+// to the planned portions.
+func computeAllocation(entries []MealPlanEntry, recipes map[int]*Recipe) allocation {
+	alloc := allocation{
+		portions: make(map[int]int),
+		stock:    make(map[int][]Quantity),
+		names:    make(map[int]string),
+	}
+	for _, e := range entries {
+		if e.FreezerMealID != 0 {
+			alloc.portions[e.FreezerMealID] += e.Portions
+			continue
+		}
+		recipe := recipes[e.RecipeID]
+		if recipe == nil {
+			continue
+		}
+		scale := recipeScale(recipe, e.Portions)
+		for _, ing := range recipe.Ingredients {
+			// An ingredient without an amount ("salt to taste") reserves an
+			// unknown quantity, kept as a zero amount.
+			need := Quantity{Amount: ing.Amount * scale, Unit: ing.Unit}
+			if ing.PantryItemID == 0 {
+				alloc.addMissing(ing.Name, need)
+				continue
+			}
+			alloc.stock[ing.PantryItemID] = addReserved(alloc.stock[ing.PantryItemID], need)
+			alloc.names[ing.PantryItemID] = ing.Name
+		}
+	}
+	return alloc
+}
+
+func (a *allocation) addMissing(name string, need Quantity) {
+	key := normalizeName(name)
+	for i := range a.missing {
+		if normalizeName(a.missing[i].name) == key {
+			a.missing[i].amounts = addReserved(a.missing[i].amounts, need)
+			return
+		}
+	}
+	a.missing = append(a.missing, neededIngredient{name: name, amounts: []Quantity{need}})
+}
+
+// addReserved adds q to a list of reserved amounts, folding it into an
+// existing entry when the units are convertible.
+func addReserved(list []Quantity, q Quantity) []Quantity {
+	for i, r := range list {
+		if (r.Amount == 0) == (q.Amount == 0) && r.compatible(q) {
+			list[i].Amount += q.in(r.Unit)
+			return list
+		}
+	}
+	return append(list, q)
+}
+
+// loadAllocation computes what a household's plan from today onwards
+// reserves.
+func loadAllocation(householdID int) (allocation, error) {
+	entries, err := loadMealPlan(householdID, today(), "")
+	if err != nil {
+		return allocation{}, err
+	}
+	recipes, err := loadRecipeMap(householdID)
+	if err != nil {
+		return allocation{}, err
+	}
+	return computeAllocation(entries, recipes), nil
+}
+
+func loadRecipeMap(householdID int) (map[int]*Recipe, error) {
+	recipes, err := loadRecipes(householdID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*Recipe, len(recipes))
+	for i := range recipes {
+		byID[recipes[i].ID] = &recipes[i]
+	}
+	return byID, nil
+}
+
+// shortfalls lists what must be bought to cover the allocation: reserved
+// amounts beyond what the pantry holds, stock for deleted items, and
+// unmatched ingredients. Items whose quantity can't be compared are assumed
+// to be sufficient.
+func shortfalls(store *Store, alloc allocation) []ShoppingItem {
+	items := make(map[int]PantryItem, len(store.PantryItems))
+	for _, item := range store.PantryItems {
+		items[item.ID] = item
+	}
+	var out []ShoppingItem
+	ids := make([]int, 0, len(alloc.stock))
+	for id := range alloc.stock {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		item, ok := items[id]
+		if !ok {
+			for _, q := range alloc.stock[id] {
+				out = append(out, ShoppingItem{Name: alloc.names[id], Quantity: reservedString(q), Source: shortfallSource})
+			}
+			continue
+		}
+		avail, parsed := parseQuantity(item.Quantity)
+		for _, q := range alloc.stock[id] {
+			if !parsed || q.Amount == 0 || !q.compatible(avail) {
+				continue
+			}
+			short := q.Amount - avail.in(q.Unit)
+			if short > 1e-9 {
+				out = append(out, ShoppingItem{
+					Name:     item.Name,
+					Quantity: Quantity{Amount: short, Unit: q.Unit}.String(),
+					Source:   shortfallSource,
+				})
+			}
+		}
+	}
+	for _, m := range alloc.missing {
+		for _, q := range m.amounts {
+			out = append(out, ShoppingItem{Name: m.name, Quantity: reservedString(q), Source: shortfallSource})
+		}
+	}
+	return out
+}
+
+func reservedString(q Quantity) string {
+	if q.Amount == 0 {
+		return ""
+	}
+	return q.String()
+}
+
+// AllocatedPortions is the number of a freezer meal's portions reserved by
+// the meal plan.
+func (a allocation) AllocatedPortions(mealID int) int {
+	return a.portions[mealID]
+}
+
+// AllocatedStock describes how much of a pantry item the meal plan reserves,
+// e.g. "400 g" or "1 can, some".
+func (a allocation) AllocatedStock(itemID int) string {
+	parts := make([]string, 0, len(a.stock[itemID]))
+	for _, q := range a.stock[itemID] {
+		if q.Amount == 0 {
+			parts = append(parts, "some")
+			continue
+		}
+		parts = append(parts, q.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// freePortions is how many portions of meal are not yet planned.
+func (a allocation) freePortions(meal FreezerMeal) int {
+	return portionCount(meal.Portions) - a.portions[meal.ID]
+}
+
+func today() string {
+	return time.Now().Format(dateLayout)
+}
+
+// weekStart returns the Monday of the week containing t.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// planEntryView is a meal plan entry with the name of what's planned, who
+// it's for (empty means everyone) and any clashes with what they avoid.
+type planEntryView struct {
+	MealPlanEntry
+	Name     string
+	Missing  bool
+	People   []string
+	Warnings []string
+}
+
+type planDay struct {
+	Date    string
+	Label   string
+	IsToday bool
+	Entries []planEntryView
+}
+
+// freezerSuggestion is a freezer meal with portions still free to plan.
+type freezerSuggestion struct {
+	FreezerMeal
+	Free int
+}
+
+// planPage is the data for the weekly planner.
+type planPage struct {
+	WeekStart    string
+	PrevWeek     string
+	NextWeek     string
+	Days         []planDay
+	FreezerMeals []FreezerMeal
+	Recipes      []Recipe
+	Suggestions  []freezerSuggestion
+	Shortfalls   []ShoppingItem
+	Overbooked   []string
+	People       []Person
+}
+
+func planHandler(w http.ResponseWriter, r *http.Request) {
+	start := weekStart(time.Now())
+	if week := r.FormValue("week"); week != "" {
+		t, err := time.ParseInLocation(dateLayout, week, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid week", http.StatusBadRequest)
+			return
+		}
+		start = weekStart(t)
+	}
+	end := start.AddDate(0, 0, 6)
+
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	recipes, err := loadRecipes(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	week, err := loadMealPlan(hh, start.Format(dateLayout), end.Format(dateLayout))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	alloc, err := loadAllocation(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	people, err := loadPeople(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+
+	sortFreezerMeals(store.FreezerMeals)
+	meals := make(map[int]FreezerMeal, len(store.FreezerMeals))
+	for _, m := range store.FreezerMeals {
+		meals[m.ID] = m
+	}
+	recipeByID := make(map[int]*Recipe, len(recipes))
+	for i := range recipes {
+		recipeByID[recipes[i].ID] = &recipes[i]
+	}
+	personNames := make(map[int]string, len(people))
+	for _, p := range people {
+		personNames[p.ID] = p.Name
+	}
+
+	page := planPage{
+		WeekStart:    start.Format(dateLayout),
+		PrevWeek:     start.AddDate(0, 0, -7).Format(dateLayout),
+		NextWeek:     start.AddDate(0, 0, 7).Format(dateLayout),
+		FreezerMeals: store.FreezerMeals,
+		Recipes:      recipes,
+		Shortfalls:   shortfalls(store, alloc),
+		People:       people,
+	}
+	for i := 0; i < 7; i++ {
+		day := start.AddDate(0, 0, i)
+		date := day.Format(dateLayout)
+		pd := planDay{Date: date, Label: day.Format("Mon 2 Jan"), IsToday: date == today()}
+		for _, e := range week {
+			if e.Date != date {
+				continue
+			}
+			view := planEntryView{MealPlanEntry: e}
+			var tags []string
+			if e.FreezerMealID != 0 {
+				m, ok := meals[e.FreezerMealID]
+				view.Name, view.Missing, tags = m.Name, !ok, m.Tags
+			} else if rec, ok := recipeByID[e.RecipeID]; ok {
+				view.Name, tags = rec.Name, recipeTags(rec, store.PantryItems)
+			} else {
+				view.Missing = true
+			}
+			for _, id := range e.PeopleIDs {
+				if name, ok := personNames[id]; ok {
+					view.People = append(view.People, name)
+				}
+			}
+			view.Warnings = tagWarnings(tags, people, e.PeopleIDs)
+			pd.Entries = append(pd.Entries, view)
+		}
+		page.Days = append(page.Days, pd)
+	}
+	// Suggestions follow the freezer's oldest-first order.
+	for _, m := range store.FreezerMeals {
+		free := alloc.freePortions(m)
+		if free > 0 {
+			page.Suggestions = append(page.Suggestions, freezerSuggestion{FreezerMeal: m, Free: free})
+		} else if free < 0 {
+			page.Overbooked = append(page.Overbooked, m.Name)
+		}
+	}
+
+	render(w, r, "plan.html", page)
+}
+
+// planTargetExists reports whether the freezer meal or recipe an entry plans
+// belongs to the household.
+func planTargetExists(householdID int, e MealPlanEntry) (bool, error) {
+	db, err := openDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	query, id := "SELECT COUNT(*) FROM freezer_meals WHERE id = ? AND household_id = ?", e.FreezerMealID
+	if e.RecipeID != 0 {
+		query, id = "SELECT COUNT(*) FROM recipes WHERE id = ? AND household_id = ?", e.RecipeID
+	}
+	var n int
+	err = db.QueryRow(query, id, householdID).Scan(&n)
+	return n > 0, err
+}
+
+// planRedirect sends the user back to the week containing date.
+func planRedirect(w http.ResponseWriter, r *http.Request, date string) {
+	http.Redirect(w, r, planURL(date), http.StatusSeeOther)
+}
+
+// planURL is the planner page for the week holding date.
+func planURL(date string) string {
+	target := "/plan"
+	if t, err := time.ParseInLocation(dateLayout, date, time.Local); err == nil {
+		target += "?week=" + weekStart(t).Format(dateLayout)
+	}
+	return target
+}
+
+// addPlanHandler plans a meal. The "meal" field is "freezer:<id>" or
+// "recipe:<id>"; repeated "person" fields say who it's for, and none means
+// everyone.
+func addPlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	date := r.FormValue("date")
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	kind, idStr, _ := strings.Cut(r.FormValue("meal"), ":")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		planRedirect(w, r, date)
+		return
+	}
+	portions, err := strconv.Atoi(r.FormValue("portions"))
+	if err != nil || portions < 1 {
+		portions = 1
+	}
+	hh := householdID(r)
+	entry := MealPlanEntry{Date: date, Portions: portions}
+	switch kind {
+	case "freezer":
+		entry.FreezerMealID = id
+	case "recipe":
+		entry.RecipeID = id
+	default:
+		planRedirect(w, r, date)
+		return
+	}
+	ok, err := planTargetExists(hh, entry)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	people, err := loadPeople(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	for _, v := range r.Form["person"] {
+		personID, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		for _, p := range people {
+			if p.ID == personID {
+				entry.PeopleIDs = append(entry.PeopleIDs, personID)
+			}
+		}
+	}
+	if err := insertMealPlanEntry(hh, &entry); err != nil {
+		saveFailed(w, r, planURL(date), err)
+		return
+	}
+	planRedirect(w, r, date)
+}
+
+func deletePlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	entry, err := loadMealPlanEntry(householdID(r), id)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	if err := deleteMealPlanEntry(householdID(r), id); err != nil {
+		saveFailed(w, r, planURL(entry.Date), err)
+		return
+	}
+	planRedirect(w, r, entry.Date)
+}
+
+// cookedPlanHandler marks a planned meal as eaten: the reserved freezer
+// portions or recipe ingredients are taken out of stock and the entry is
+// removed from the plan.
+func cookedPlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	entry, err := loadMealPlanEntry(householdID(r), id)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if entry.FreezerMealID != 0 {
+		useFreezerPortions(store, entry.FreezerMealID, entry.Portions)
+	} else {
+		recipe, err := loadRecipe(householdID(r), entry.RecipeID)
+		if err != nil {
+			http.Error(w, "Failed to load data", http.StatusInternalServerError)
+			return
+		}
+		if recipe != nil {
+			useRecipeIngredients(store, recipe, entry.Portions)
+		}
+	}
+	if err := saveStore(householdID(r), store); err != nil {
+		saveFailed(w, r, planURL(entry.Date), err)
+		return
+	}
+	if err := deleteMealPlanEntry(householdID(r), id); err != nil {
+		saveFailed(w, r, planURL(entry.Date), err)
+		return
+	}
+	planRedirect(w, r, entry.Date)
+}
+
+// useFreezerPortions takes portions out of a freezer meal, removing the meal
+// once none are left. Meals without a numeric portion count are removed.
+func useFreezerPortions(store *Store, mealID, portions int) {
+	meals := store.FreezerMeals[:0]
+	for _, m := range store.FreezerMeals {
+		if m.ID == mealID {
+			left := portionCount(m.Portions) - portions
+			if left <= 0 {
+				continue
+			}
+			m.Portions = strconv.Itoa(left)
+		}
+		meals = append(meals, m)
+	}
+	store.FreezerMeals = meals
+}
+
+// useRecipeIngredients deducts a recipe's matched ingredients from the
+// pantry, removing items that are used up. Ingredients whose quantities can't
+// be compared with the item's are left untouched.
+func useRecipeIngredients(store *Store, recipe *Recipe, portions int) {
+	scale := recipeScale(recipe, portions)
+	usedUp := make(map[int]bool)
+	for _, ing := range recipe.Ingredients {
+		if ing.PantryItemID == 0 || ing.Amount == 0 {
+			continue
+		}
+		for i := range store.PantryItems {
+			item := &store.PantryItems[i]
+			if item.ID != ing.PantryItemID {
+				continue
+			}
+			if empty, ok := consumeItem(item, Quantity{Amount: ing.Amount * scale, Unit: ing.Unit}); ok {
+				usedUp[item.ID] = empty
+			}
+		}
+	}
+	items := store.PantryItems[:0]
+	for _, item := range store.PantryItems {
+		if !usedUp[item.ID] {
+			items = append(items, item)
+		}
+	}
+	store.PantryItems = items
+}
+
+// planShoppingHandler adds the plan's shortfall to the shopping list.
+func planShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/plan", http.StatusSeeOther)
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	alloc, err := loadAllocation(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if err := mergeShoppingItems(hh, shortfalls(store, alloc)); err != nil {
+		saveFailed(w, r, "/plan", err)
+		return
+	}
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
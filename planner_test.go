@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortionCount(t *testing.T) {
+	cases := map[string]int{"4": 4, "4 portions": 4, "": 0, "lots": 0, "2.5": 2}
+	for in, want := range cases {
+		if got := portionCount(in); got != want {
+			t.Errorf("portionCount(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	sunday := time.Date(2026, 10, 18, 15, 0, 0, 0, time.Local)
+	if got := weekStart(sunday).Format(dateLayout); got != "2026-10-12" {
+		t.Errorf("weekStart(Sunday 18th) = %s, want 2026-10-12", got)
+	}
+	monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+	if got := weekStart(monday).Format(dateLayout); got != "2026-10-19" {
+		t.Errorf("weekStart(Monday 19th) = %s, want 2026-10-19", got)
+	}
+}
+
+func TestComputeAllocation(t *testing.T) {
+	recipes := map[int]*Recipe{
+		1: {ID: 1, Servings: "4", Ingredients: []RecipeIngredient{
+			{Name: "rice", Amount: 400, Unit: "g", PantryItemID: 10},
+			{Name: "salt", PantryItemID: 11},
+			{Name: "saffron", Amount: 1, Unit: "pinch"},
+		}},
+	}
+	entries := []MealPlanEntry{
+		{FreezerMealID: 5, Portions: 2},
+		{FreezerMealID: 5, Portions: 1},
+		{RecipeID: 1, Portions: 2},
+		{RecipeID: 1, Portions: 4},
+	}
+	alloc := computeAllocation(entries, recipes)
+
+	if got := alloc.AllocatedPortions(5); got != 3 {
+		t.Errorf("expected 3 portions allocated, got %d", got)
+	}
+	if got := alloc.AllocatedStock(10); got != "600 g" {
+		t.Errorf("expected 600 g rice allocated, got %q", got)
+	}
+	if got := alloc.AllocatedStock(11); got != "some" {
+		t.Errorf("expected an unknown amount of salt, got %q", got)
+	}
+	if len(alloc.missing) != 1 || alloc.missing[0].amounts[0].Amount != 1.5 {
+		t.Errorf("expected 1.5 pinches of saffron missing, got %+v", alloc.missing)
+	}
+}
+
+func TestShortfalls(t *testing.T) {
+	store := &Store{PantryItems: []PantryItem{
+		{ID: 10, Name: "Rice", Quantity: "0.5 kg"},
+		{ID: 11, Name: "Salt", Quantity: "lots"},
+		{ID: 12, Name: "Beans", Quantity: "1 can"},
+	}}
+	alloc := computeAllocation([]MealPlanEntry{{RecipeID: 1, Portions: 1}}, map[int]*Recipe{
+		1: {ID: 1, Ingredients: []RecipeIngredient{
+			{Name: "rice", Amount: 600, Unit: "g", PantryItemID: 10},
+			{Name: "salt", Amount: 1, Unit: "tsp", PantryItemID: 11},
+			{Name: "beans", Amount: 1, Unit: "can", PantryItemID: 12},
+			{Name: "chorizo", Amount: 200, Unit: "g", PantryItemID: 99},
+		}},
+	})
+	got := shortfalls(store, alloc)
+	want := map[string]string{"Rice": "100 g", "chorizo": "200 g"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d shortfalls, got %+v", len(want), got)
+	}
+	for _, item := range got {
+		if want[item.Name] != item.Quantity || item.Source != shortfallSource {
+			t.Errorf("unexpected shortfall %+v", item)
+		}
+	}
+}
+
+func TestAddPlanHandlerAddsEntry(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{},
+		FreezerMeals: []FreezerMeal{{ID: 3, Name: "Chilli", Portions: "4"}},
+		NextPantryID: 1,
+		NextMealID:   4,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"date": {"2026-10-20"}, "meal": {"freezer:3"}, "portions": {"2"}}
+	req := httptest.NewRequest(http.MethodPost, "/plan/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	addPlanHandler(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected 303, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/plan?week=2026-10-19" {
+		t.Errorf("expected redirect to the entry's week, got %q", loc)
+	}
+	entries, err := loadMealPlan(defaultHouseholdID, "2026-10-19", "2026-10-25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].FreezerMealID != 3 || entries[0].Portions != 2 {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestAddPlanHandlerRejectsBadMeal(t *testing.T) {
+	setupHandlerTest(t)
+
+	form := url.Values{"date": {"2026-10-20"}, "meal": {"pizza:1"}}
+	req := httptest.NewRequest(http.MethodPost, "/plan/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	addPlanHandler(w, req)
+
+	entries, _ := loadMealPlan(defaultHouseholdID, "2000-01-01", "")
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %+v", entries)
+	}
+}
+
+func TestIndexHandlerShowsAllocation(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "4"}},
+		NextPantryID: 1,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := insertMealPlanEntry(defaultHouseholdID, &MealPlanEntry{Date: today(), FreezerMealID: 1, Portions: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	indexHandler(w, req)
+
+	if !strings.Contains(w.Body.String(), "2 allocated") {
+		t.Error("freezer card should show allocated portions")
+	}
+}
+
+func TestCookedPlanHandlerUsesPortions(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "4"}, {ID: 2, Name: "Soup", Portions: "1"}},
+		NextPantryID: 1,
+		NextMealID:   3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []MealPlanEntry{
+		{Date: today(), FreezerMealID: 1, Portions: 3},
+		{Date: today(), FreezerMealID: 2, Portions: 1},
+	} {
+		if err := insertMealPlanEntry(defaultHouseholdID, &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"1", "2"} {
+		form := url.Values{"id": {id}}
+		req := httptest.NewRequest(http.MethodPost, "/plan/cooked", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		cookedPlanHandler(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("expected 303, got %d", w.Code)
+		}
+	}
+
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.FreezerMeals) != 1 || store.FreezerMeals[0].Portions != "1" {
+		t.Errorf("expected 1 chilli portion left and soup gone, got %+v", store.FreezerMeals)
+	}
+	entries, _ := loadMealPlan(defaultHouseholdID, "2000-01-01", "")
+	if len(entries) != 0 {
+		t.Errorf("cooked entries should leave the plan, got %+v", entries)
+	}
+}
+
+func TestUseRecipeIngredients(t *testing.T) {
+	store := &Store{PantryItems: []PantryItem{
+		{ID: 1, Name: "Rice", Quantity: "1 kg"},
+		{ID: 2, Name: "Beans", Quantity: "1 can"},
+	}}
+	recipe := &Recipe{Servings: "2", Ingredients: []RecipeIngredient{
+		{Amount: 100, Unit: "g", PantryItemID: 1},
+		{Amount: 1, Unit: "can", PantryItemID: 2},
+	}}
+	useRecipeIngredients(store, recipe, 2)
+	if len(store.PantryItems) != 1 || store.PantryItems[0].Quantity != "0.9 kg" {
+		t.Errorf("unexpected pantry after cooking: %+v", store.PantryItems)
+	}
+}
+
+func TestPlanHandlerSuggestsOldestFirst(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems: []PantryItem{},
+		FreezerMeals: []FreezerMeal{
+			{ID: 1, Name: "Newer Stew", Portions: "2", DateFrozen: "2026-09-01"},
+			{ID: 2, Name: "Older Curry", Portions: "2", DateFrozen: "2026-01-01"},
+		},
+		NextPantryID: 1,
+		NextMealID:   3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/plan?week=2026-10-19", nil)
+	w := httptest.NewRecorder()
+	planHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	suggestions := body[strings.Index(body, "Use These First"):]
+	if strings.Index(suggestions, "Older Curry") > strings.Index(suggestions, "Newer Stew") {
+		t.Error("older freezer meals should be suggested first")
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in a currency's minor unit, such as pence or cents.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// currencySymbols are shown in place of the code for common currencies.
+var currencySymbols = map[string]string{
+	"GBP": "£",
+	"EUR": "€",
+	"USD": "$",
+	"AUD": "A$",
+	"CAD": "C$",
+	"NZD": "NZ$",
+}
+
+// String formats m as "£2.49", or "SEK 2.49" for a currency without a
+// symbol.
+func (m Money) String() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	prefix := m.Currency + " "
+	if sym, ok := currencySymbols[m.Currency]; ok {
+		prefix = sym
+	}
+	return fmt.Sprintf("%s%s%d.%02d", sign, prefix, amount/100, amount%100)
+}
+
+// parsePrice reads a price such as "2.49", "£2.49" or "3" into minor units.
+func parsePrice(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	for _, sym := range currencySymbols {
+		s = strings.TrimPrefix(s, sym)
+	}
+	s = strings.TrimSpace(s)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if !isDigits(whole) && !(whole == "" && hasFrac) || hasFrac && (!isDigits(frac) || len(frac) > 2) {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	w, err := strconv.ParseInt("0"+whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	f, _ := strconv.ParseInt((frac + "00")[:2], 10, 64)
+	return w*100 + f, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// moneyTotals sums amounts per currency.
+type moneyTotals map[string]int64
+
+func (t moneyTotals) add(m Money) {
+	if m.Currency != "" {
+		t[m.Currency] += m.Amount
+	}
+}
+
+// List returns the totals with the configured currency first, then the rest
+// alphabetically.
+func (t moneyTotals) List() []Money {
+	list := make([]Money, 0, len(t))
+	for c, amount := range t {
+		list = append(list, Money{Amount: amount, Currency: c})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].Currency == config.Currency) != (list[j].Currency == config.Currency) {
+			return list[i].Currency == config.Currency
+		}
+		return list[i].Currency < list[j].Currency
+	})
+	return list
+}
+
+// String joins the totals, e.g. "£12.40 + €3.00".
+func (t moneyTotals) String() string {
+	var parts []string
+	for _, m := range t.List() {
+		parts = append(parts, m.String())
+	}
+	return strings.Join(parts, " + ")
+}
+
+// addPurchase records buying a pantry item.
+func addPurchase(householdID int, p *Purchase) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := db.Exec(
+		"INSERT INTO purchases (household_id, pantry_item_id, price, currency, store, date, quantity) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		householdID, p.PantryItemID, p.Price.Amount, p.Price.Currency, p.Store, p.Date, p.Quantity,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	p.ID = int(id)
+	return err
+}
+
+// loadPurchases returns a household's purchases, newest first. An itemID of
+// zero returns every item's.
+func loadPurchases(householdID, itemID int) ([]Purchase, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, pantry_item_id, price, currency, store, date, quantity
+		FROM purchases
+		WHERE household_id = ? AND (? = 0 OR pantry_item_id = ?)
+		ORDER BY date DESC, id DESC`, householdID, itemID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	purchases := []Purchase{}
+	for rows.Next() {
+		var p Purchase
+		if err := rows.Scan(&p.ID, &p.PantryItemID, &p.Price.Amount, &p.Price.Currency, &p.Store, &p.Date, &p.Quantity); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, rows.Err()
+}
+
+func deletePurchase(householdID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM purchases WHERE id = ? AND household_id = ?", id, householdID)
+	return err
+}
+
+// itemValue estimates what a pantry item is worth from its latest purchase.
+// When both quantities can be compared the price is scaled to what is left,
+// so half a 1 kg bag is worth half its price; otherwise the item is taken to
+// be what was bought.
+func itemValue(item PantryItem, latest Purchase) Money {
+	have, okHave := parseQuantity(item.Quantity)
+	bought, okBought := parseQuantity(latest.Quantity)
+	if !okHave || !okBought || bought.Amount <= 0 || !have.compatible(bought) {
+		return latest.Price
+	}
+	share := have.in(bought.Unit) / bought.Amount
+	return Money{Amount: int64(float64(latest.Price.Amount)*share + 0.5), Currency: latest.Price.Currency}
+}
+
+// valuation is what each pantry item is worth, for items with a purchase.
+type valuation struct {
+	items map[int]Money
+	total moneyTotals
+}
+
+// loadValuation values a household's pantry items from their latest
+// purchases.
+func loadValuation(householdID int, items []PantryItem) (valuation, error) {
+	purchases, err := loadPurchases(householdID, 0)
+	if err != nil {
+		return valuation{}, err
+	}
+	return computeValuation(items, purchases), nil
+}
+
+// computeValuation values items from purchases, which are newest first.
+func computeValuation(items []PantryItem, purchases []Purchase) valuation {
+	latest := make(map[int]Purchase)
+	for _, p := range purchases {
+		if _, seen := latest[p.PantryItemID]; !seen {
+			latest[p.PantryItemID] = p
+		}
+	}
+	v := valuation{items: make(map[int]Money), total: moneyTotals{}}
+	for _, item := range items {
+		if p, ok := latest[item.ID]; ok {
+			m := itemValue(item, p)
+			v.items[item.ID] = m
+			v.total.add(m)
+		}
+	}
+	return v
+}
+
+// ItemValue is the value of a pantry item, or "" if it has no purchases.
+func (v valuation) ItemValue(itemID int) string {
+	if m, ok := v.items[itemID]; ok {
+		return m.String()
+	}
+	return ""
+}
+
+// PantryValue is the total value of the pantry, or "" if nothing has a
+// price.
+func (v valuation) PantryValue() string {
+	return v.total.String()
+}
+
+// value returns an item's value, if it has one.
+func (v valuation) value(itemID int) (Money, bool) {
+	m, ok := v.items[itemID]
+	return m, ok
+}
+
+// validatePurchase tidies a purchase's fields and reports what is wrong with
+// them. price is the submitted price text.
+func validatePurchase(p *Purchase, price string) fieldErrors {
+	p.Store = strings.TrimSpace(p.Store)
+	p.Quantity = strings.TrimSpace(p.Quantity)
+	p.Date = strings.TrimSpace(p.Date)
+	p.Price.Currency = strings.ToUpper(strings.TrimSpace(p.Price.Currency))
+	errs := fieldErrors{}
+	amount, err := parsePrice(price)
+	errs.check(strings.TrimSpace(price) != "", "price", "Price is required.")
+	errs.check(err == nil, "price", "Price must be an amount like 2.49.")
+	p.Price.Amount = amount
+	errs.check(isCurrencyCode(p.Price.Currency), "currency", "Currency must be a three-letter code like GBP.")
+	errs.checkLength("store", "Store", p.Store, maxNameLength)
+	errs.checkLength("quantity", "Quantity bought", p.Quantity, maxQuantityLength)
+	errs.check(p.Date != "", "date", "Date is required.")
+	errs.checkDate("date", "Date", p.Date)
+	return errs
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// itemPage is the data for a pantry item's page: its details and price
+// history, plus any purchase form that failed validation.
+type itemPage struct {
+	Item      PantryItem
+	Value     string
+	Purchases []Purchase
+	Form      formState
+	Today     string
+}
+
+// itemHandler shows a pantry item with its price history.
+func itemHandler(w http.ResponseWriter, r *http.Request) {
+	renderItem(w, r, http.StatusOK, formState{})
+}
+
+func renderItem(w http.ResponseWriter, r *http.Request, status int, form formState) {
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	i := pantryIndex(store, id)
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	purchases, err := loadPurchases(hh, id)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	page := itemPage{Item: store.PantryItems[i], Purchases: purchases, Form: form, Today: today()}
+	page.Value = computeValuation(store.PantryItems[i:i+1], purchases).ItemValue(id)
+	renderStatus(w, r, status, "item.html", page)
+}
+
+// addPurchaseHandler records a purchase of the pantry item in "id".
+func addPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if pantryIndex(store, id) < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	p := Purchase{
+		PantryItemID: id,
+		Price:        Money{Currency: r.FormValue("currency")},
+		Store:        r.FormValue("store"),
+		Date:         r.FormValue("date"),
+		Quantity:     r.FormValue("quantity"),
+	}
+	if errs := validatePurchase(&p, r.FormValue("price")); len(errs) > 0 {
+		renderItem(w, r, http.StatusUnprocessableEntity, formState{Modal: "purchase", Values: r.Form, Errors: errs})
+		return
+	}
+	back := "/pantry/item?id=" + strconv.Itoa(id)
+	if err := addPurchase(hh, &p); err != nil {
+		saveFailed(w, r, back, err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Recorded a purchase for "+p.Price.String()+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+func deletePurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	purchaseID, err := strconv.Atoi(r.FormValue("purchase_id"))
+	if err != nil {
+		http.Error(w, "Invalid or missing purchase_id", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(w, r)
+	if !ok {
+		return
+	}
+	back := "/pantry/item?id=" + strconv.Itoa(id)
+	if err := deletePurchase(householdID(r), purchaseID); err != nil {
+		saveFailed(w, r, back, err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Deleted the purchase.")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
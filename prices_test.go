@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	for in, want := range map[string]int64{
+		"2.49":  249,
+		"£2.49": 249,
+		" 3 ":   300,
+		"0.5":   50,
+		".99":   99,
+	} {
+		got, err := parsePrice(in)
+		if err != nil || got != want {
+			t.Errorf("parsePrice(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "abc", "2.499", "-1", "1.2.3", "."} {
+		if _, err := parsePrice(in); err == nil {
+			t.Errorf("parsePrice(%q): expected an error", in)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for m, want := range map[Money]string{
+		{Amount: 249, Currency: "GBP"}:  "£2.49",
+		{Amount: 5, Currency: "EUR"}:    "€0.05",
+		{Amount: 1200, Currency: "SEK"}: "SEK 12.00",
+		{Amount: -150, Currency: "USD"}: "-$1.50",
+	} {
+		if got := m.String(); got != want {
+			t.Errorf("%+v: got %q, want %q", m, got, want)
+		}
+	}
+	totals := moneyTotals{}
+	totals.add(Money{Amount: 300, Currency: "EUR"})
+	totals.add(Money{Amount: 100, Currency: "GBP"})
+	totals.add(Money{Amount: 150, Currency: "GBP"})
+	totals.add(Money{Amount: 999})
+	if got := totals.String(); got != "£2.50 + €3.00" {
+		t.Errorf("expected the configured currency first, got %q", got)
+	}
+}
+
+func TestComputeValuation(t *testing.T) {
+	items := []PantryItem{
+		{ID: 1, Name: "Flour", Quantity: "500 g"},
+		{ID: 2, Name: "Beans", Quantity: "2 cans"},
+		{ID: 3, Name: "Salt"},
+	}
+	purchases := []Purchase{
+		{PantryItemID: 1, Price: Money{Amount: 120, Currency: "GBP"}, Quantity: "1 kg"},
+		{PantryItemID: 1, Price: Money{Amount: 999, Currency: "GBP"}, Quantity: "1 kg"}, // older
+		{PantryItemID: 2, Price: Money{Amount: 80, Currency: "GBP"}},
+	}
+	v := computeValuation(items, purchases)
+	if got := v.ItemValue(1); got != "£0.60" {
+		t.Errorf("expected half a bag of flour to be worth half its latest price, got %q", got)
+	}
+	if got := v.ItemValue(2); got != "£0.80" {
+		t.Errorf("expected beans at their purchase price, got %q", got)
+	}
+	if got := v.ItemValue(3); got != "" {
+		t.Errorf("expected no value without a purchase, got %q", got)
+	}
+	if got := v.PantryValue(); got != "£1.40" {
+		t.Errorf("expected a pantry value of £1.40, got %q", got)
+	}
+}
+
+func TestAddPurchaseHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice", Quantity: "1 kg", Category: "Dry Goods"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(addPurchaseHandler, "/pantry/purchases/add", url.Values{"id": {"1"}, "price": {"cheap"}, "currency": {"GBP"}, "date": {"2024-03-01"}})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Price must be an amount") {
+		t.Errorf("expected 422 with a price error, got %d", w.Code)
+	}
+	if w := postForm(addPurchaseHandler, "/pantry/purchases/add", url.Values{"id": {"9"}, "price": {"1"}, "currency": {"GBP"}, "date": {"2024-03-01"}}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown item, got %d", w.Code)
+	}
+
+	w = postForm(addPurchaseHandler, "/pantry/purchases/add", url.Values{"id": {"1"}, "price": {"1.75"}, "currency": {"gbp"}, "store": {"Market"}, "date": {"2024-03-01"}, "quantity": {"1 kg"}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/pantry/item?id=1" {
+		t.Fatalf("expected a redirect to the item page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	purchases, err := loadPurchases(defaultHouseholdID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purchases) != 1 || purchases[0].Price != (Money{Amount: 175, Currency: "GBP"}) || purchases[0].Store != "Market" {
+		t.Fatalf("unexpected purchases: %+v", purchases)
+	}
+
+	w = httptest.NewRecorder()
+	itemHandler(w, httptest.NewRequest(http.MethodGet, "/pantry/item?id=1", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "Market") || !strings.Contains(body, "£1.75") {
+		t.Errorf("expected the item page to show its price history, got %d", w.Code)
+	}
+
+	// Another household can't see or delete the purchase.
+	if other, _ := loadPurchases(defaultHouseholdID+1, 0); len(other) != 0 {
+		t.Errorf("expected no purchases in another household, got %+v", other)
+	}
+	postForm(deletePurchaseHandler, "/pantry/purchases/delete", url.Values{"id": {"1"}, "purchase_id": {"1"}})
+	if left, _ := loadPurchases(defaultHouseholdID, 1); len(left) != 0 {
+		t.Errorf("expected the purchase to be deleted, got %+v", left)
+	}
+}
+
+func TestBinnedItemKeepsItsValue(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Cheese", Quantity: "200 g"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addPurchase(defaultHouseholdID, &Purchase{PantryItemID: 1, Price: Money{Amount: 400, Currency: "GBP"}, Date: "2024-03-01", Quantity: "400 g"}); err != nil {
+		t.Fatal(err)
+	}
+
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"1"}, "outcome": {"binned"}})
+	log, err := loadWasteLog(defaultHouseholdID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Value != (Money{Amount: 200, Currency: "GBP"}) {
+		t.Fatalf("expected the cheese to be logged at £2.00, got %+v", log)
+	}
+	if left, _ := loadPurchases(defaultHouseholdID, 0); len(left) != 0 {
+		t.Errorf("expected the deleted item's purchases to go with it, got %+v", left)
+	}
+}
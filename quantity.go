@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Quantity is an amount with an optional unit, parsed from free text such as
+// "2 cans", "500g" or "1 1/2 tbsp". Unit is canonical ("" for a bare count).
+type Quantity struct {
+	Amount float64
+	Unit   string
+}
+
+// unitAliases maps the spellings we recognise to a canonical unit.
+var unitAliases = map[string]string{
+	"g": "g", "gr": "g", "gram": "g", "grams": "g", "gramme": "g", "grammes": "g",
+	"kg": "kg", "kgs": "kg", "kilo": "kg", "kilos": "kg", "kilogram": "kg", "kilograms": "kg",
+	"mg": "mg",
+	"ml": "ml", "millilitre": "ml", "millilitres": "ml", "milliliter": "ml", "milliliters": "ml",
+	"cl": "cl",
+	"l":  "l", "litre": "l", "litres": "l", "liter": "l", "liters": "l", "ltr": "l",
+	"tsp": "tsp", "tsps": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"tbsp": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tbl": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"cup": "cup", "cups": "cup",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+	"can": "can", "cans": "can", "tin": "can", "tins": "can",
+	"jar": "jar", "jars": "jar",
+	"bottle": "bottle", "bottles": "bottle",
+	"pack": "pack", "packs": "pack", "packet": "pack", "packets": "pack",
+	"bag": "bag", "bags": "bag",
+	"box": "box", "boxes": "box",
+	"clove": "clove", "cloves": "clove",
+	"pinch": "pinch", "pinches": "pinch",
+	"bunch": "bunch", "bunches": "bunch",
+	"handful": "handful", "handfuls": "handful",
+	"slice": "slice", "slices": "slice",
+	"sprig": "sprig", "sprigs": "sprig",
+	"stick": "stick", "sticks": "stick",
+}
+
+// unitBase gives the dimension and size of each convertible unit relative to
+// its dimension's base unit (grams or millilitres). Units not listed here are
+// only comparable with themselves.
+var unitBase = map[string]struct {
+	dim    string
+	factor float64
+}{
+	"mg":   {"mass", 0.001},
+	"g":    {"mass", 1},
+	"kg":   {"mass", 1000},
+	"oz":   {"mass", 28.3495},
+	"lb":   {"mass", 453.592},
+	"ml":   {"volume", 1},
+	"cl":   {"volume", 10},
+	"l":    {"volume", 1000},
+	"tsp":  {"volume", 5},
+	"tbsp": {"volume", 15},
+	"cup":  {"volume", 240},
+}
+
+var unicodeFractions = map[rune]float64{
+	'¼': 0.25, '½': 0.5, '¾': 0.75,
+	'⅓': 1.0 / 3, '⅔': 2.0 / 3,
+	'⅕': 0.2, '⅖': 0.4, '⅗': 0.6, '⅘': 0.8,
+	'⅙': 1.0 / 6, '⅚': 5.0 / 6,
+	'⅛': 0.125, '⅜': 0.375, '⅝': 0.625, '⅞': 0.875,
+}
+
+// parseAmount reads a leading number from s. It understands decimals, simple
+// fractions ("1/2"), mixed numbers ("1 1/2", "1½") and ranges ("2-3", which
+// yield the upper bound). It returns the remaining text after the number.
+func parseAmount(s string) (float64, string, bool) {
+	s = strings.TrimSpace(s)
+	amount, rest, ok := parseSimpleAmount(s)
+	if !ok {
+		return 0, s, false
+	}
+	// Mixed number: "1 1/2" or "1½".
+	trimmed := strings.TrimLeft(rest, " ")
+	if frac, after, ok := parseFraction(trimmed); ok && frac < 1 && amount == float64(int(amount)) {
+		amount += frac
+		rest = after
+	}
+	// Range: "2-3" or "2 to 3".
+	trimmed = strings.TrimLeft(rest, " ")
+	for _, sep := range []string{"-", "–", "to "} {
+		if strings.HasPrefix(trimmed, sep) {
+			if upper, after, ok := parseSimpleAmount(strings.TrimPrefix(trimmed, sep)); ok {
+				amount, rest = upper, after
+			}
+			break
+		}
+	}
+	return amount, rest, true
+}
+
+// parseSimpleAmount reads a single number, fraction or unicode fraction.
+func parseSimpleAmount(s string) (float64, string, bool) {
+	s = strings.TrimLeft(s, " ")
+	if frac, rest, ok := parseFraction(s); ok {
+		return frac, rest, true
+	}
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == ',') {
+		end++
+	}
+	if end == 0 {
+		return 0, s, false
+	}
+	num := strings.TrimRight(strings.ReplaceAll(s[:end], ",", "."), ".")
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, s, false
+	}
+	return v, s[end:], true
+}
+
+// parseFraction reads "a/b" or a single unicode vulgar fraction.
+func parseFraction(s string) (float64, string, bool) {
+	for _, r := range s {
+		if v, ok := unicodeFractions[r]; ok {
+			return v, s[len(string(r)):], true
+		}
+		break
+	}
+	slash := strings.IndexByte(s, '/')
+	if slash <= 0 || slash > 3 {
+		return 0, s, false
+	}
+	num, err := strconv.Atoi(s[:slash])
+	if err != nil {
+		return 0, s, false
+	}
+	end := slash + 1
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	den, err := strconv.Atoi(s[slash+1 : end])
+	if err != nil || den == 0 {
+		return 0, s, false
+	}
+	return float64(num) / float64(den), s[end:], true
+}
+
+// parseUnit reads a leading unit word from s, returning the canonical unit and
+// the remaining text. Units may be attached to the number ("500g").
+func parseUnit(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	end := 0
+	for end < len(s) && (unicode.IsLetter(rune(s[end])) || s[end] == '.') {
+		end++
+	}
+	word := strings.TrimSuffix(strings.ToLower(s[:end]), ".")
+	if unit, ok := unitAliases[word]; ok {
+		return unit, s[end:]
+	}
+	return "", s
+}
+
+// parseQuantity parses a free-text quantity such as "2 cans" or "1.5kg". The
+// boolean is false when s does not start with a number.
+func parseQuantity(s string) (Quantity, bool) {
+	amount, rest, ok := parseAmount(s)
+	if !ok {
+		return Quantity{}, false
+	}
+	unit, _ := parseUnit(rest)
+	return Quantity{Amount: amount, Unit: unit}, true
+}
+
+// compatible reports whether q can be converted to other's unit. A bare
+// count is compatible with any count-like unit, so "3" and "2 cans" compare.
+func (q Quantity) compatible(other Quantity) bool {
+	if q.Unit == other.Unit {
+		return true
+	}
+	a, okA := unitBase[q.Unit]
+	b, okB := unitBase[other.Unit]
+	if !okA && !okB {
+		return q.Unit == "" || other.Unit == ""
+	}
+	return okA && okB && a.dim == b.dim
+}
+
+// in converts q to unit, which must be compatible.
+func (q Quantity) in(unit string) float64 {
+	a, okA := unitBase[q.Unit]
+	b, okB := unitBase[unit]
+	if q.Unit == unit || !okA || !okB {
+		return q.Amount
+	}
+	return q.Amount * a.factor / b.factor
+}
+
+// String formats q the way users type quantities: "500 g", "2 cans", "3".
+func (q Quantity) String() string {
+	amount := formatAmount(q.Amount)
+	switch q.Unit {
+	case "":
+		return amount
+	case "g", "kg", "mg", "ml", "cl", "l", "oz", "lb", "tsp", "tbsp":
+		return amount + " " + q.Unit
+	}
+	if q.Amount != 1 {
+		if strings.HasSuffix(q.Unit, "ch") || strings.HasSuffix(q.Unit, "x") {
+			return amount + " " + q.Unit + "es"
+		}
+		return amount + " " + q.Unit + "s"
+	}
+	return amount + " " + q.Unit
+}
+
+// formatAmount prints an amount to at most two decimal places, without
+// trailing zeros.
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// consumeQuantity deducts use from the free-text quantity have. It returns the
+// new quantity text and whether it is used up; ok is false when have can't be
+// parsed or isn't in a compatible unit, in which case nothing is deducted.
+func consumeQuantity(have string, use Quantity) (remaining string, usedUp bool, ok bool) {
+	avail, parsed := parseQuantity(have)
+	if !parsed || !use.compatible(avail) {
+		return have, false, false
+	}
+	left := avail.Amount - use.in(avail.Unit)
+	if left <= 1e-9 {
+		return "", true, true
+	}
+	return Quantity{Amount: left, Unit: avail.Unit}.String(), false, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	cases := []struct {
+		in     string
+		amount float64
+		unit   string
+	}{
+		{"2 cans", 2, "can"},
+		{"500g", 500, "g"},
+		{"1.5 kg", 1.5, "kg"},
+		{"1 1/2 tbsp", 1.5, "tbsp"},
+		{"½ tsp", 0.5, "tsp"},
+		{"1½ cups", 1.5, "cup"},
+		{"2-3 cloves", 3, "clove"},
+		{"3", 3, ""},
+		{"4 eggs", 4, ""},
+		{"250 ml", 250, "ml"},
+		{"1 tin", 1, "can"},
+	}
+	for _, c := range cases {
+		q, ok := parseQuantity(c.in)
+		if !ok {
+			t.Errorf("parseQuantity(%q) failed", c.in)
+			continue
+		}
+		if math.Abs(q.Amount-c.amount) > 1e-9 || q.Unit != c.unit {
+			t.Errorf("parseQuantity(%q) = %+v, want %v %q", c.in, q, c.amount, c.unit)
+		}
+	}
+}
+
+func TestParseQuantityNoNumber(t *testing.T) {
+	if _, ok := parseQuantity("some"); ok {
+		t.Error("text without a number should not parse")
+	}
+	if _, ok := parseQuantity(""); ok {
+		t.Error("empty string should not parse")
+	}
+}
+
+func TestQuantityConversion(t *testing.T) {
+	kg := Quantity{Amount: 1.5, Unit: "kg"}
+	g := Quantity{Amount: 200, Unit: "g"}
+	if !kg.compatible(g) {
+		t.Fatal("kg and g should be compatible")
+	}
+	if got := kg.in("g"); got != 1500 {
+		t.Errorf("1.5 kg in g = %v, want 1500", got)
+	}
+	if (Quantity{Amount: 1, Unit: "can"}).compatible(g) {
+		t.Error("cans and grams should not be compatible")
+	}
+	if (Quantity{Amount: 1, Unit: "l"}).compatible(g) {
+		t.Error("litres and grams should not be compatible")
+	}
+	if !(Quantity{Amount: 3}).compatible(Quantity{Amount: 2, Unit: "can"}) {
+		t.Error("a bare count should be compatible with cans")
+	}
+	if (Quantity{Amount: 1, Unit: "jar"}).compatible(Quantity{Amount: 2, Unit: "can"}) {
+		t.Error("jars and cans should not be compatible")
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	cases := map[Quantity]string{
+		{Amount: 500, Unit: "g"}:       "500 g",
+		{Amount: 2, Unit: "can"}:       "2 cans",
+		{Amount: 1, Unit: "can"}:       "1 can",
+		{Amount: 2, Unit: "pinch"}:     "2 pinches",
+		{Amount: 3, Unit: ""}:          "3",
+		{Amount: 1.0 / 3, Unit: "cup"}: "0.33 cups",
+	}
+	for q, want := range cases {
+		if got := q.String(); got != want {
+			t.Errorf("%+v.String() = %q, want %q", q, got, want)
+		}
+	}
+}
+
+func TestConsumeQuantity(t *testing.T) {
+	left, usedUp, ok := consumeQuantity("1 kg", Quantity{Amount: 250, Unit: "g"})
+	if !ok || usedUp || left != "0.75 kg" {
+		t.Errorf("1 kg - 250 g = %q usedUp=%v ok=%v", left, usedUp, ok)
+	}
+	if _, usedUp, ok := consumeQuantity("2 cans", Quantity{Amount: 2, Unit: "can"}); !ok || !usedUp {
+		t.Error("using both cans should use the item up")
+	}
+	if left, _, ok := consumeQuantity("some", Quantity{Amount: 1}); ok || left != "some" {
+		t.Error("unparseable quantities should be left alone")
+	}
+	if _, _, ok := consumeQuantity("500 g", Quantity{Amount: 1, Unit: "l"}); ok {
+		t.Error("incompatible units should not be deducted")
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Short code prefixes, saying whether a code is of a pantry item or a
+// freezer meal.
+const (
+	codePantry  = "P"
+	codeFreezer = "F"
+)
+
+// codeAlphabet is Crockford's base 32: digits and letters without I, L, O and
+// U, so a code copied from a label by hand can't be misread.
+const codeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// codeMultiplier scatters consecutive IDs so neighbouring items' codes don't
+// look alike. It is odd, so multiplying by it is reversible.
+const codeMultiplier = 0x2C9277B5
+
+// minCodeDigits is the shortest code, which covers the first 32,768 IDs.
+const minCodeDigits = 3
+
+// shortCode returns the code of the item of a kind with id, such as "F-7K2".
+// It depends only on the ID, so it stays the same for the item's life.
+func shortCode(prefix string, id int) string {
+	n := minCodeDigits
+	for uint64(id) >= 1<<(5*n) {
+		n++
+	}
+	mask := uint64(1)<<(5*n) - 1
+	v := uint64(id) * codeMultiplier & mask
+	digits := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		digits[i] = codeAlphabet[v&31]
+		v >>= 5
+	}
+	return prefix + "-" + string(digits)
+}
+
+// parseShortCode reads a code typed or scanned in any case, with or without
+// its hyphen, returning the prefix and ID it stands for.
+func parseShortCode(code string) (prefix string, id int, ok bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "", 0, false
+	}
+	prefix, code = code[:1], strings.TrimPrefix(code[1:], "-")
+	if prefix != codePantry && prefix != codeFreezer {
+		return "", 0, false
+	}
+	n := len(code)
+	if n < minCodeDigits || n > 12 {
+		return "", 0, false
+	}
+	var v uint64
+	for _, c := range code {
+		// Crockford decoding also accepts the letters that look like digits.
+		switch c {
+		case 'O':
+			c = '0'
+		case 'I', 'L':
+			c = '1'
+		}
+		d := strings.IndexRune(codeAlphabet, c)
+		if d < 0 {
+			return "", 0, false
+		}
+		v = v<<5 | uint64(d)
+	}
+	mask := uint64(1)<<(5*n) - 1
+	raw := v * codeInverse & mask
+	// Each ID has one code, of the shortest length that holds it.
+	if raw == 0 || (n > minCodeDigits && raw < 1<<(5*(n-1))) {
+		return "", 0, false
+	}
+	return prefix, int(raw), true
+}
+
+// codeInverse undoes codeMultiplier: codeMultiplier × codeInverse is 1 in
+// every power of two, found by Newton's iteration.
+var codeInverse = func() uint64 {
+	inv := uint64(codeMultiplier)
+	for range 5 {
+		inv *= 2 - codeMultiplier*inv
+	}
+	return inv
+}()
+
+// Code is the item's short code, printed on labels and used in /q/ links.
+func (item PantryItem) Code() string { return shortCode(codePantry, item.ID) }
+
+// Code is the meal's short code, printed on labels and used in /q/ links.
+func (m FreezerMeal) Code() string { return shortCode(codeFreezer, m.ID) }
+
+// quickPath is the path of the quick actions page for a code.
+func quickPath(code string) string { return "/q/" + code }
+
+// oneOf is a single unit of a pantry item, such as one can of "3 cans", and
+// whether the item is counted in units at all; "500 g" isn't.
+func oneOf(quantity string) (Quantity, bool) {
+	q, ok := parseQuantity(quantity)
+	if !ok || q.Amount < 1 {
+		return Quantity{}, false
+	}
+	if _, measured := unitBase[q.Unit]; measured {
+		return Quantity{}, false
+	}
+	return Quantity{Amount: 1, Unit: q.Unit}, true
+}
+
+// quickPage is the data for the quick actions page a label's code opens.
+// Exactly one of Item and Meal is set.
+type quickPage struct {
+	Code  string
+	Item  *PantryItem
+	Meal  *FreezerMeal
+	Where string
+	// One is what "use one" takes, or "" if it can't be offered.
+	One    string
+	Places []placeGroup
+	Form   formState
+}
+
+// Name is the name of the item or meal.
+func (p quickPage) Name() string {
+	if p.Item != nil {
+		return p.Item.Name
+	}
+	return p.Meal.Name
+}
+
+// quickTarget is what a short code in the path refers to: the household's
+// store and the index of the item or meal in it.
+type quickTarget struct {
+	code   string
+	prefix string
+	store  *Store
+	index  int
+}
+
+// loadQuickTarget finds the item or meal with the "{code}" path segment,
+// writing an error response if it can't.
+func loadQuickTarget(w http.ResponseWriter, r *http.Request) (quickTarget, bool) {
+	prefix, id, ok := parseShortCode(r.PathValue("code"))
+	if !ok {
+		http.NotFound(w, r)
+		return quickTarget{}, false
+	}
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return quickTarget{}, false
+	}
+	t := quickTarget{code: shortCode(prefix, id), prefix: prefix, store: store}
+	if prefix == codePantry {
+		t.index = pantryIndex(store, id)
+	} else {
+		t.index = freezerIndex(store, id)
+	}
+	if t.index < 0 {
+		http.NotFound(w, r)
+		return quickTarget{}, false
+	}
+	return t, true
+}
+
+func (t quickTarget) name() string {
+	if t.prefix == codePantry {
+		return t.store.PantryItems[t.index].Name
+	}
+	return t.store.FreezerMeals[t.index].Name
+}
+
+func quickHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadQuickTarget(w, r)
+	if !ok {
+		return
+	}
+	renderQuick(w, r, http.StatusOK, t, formState{})
+}
+
+// renderQuick shows the quick actions page for t, with form the move that
+// failed validation, if any.
+func renderQuick(w http.ResponseWriter, r *http.Request, status int, t quickTarget, form formState) {
+	locs, err := loadLocations(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	page := quickPage{Code: t.code, Form: form}
+	var place string
+	if t.prefix == codePantry {
+		item := t.store.PantryItems[t.index]
+		page.Item = &item
+		page.Where = locs.Describe(item.LocationID, item.Position)
+		if one, ok := oneOf(item.Quantity); ok {
+			page.One = one.String()
+		}
+		place = item.Place()
+	} else {
+		meal := t.store.FreezerMeals[t.index]
+		page.Meal = &meal
+		page.Where = locs.Describe(meal.LocationID, meal.Position)
+		page.One = "1 portion"
+		place = meal.Place()
+	}
+	if form.Modal == "move" {
+		place = form.Value("move", "place")
+	}
+	page.Places = locs.Places(place)
+	renderStatus(w, r, status, "quick.html", page)
+}
+
+// quickUseHandler takes one of something out: a portion of a freezer meal
+// or one unit of a counted pantry item. Using the last of it removes it and
+// logs it as eaten.
+func quickUseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	t, ok := loadQuickTarget(w, r)
+	if !ok {
+		return
+	}
+	name := t.name()
+	var left string
+	var finished bool
+	var err error
+	if t.prefix == codeFreezer {
+		left, finished, err = takePortion(householdID(r), t.store, t.index)
+	} else {
+		if _, ok := oneOf(t.store.PantryItems[t.index].Quantity); !ok {
+			http.Error(w, name+" isn't counted in units; mark it empty or change its quantity instead", http.StatusUnprocessableEntity)
+			return
+		}
+		left, finished, err = takeOne(householdID(r), t.store, t.index)
+	}
+	if err != nil {
+		saveFailed(w, r, quickPath(t.code), err)
+		return
+	}
+	if finished {
+		addFlash(w, r, flashSuccess, "That was the last of "+name+".")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Took one out of "+name+"; "+left+" left.")
+	http.Redirect(w, r, quickPath(t.code), http.StatusSeeOther)
+}
+
+// takeOne takes one unit of the counted pantry item at i out of store and
+// saves it, like takePortion: the last one removes the item and logs it as
+// eaten.
+func takeOne(householdID int, store *Store, i int) (left string, finished bool, err error) {
+	item := &store.PantryItems[i]
+	one, _ := oneOf(item.Quantity)
+	if usedUp, _ := consumeItem(item, one); usedUp {
+		return "", true, removePantryItem(householdID, store, i, outcomeEaten)
+	}
+	return item.Quantity, false, saveStore(householdID, store)
+}
+
+// quickEmptyHandler removes an item or meal whose container is empty,
+// logging it as eaten.
+func quickEmptyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	t, ok := loadQuickTarget(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	name := t.name()
+	var err error
+	if t.prefix == codePantry {
+		err = removePantryItem(hh, t.store, t.index, outcomeEaten)
+	} else {
+		meal := t.store.FreezerMeals[t.index]
+		t.store.FreezerMeals = append(t.store.FreezerMeals[:t.index], t.store.FreezerMeals[t.index+1:]...)
+		err = saveRemoval(hh, t.store, freezerRemoval(meal, outcomeEaten, time.Now()))
+	}
+	if err != nil {
+		saveFailed(w, r, quickPath(t.code), err)
+		return
+	}
+	addFlash(w, r, flashSuccess, removedMessage(name, outcomeEaten))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// quickMoveHandler moves an item or meal to the place posted in "place".
+func quickMoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	t, ok := loadQuickTarget(w, r)
+	if !ok {
+		return
+	}
+	hh := householdID(r)
+	locationID, position := parsePlace(r.FormValue("place"))
+	errs := fieldErrors{}
+	if err := validatePlace(hh, errs, "place", locationID, position); err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if len(errs) > 0 {
+		renderQuick(w, r, http.StatusUnprocessableEntity, t, formState{Modal: "move", Values: r.PostForm, Errors: errs})
+		return
+	}
+	if t.prefix == codePantry {
+		item := &t.store.PantryItems[t.index]
+		item.LocationID, item.Position = locationID, position
+	} else {
+		meal := &t.store.FreezerMeals[t.index]
+		meal.LocationID, meal.Position = locationID, position
+	}
+	if err := saveStore(hh, t.store); err != nil {
+		saveFailed(w, r, quickPath(t.code), err)
+		return
+	}
+	addFlash(w, r, flashSuccess, "Moved "+t.name()+".")
+	http.Redirect(w, r, quickPath(t.code), http.StatusSeeOther)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestShortCodes(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, id := range []int{1, 2, 3, 31, 32, 32767, 32768, 1 << 20, 123456789} {
+		code := shortCode(codeFreezer, id)
+		if seen[code] {
+			t.Errorf("code %s repeated", code)
+		}
+		seen[code] = true
+		prefix, got, ok := parseShortCode(code)
+		if !ok || prefix != codeFreezer || got != id {
+			t.Errorf("%d: %s parsed as %s %d %v", id, code, prefix, got, ok)
+		}
+	}
+	if code := shortCode(codePantry, 7); len(code) != 5 || !strings.HasPrefix(code, "P-") {
+		t.Errorf("expected a three-digit pantry code, got %q", code)
+	}
+
+	code := shortCode(codePantry, 42)
+	typed := strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(code, "-", ""), "0", "o"))
+	if _, id, ok := parseShortCode(typed); !ok || id != 42 {
+		t.Errorf("expected %q read as %s, got %d %v", typed, code, id, ok)
+	}
+	for _, bad := range []string{"", "X-123", "F-12", "F-U00", "F-000"} {
+		if _, _, ok := parseShortCode(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestDeletedItemCodesAreNotReused(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice"}, {ID: 2, Name: "Oats"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Dal", Portions: "1"}},
+		NextPantryID: 3,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	oats := shortCode(codePantry, 2)
+	// Deleting the newest item, and the only meal, frees nothing up.
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"2"}, "outcome": {outcomeEaten}})
+	postForm(deleteFreezerHandler, "/freezer/delete", url.Values{"id": {"1"}, "outcome": {outcomeEaten}})
+	postForm(addPantryHandler, "/pantry/add", url.Values{"name": {"Lentils"}})
+	postForm(addFreezerHandler, "/freezer/add", url.Values{"name": {"Chilli"}})
+
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := pantryIndex(store, 3); i < 0 || store.PantryItems[i].Name != "Lentils" {
+		t.Errorf("expected the lentils to get a new ID, got %+v", store.PantryItems)
+	}
+	if len(store.FreezerMeals) != 1 || store.FreezerMeals[0].ID != 2 {
+		t.Errorf("expected the chilli to get a new ID, got %+v", store.FreezerMeals)
+	}
+	if w := quickRequest(quickHandler, http.MethodGet, oats, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected the deleted oats' code to stay unknown, got %d", w.Code)
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	tests := []struct {
+		quantity, one string
+	}{
+		{"3 cans", "1 can"},
+		{"2", "1"},
+		{"500 g", ""},
+		{"half a bag", ""},
+	}
+	for _, tt := range tests {
+		one, ok := oneOf(tt.quantity)
+		if got := one.String(); ok != (tt.one != "") || (ok && got != tt.one) {
+			t.Errorf("%q: got %q, %v", tt.quantity, got, ok)
+		}
+	}
+}
+
+// quickRequest sends a request to a /q/ page for code, as the mux would
+// route it.
+func quickRequest(handler http.HandlerFunc, method, code string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, quickPath(code), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetPathValue("code", code)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestQuickActions(t *testing.T) {
+	setupHandlerTest(t)
+	l := Location{Name: "Larder", Kind: locationPantry, Compartments: []string{"Top shelf"}}
+	if err := saveLocation(defaultHouseholdID, &l); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Chickpeas", Quantity: "2 cans"}, {ID: 2, Name: "Flour", Quantity: "1 kg"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Dal", Portions: "3"}},
+		NextPantryID: 3,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	beans := shortCode(codePantry, 1)
+
+	w := quickRequest(quickHandler, http.MethodGet, strings.ToLower(beans), nil)
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "Use 1 can") || !strings.Contains(body, "Top shelf") {
+		t.Fatalf("expected the chickpeas' quick actions, got %d", w.Code)
+	}
+	if w := quickRequest(quickHandler, http.MethodGet, shortCode(codePantry, 9), nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown code, got %d", w.Code)
+	}
+	if w := quickRequest(quickUseHandler, http.MethodPost, shortCode(codePantry, 2), nil); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 using one of something weighed, got %d", w.Code)
+	}
+
+	if w := quickRequest(quickUseHandler, http.MethodPost, beans, nil); w.Code != http.StatusSeeOther || w.Header().Get("Location") != quickPath(beans) {
+		t.Fatalf("expected a redirect back to the code's page, got %d", w.Code)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if q := store.PantryItems[pantryIndex(store, 1)].Quantity; q != "1 can" {
+		t.Errorf("expected 1 can left, got %q", q)
+	}
+
+	if w := quickRequest(quickMoveHandler, http.MethodPost, beans, url.Values{"place": {"99:Somewhere"}}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 moving to an unknown place, got %d", w.Code)
+	}
+	quickRequest(quickMoveHandler, http.MethodPost, beans, url.Values{"place": {placeValue(l.ID, "Top shelf")}})
+	store, _ = loadStore(defaultHouseholdID)
+	if item := store.PantryItems[pantryIndex(store, 1)]; item.LocationID != l.ID || item.Position != "Top shelf" {
+		t.Errorf("expected the chickpeas moved to the top shelf, got %+v", item)
+	}
+
+	dal := shortCode(codeFreezer, 1)
+	quickRequest(quickUseHandler, http.MethodPost, dal, nil)
+	if store, _ := loadStore(defaultHouseholdID); store.FreezerMeals[0].Portions != "2" {
+		t.Errorf("expected a portion of dal used, got %+v", store.FreezerMeals)
+	}
+	if w := quickRequest(quickEmptyHandler, http.MethodPost, dal, nil); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	if store, _ := loadStore(defaultHouseholdID); len(store.FreezerMeals) != 0 {
+		t.Errorf("expected the dal gone once marked empty, got %+v", store.FreezerMeals)
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// receiptLine is one line of a receipt proposed as a pantry item, shown for
+// review before anything is added.
+type receiptLine struct {
+	Raw      string
+	Name     string
+	Quantity string
+	Category string
+	Expiry   string
+	// Price is the line's price as typed in the review form, e.g. "2.49".
+	Price string
+	// Known is the name of the pantry item or past item the line was
+	// matched with, if any.
+	Known string
+	Keep  bool
+	// Errors are set when the reviewed line fails validation.
+	Errors fieldErrors
+}
+
+var (
+	receiptPriceRe     = regexp.MustCompile(`\s+(-?)[£€$]?(\d+\.\d{2})(-?)\s*[A-Z*]?\s*$`)
+	receiptCountRe     = regexp.MustCompile(`^(\d+)\s*[xX@*]\s+`)
+	receiptUnitPriceRe = regexp.MustCompile(`@\s*[£€$]?\d+(?:\.\d+)?\s*/\s*\w+`)
+	receiptMultipackRe = regexp.MustCompile(`(?i)\b(\d+)\s*x\s*(\d+(?:\.\d+)?)\s*(kg|g|ml|cl|l)\b`)
+	receiptSizeRe      = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?)\s*(kg|g|ml|cl|ltr|l|pints?|pt)\b`)
+)
+
+// receiptSkipWords mark lines that aren't groceries: totals, payments,
+// discounts and the shop's own details. They match whole words.
+var receiptSkipWords = []string{
+	"total", "subtotal", "sub total", "balance", "change", "cash", "card", "visa",
+	"mastercard", "debit", "credit", "vat", "saving", "savings", "discount", "promotion",
+	"multibuy", "clubcard", "nectar", "points", "items sold", "thank", "receipt",
+	"tel", "www", "refund", "bag charge", "carrier bag",
+}
+
+// parseReceipt reads a pasted or uploaded receipt into proposed pantry items.
+// CSV e-receipts need a header row naming the description column; anything
+// else is read as one item per line with the price at the end.
+func parseReceipt(filename string, data []byte) ([]receiptLine, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return parseCSVReceipt(data)
+	}
+	var lines []receiptLine
+	for _, raw := range strings.Split(string(data), "\n") {
+		if line, ok := parseReceiptLine(raw); ok {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no items found on the receipt")
+	}
+	return lines, nil
+}
+
+// parseReceiptLine reads a receipt line such as "2 x HEINZ BEANS 4X415G
+// 3.50". Lines without a price, with a negative one (a discount) or that
+// look like totals and payments are skipped.
+func parseReceiptLine(raw string) (receiptLine, bool) {
+	raw = strings.TrimSpace(raw)
+	m := receiptPriceRe.FindStringSubmatchIndex(raw)
+	if m == nil {
+		return receiptLine{}, false
+	}
+	if m[3] > m[2] || m[7] > m[6] {
+		return receiptLine{}, false
+	}
+	price, err := parsePrice(raw[m[4]:m[5]])
+	if err != nil {
+		return receiptLine{}, false
+	}
+	text := raw[:m[0]]
+	count := 1.0
+	if c := receiptCountRe.FindStringSubmatch(text); c != nil {
+		count, _ = strconv.ParseFloat(c[1], 64)
+		text = text[len(c[0]):]
+	}
+	return newReceiptLine(raw, text, count, price)
+}
+
+// parseCSVReceipt reads a CSV e-receipt, taking the columns it recognises by
+// their header: the description, and optionally the quantity and price.
+func parseCSVReceipt(data []byte) ([]receiptLine, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	nameCol, qtyCol, priceCol := -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "description", "item", "product", "name":
+			nameCol = i
+		case "quantity", "qty", "count":
+			qtyCol = i
+		case "price", "amount", "total", "line total", "value":
+			priceCol = i
+		}
+	}
+	if nameCol < 0 {
+		return nil, errors.New("CSV needs a description, item, product or name column")
+	}
+	var lines []receiptLine
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		count := 1.0
+		if n, err := strconv.ParseFloat(field(qtyCol), 64); err == nil && n > 0 {
+			count = n
+		}
+		var price int64
+		if p := field(priceCol); p != "" {
+			if strings.HasPrefix(p, "-") {
+				continue
+			}
+			if price, err = parsePrice(p); err != nil {
+				continue
+			}
+		}
+		if line, ok := newReceiptLine(strings.Join(rec, ", "), field(nameCol), count, price); ok {
+			if priceCol < 0 {
+				line.Price = ""
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no items found on the receipt")
+	}
+	return lines, nil
+}
+
+// newReceiptLine proposes an item from a line's description, taking its pack
+// size as the quantity: "4X415G" is four of something, "500G" with a count
+// of 2 is 1000 g and a count alone is that many.
+func newReceiptLine(raw, text string, count float64, price int64) (receiptLine, bool) {
+	words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+	for _, w := range receiptSkipWords {
+		if strings.Contains(words, " "+w+" ") {
+			return receiptLine{}, false
+		}
+	}
+	text = receiptUnitPriceRe.ReplaceAllString(text, " ")
+	quantity := Quantity{Amount: count}
+	if m := receiptMultipackRe.FindStringSubmatch(text); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		quantity = Quantity{Amount: count * n}
+		text = strings.Replace(text, m[0], " ", 1)
+	} else if m := receiptSizeRe.FindStringSubmatch(text); m != nil {
+		size, _ := strconv.ParseFloat(m[1], 64)
+		unit := strings.ToLower(m[2])
+		switch unit {
+		case "pt", "pint", "pints":
+			size, unit = size*568, "ml"
+		case "ltr":
+			unit = "l"
+		}
+		quantity = Quantity{Amount: count * size, Unit: unit}
+		text = strings.Replace(text, m[0], " ", 1)
+	}
+	name := tidyReceiptName(text)
+	if name == "" {
+		return receiptLine{}, false
+	}
+	return receiptLine{
+		Raw:      raw,
+		Name:     name,
+		Quantity: quantity.String(),
+		Price:    fmt.Sprintf("%d.%02d", price/100, price%100),
+		Keep:     true,
+	}, true
+}
+
+// tidyReceiptName collapses spacing and turns a shouted till name such as
+// "HEINZ BAKED BEANS" into "Heinz Baked Beans".
+func tidyReceiptName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '*' || r == '#'
+	})
+	for i, w := range words {
+		if strings.ToUpper(w) == w {
+			rs := []rune(strings.ToLower(w))
+			rs[0] = unicode.ToUpper(rs[0])
+			words[i] = string(rs)
+		}
+	}
+	name := strings.Trim(strings.Join(words, " "), " -,.:;")
+	if !strings.ContainsFunc(name, unicode.IsLetter) {
+		return ""
+	}
+	return name
+}
+
+// productCatalogue guesses a category from words in a product's name when
+// nothing like it has been stocked before.
+var productCatalogue = map[string]string{
+	"bean": "Canned Goods", "tomato": "Canned Goods", "soup": "Canned Goods", "tuna": "Canned Goods",
+	"sweetcorn": "Canned Goods", "chickpea": "Canned Goods", "lentil": "Canned Goods", "sardine": "Canned Goods",
+	"rice": "Dry Goods", "pasta": "Dry Goods", "spaghetti": "Dry Goods", "penne": "Dry Goods", "noodle": "Dry Goods",
+	"oat": "Dry Goods", "cereal": "Dry Goods", "couscous": "Dry Goods", "quinoa": "Dry Goods",
+	"pepper": "Spices", "cumin": "Spices", "paprika": "Spices", "cinnamon": "Spices", "oregano": "Spices",
+	"chilli": "Spices", "curry": "Spices", "salt": "Spices", "turmeric": "Spices",
+	"ketchup": "Condiments", "mayonnaise": "Condiments", "mustard": "Condiments", "vinegar": "Condiments",
+	"sauce": "Condiments", "oil": "Condiments", "jam": "Condiments", "honey": "Condiments", "pesto": "Condiments",
+	"flour": "Baking", "sugar": "Baking", "yeast": "Baking", "cocoa": "Baking", "baking": "Baking", "vanilla": "Baking",
+	"crisp": "Snacks", "biscuit": "Snacks", "chocolate": "Snacks", "nut": "Snacks", "popcorn": "Snacks", "cracker": "Snacks",
+	"tea": "Beverages", "coffee": "Beverages", "juice": "Beverages", "milk": "Beverages", "water": "Beverages",
+	"cola": "Beverages", "squash": "Beverages", "lemonade": "Beverages",
+}
+
+// guessReceiptItems fills in each line's category, and its name when it
+// matches something the household has stocked, from known products; lines
+// that match nothing get a category from the product catalogue.
+func guessReceiptItems(lines []receiptLine, known []PantryItem) {
+	for i := range lines {
+		line := &lines[i]
+		if item, _, ok := bestPantryMatch(line.Name, known); ok {
+			line.Name, line.Category, line.Known = item.Name, item.Category, item.Name
+			continue
+		}
+		for _, tok := range nameTokens(line.Name) {
+			if c, ok := productCatalogue[tok]; ok {
+				line.Category = c
+				break
+			}
+		}
+	}
+}
+
+// receiptTarget returns the index of the stocked pantry item a receipt line
+// is more of, or -1 if it is something new: the item the line was matched
+// with, unless it was renamed while being reviewed, or else one item looks
+// like a duplicate of, as on the add form.
+func receiptTarget(store *Store, line receiptLine, item PantryItem) int {
+	if line.Known != "" && strings.EqualFold(item.Name, line.Known) {
+		for i, p := range store.PantryItems {
+			if p.Name == line.Known {
+				return i
+			}
+		}
+	}
+	if dup, ok := findDuplicate(item, store.PantryItems); ok {
+		return pantryIndex(store, dup.ID)
+	}
+	return -1
+}
+
+// receiptSummary says how many items importing a receipt added and how many
+// it topped up.
+func receiptSummary(added, toppedUp int) string {
+	items := func(n int) string {
+		if n == 1 {
+			return "1 item"
+		}
+		return fmt.Sprintf("%d items", n)
+	}
+	switch {
+	case toppedUp == 0:
+		return "Added " + items(added) + " from the receipt."
+	case added == 0:
+		return "Topped up " + items(toppedUp) + " from the receipt."
+	}
+	return "Added " + items(added) + " and topped up " + items(toppedUp) + " from the receipt."
+}
+
+// loadKnownProducts returns what a household stocks now or has used up or
+// binned before, newest first, for naming and filing receipt lines.
+func loadKnownProducts(householdID int) ([]PantryItem, error) {
+	store, err := loadStore(householdID)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT name, category FROM removals
+		WHERE household_id = ? AND item_type = 'pantry'
+		GROUP BY name
+		ORDER BY MAX(id) DESC`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := store.PantryItems
+	for rows.Next() {
+		var item PantryItem
+		if err := rows.Scan(&item.Name, &item.Category); err != nil {
+			return nil, err
+		}
+		known = append(known, item)
+	}
+	return known, rows.Err()
+}
+
+// saveReceipt saves a store with a receipt's items added and records their
+// purchases in the same transaction.
+func saveReceipt(householdID int, store *Store, purchases []Purchase) (err error) {
+	defer observeDB("save_receipt", time.Now(), &err)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
+		return err
+	}
+	for _, p := range purchases {
+		if _, err := tx.Exec(
+			"INSERT INTO purchases (household_id, pantry_item_id, price, currency, store, date, quantity) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			householdID, p.PantryItemID, p.Price.Amount, p.Price.Currency, p.Store, p.Date, p.Quantity,
+		); err != nil {
+			return err
+		}
+	}
+	return commitAndPublish(tx, events)
+}
+
+// receiptPage is the data for the receipt import page: the upload form, or
+// the lines to review once a receipt has been read.
+type receiptPage struct {
+	Lines []receiptLine
+	Shop  string
+	Date  string
+	Error string
+}
+
+func receiptHandler(w http.ResponseWriter, r *http.Request) {
+	render(w, r, "receipt.html", receiptPage{Date: today()})
+}
+
+// reviewReceiptHandler reads an uploaded receipt ("file") or pasted text
+// ("text") and shows its lines for review.
+func reviewReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/pantry/receipt", http.StatusSeeOther)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecipeUpload)
+	if err := r.ParseMultipartForm(maxRecipeUpload); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Upload too large or malformed", http.StatusBadRequest)
+		return
+	}
+	name, data := "pasted.txt", []byte(r.FormValue("text"))
+	if r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0 {
+		fh := r.MultipartForm.File["file"][0]
+		f, err := fh.Open()
+		if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return
+		}
+		data, err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return
+		}
+		name = fh.Filename
+	}
+	page := receiptPage{Shop: strings.TrimSpace(r.FormValue("shop")), Date: r.FormValue("date")}
+	if page.Date == "" {
+		page.Date = today()
+	}
+	lines, err := parseReceipt(name, data)
+	if err != nil {
+		page.Error = "Could not read the receipt: " + err.Error() + "."
+		renderStatus(w, r, http.StatusUnprocessableEntity, "receipt.html", page)
+		return
+	}
+	known, err := loadKnownProducts(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	guessReceiptItems(lines, known)
+	page.Lines = lines
+	render(w, r, "receipt.html", page)
+}
+
+// addReceiptHandler adds the reviewed lines that are still ticked. Line i is
+// posted as "keep-i", "name-i", "quantity-i", "category-i", "expiry-i" and
+// "price-i", with "lines" the number of lines. A line for something already
+// stocked tops that item up rather than adding another. Nothing is added
+// unless every kept line is valid.
+func addReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/pantry/receipt", http.StatusSeeOther)
+		return
+	}
+	n, err := strconv.Atoi(r.FormValue("lines"))
+	if err != nil || n < 0 || n > 500 {
+		http.Error(w, "Invalid or missing lines", http.StatusBadRequest)
+		return
+	}
+	hh := householdID(r)
+	store, err := loadStore(hh)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	page := receiptPage{Shop: strings.TrimSpace(r.FormValue("shop")), Date: strings.TrimSpace(r.FormValue("date"))}
+	dateErrs := fieldErrors{}
+	dateErrs.checkDate("date", "Date", page.Date)
+	if page.Date == "" {
+		page.Date = today()
+	}
+	var purchases []Purchase
+	added, toppedUp := 0, 0
+	invalid := len(dateErrs) > 0
+	if invalid {
+		page.Error = dateErrs["date"]
+	}
+	for i := range n {
+		key := func(field string) string { return r.FormValue(field + "-" + strconv.Itoa(i)) }
+		line := receiptLine{
+			Raw:      key("raw"),
+			Name:     key("name"),
+			Quantity: key("quantity"),
+			Category: key("category"),
+			Expiry:   key("expiry"),
+			Price:    strings.TrimSpace(key("price")),
+			Known:    key("known"),
+			Keep:     key("keep") != "",
+		}
+		page.Lines = append(page.Lines, line)
+		if !line.Keep {
+			continue
+		}
+		item := PantryItem{Name: line.Name, Quantity: line.Quantity, Category: line.Category, Expiry: line.Expiry}
+		errs := validatePantryItem(&item)
+		var price int64
+		if line.Price != "" {
+			var err error
+			price, err = parsePrice(line.Price)
+			errs.check(err == nil, "price", "Price must be an amount like 2.49.")
+		}
+		if len(errs) > 0 {
+			page.Lines[i].Errors = errs
+			invalid = true
+			continue
+		}
+		if j := receiptTarget(store, line, item); j >= 0 {
+			existing := &store.PantryItems[j]
+			topUp(existing, item)
+			item.ID = existing.ID
+			toppedUp++
+		} else {
+			item.ID = store.NextPantryID
+			store.NextPantryID++
+			store.PantryItems = append(store.PantryItems, item)
+			added++
+		}
+		if line.Price != "" {
+			purchases = append(purchases, Purchase{
+				PantryItemID: item.ID,
+				Price:        Money{Amount: price, Currency: config.Currency},
+				Store:        page.Shop,
+				Date:         page.Date,
+				Quantity:     item.Quantity,
+			})
+		}
+	}
+	if added+toppedUp == 0 && !invalid {
+		page.Error = "Tick at least one line to add."
+		invalid = true
+	}
+	if invalid {
+		renderStatus(w, r, http.StatusUnprocessableEntity, "receipt.html", page)
+		return
+	}
+	if err := saveReceipt(hh, store, purchases); err != nil {
+		saveFailed(w, r, "/", err)
+		return
+	}
+	addFlash(w, r, flashSuccess, receiptSummary(added, toppedUp))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
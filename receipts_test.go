@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseReceiptLine(t *testing.T) {
+	tests := []struct {
+		line, name, quantity, price string
+	}{
+		{"HEINZ BAKED BEANS 4X415G     3.50", "Heinz Baked Beans", "4", "3.50"},
+		{"2 x SEMI SKIMMED MILK 2PT  £2.30 A", "Semi Skimmed Milk", "2272 ml", "2.30"},
+		{"BANANAS 0.845kg @ £0.94/kg  0.79", "Bananas", "0.85 kg", "0.79"},
+		{"Basmati Rice 1KG 2.10", "Basmati Rice", "1 kg", "2.10"},
+		{"CASHEW NUTS 200G 2.75", "Cashew Nuts", "200 g", "2.75"},
+	}
+	for _, tt := range tests {
+		line, ok := parseReceiptLine(tt.line)
+		if !ok {
+			t.Errorf("%q: expected a line", tt.line)
+			continue
+		}
+		if line.Name != tt.name || line.Quantity != tt.quantity || line.Price != tt.price {
+			t.Errorf("%q: got %q, %q, %q", tt.line, line.Name, line.Quantity, line.Price)
+		}
+	}
+	for _, skip := range []string{
+		"TOTAL            12.50",
+		"CLUBCARD PRICE  -0.50",
+		"MULTIBUY SAVING  0.50-",
+		"VISA DEBIT       12.00",
+		"Tesco Stores Ltd",
+		"12/03/2025 14:02",
+	} {
+		if line, ok := parseReceiptLine(skip); ok {
+			t.Errorf("%q: expected it to be skipped, got %+v", skip, line)
+		}
+	}
+}
+
+func TestParseCSVReceipt(t *testing.T) {
+	data := "Product,Qty,Price\nChopped Tomatoes 400g,3,1.05\nPromotion,1,-0.50\nPlain Flour 1.5kg,,0.95\n"
+	lines, err := parseReceipt("order.csv", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %+v", lines)
+	}
+	if lines[0].Name != "Chopped Tomatoes" || lines[0].Quantity != "1200 g" || lines[0].Price != "1.05" {
+		t.Errorf("unexpected first line: %+v", lines[0])
+	}
+	if lines[1].Quantity != "1.5 kg" {
+		t.Errorf("expected the pack size with no quantity column value, got %+v", lines[1])
+	}
+
+	if _, err := parseReceipt("order.csv", []byte("SKU,Price\n123,1.00\n")); err == nil {
+		t.Error("expected an error for a CSV without a description column")
+	}
+}
+
+func TestGuessReceiptItems(t *testing.T) {
+	lines := []receiptLine{{Name: "Heinz Baked Beans"}, {Name: "Plain Flour"}, {Name: "Mystery Thing"}}
+	guessReceiptItems(lines, []PantryItem{{Name: "Baked Beans", Category: "Canned Goods"}})
+	if lines[0].Name != "Baked Beans" || lines[0].Category != "Canned Goods" || lines[0].Known != "Baked Beans" {
+		t.Errorf("expected the beans to take the stocked item's name and category, got %+v", lines[0])
+	}
+	if lines[1].Category != "Baking" || lines[1].Known != "" {
+		t.Errorf("expected flour to be filed under Baking from the catalogue, got %+v", lines[1])
+	}
+	if lines[2].Category != "" {
+		t.Errorf("expected no guess for an unknown product, got %+v", lines[2])
+	}
+}
+
+func TestReceiptHandlers(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Basmati Rice", Category: "Dry Goods"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(reviewReceiptHandler, "/pantry/receipt/review", url.Values{"text": {"BASMATI RICE 1KG  2.10\nTOTAL  2.10"}, "shop": {"Corner Shop"}})
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `value="Basmati Rice"`) || !strings.Contains(body, "matches Basmati Rice") {
+		t.Errorf("expected a review of the rice line, got %d", w.Code)
+	}
+	if w := postForm(reviewReceiptHandler, "/pantry/receipt/review", url.Values{"text": {"nothing here"}}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unreadable receipt, got %d", w.Code)
+	}
+
+	form := url.Values{
+		"lines": {"3"}, "shop": {"Corner Shop"}, "date": {"2025-03-01"},
+		"keep-0": {"1"}, "name-0": {"Basmati Rice"}, "quantity-0": {"1 kg"}, "category-0": {"Dry Goods"}, "price-0": {"2.10"},
+		"keep-1": {"1"}, "name-1": {""}, "quantity-1": {"1"},
+		"name-2": {"Skipped"}, "quantity-2": {"1"},
+	}
+	w = postForm(addReceiptHandler, "/pantry/receipt/add", form)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Name is required") {
+		t.Fatalf("expected 422 for a kept line without a name, got %d", w.Code)
+	}
+	if store, _ := loadStore(defaultHouseholdID); len(store.PantryItems) != 1 {
+		t.Fatalf("expected nothing added when a line is invalid, got %+v", store.PantryItems)
+	}
+
+	form.Set("name-1", "Oat Milk")
+	if w := postForm(addReceiptHandler, "/pantry/receipt/add", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.PantryItems) != 2 {
+		t.Fatalf("expected the rice topped up, the milk added and the unticked line skipped, got %+v", store.PantryItems)
+	}
+	if rice := store.PantryItems[pantryIndex(store, 1)]; rice.Quantity != "1 kg" {
+		t.Errorf("expected the stocked rice topped up, got %+v", rice)
+	}
+	purchases, err := loadPurchases(defaultHouseholdID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purchases) != 1 || purchases[0].PantryItemID != 1 || purchases[0].Store != "Corner Shop" || purchases[0].Date != "2025-03-01" || purchases[0].Price.Amount != 210 {
+		t.Errorf("expected the rice's price recorded against the stocked item, got %+v", purchases)
+	}
+}
+
+func TestReceiptTopsUpStockedItems(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Baked Beans", Quantity: "2 cans", Category: "Canned Goods"}},
+		NextPantryID: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first line is matched with the stocked beans, as the review page
+	// does; the second is the same again without the match.
+	form := url.Values{
+		"lines": {"2"}, "date": {"2025-03-01"},
+		"keep-0": {"1"}, "name-0": {"Baked Beans"}, "quantity-0": {"1 can"}, "known-0": {"Baked Beans"}, "price-0": {"0.80"},
+		"keep-1": {"1"}, "name-1": {"baked beans"}, "quantity-1": {"1 can"},
+	}
+	if w := postForm(addReceiptHandler, "/pantry/receipt/add", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	store, _ := loadStore(defaultHouseholdID)
+	if len(store.PantryItems) != 1 || store.PantryItems[0].Quantity != "4 cans" {
+		t.Fatalf("expected the beans topped up to 4 cans and no second item, got %+v", store.PantryItems)
+	}
+	if purchases, _ := loadPurchases(defaultHouseholdID, 0); len(purchases) != 1 || purchases[0].PantryItemID != 1 {
+		t.Errorf("expected the price recorded against the stocked beans, got %+v", purchases)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// parseRecipe imports a recipe from a file's contents. The format is chosen
+// from the file extension and falls back to sniffing the content: JSON and
+// HTML pages are read as schema.org Recipe JSON-LD, anything else as Markdown.
+func parseRecipe(filename string, data []byte) (*Recipe, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".jsonld", ".html", ".htm":
+		return parseJSONLDRecipe(data)
+	case ".md", ".markdown", ".txt":
+		return parseMarkdownRecipe(data)
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") ||
+		strings.Contains(trimmed, "application/ld+json") {
+		return parseJSONLDRecipe(data)
+	}
+	return parseMarkdownRecipe(data)
+}
+
+var ldScriptRe = regexp.MustCompile(`(?is)<script[^>]*type=["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// parseJSONLDRecipe reads the first schema.org Recipe found in data, which may
+// be a bare JSON-LD document or an HTML page with ld+json script blocks.
+func parseJSONLDRecipe(data []byte) (*Recipe, error) {
+	docs := [][]byte{data}
+	if matches := ldScriptRe.FindAllSubmatch(data, -1); len(matches) > 0 {
+		docs = docs[:0]
+		for _, m := range matches {
+			docs = append(docs, m[1])
+		}
+	}
+	for _, doc := range docs {
+		var v any
+		if err := json.Unmarshal(doc, &v); err != nil {
+			continue
+		}
+		if obj := findRecipeObject(v); obj != nil {
+			return recipeFromJSONLD(obj)
+		}
+	}
+	return nil, errors.New("no schema.org Recipe found")
+}
+
+// findRecipeObject walks a decoded JSON-LD value (objects, arrays and @graph
+// containers) looking for a node whose @type is or includes "Recipe".
+func findRecipeObject(v any) map[string]any {
+	switch v := v.(type) {
+	case []any:
+		for _, el := range v {
+			if obj := findRecipeObject(el); obj != nil {
+				return obj
+			}
+		}
+	case map[string]any:
+		if hasJSONLDType(v["@type"], "Recipe") {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findRecipeObject(graph)
+		}
+	}
+	return nil
+}
+
+func hasJSONLDType(t any, want string) bool {
+	switch t := t.(type) {
+	case string:
+		return t == want || strings.HasSuffix(t, "/"+want)
+	case []any:
+		for _, el := range t {
+			if hasJSONLDType(el, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func recipeFromJSONLD(obj map[string]any) (*Recipe, error) {
+	recipe := &Recipe{
+		Name:     jsonLDText(obj["name"]),
+		Servings: jsonLDText(obj["recipeYield"]),
+		Source:   jsonLDText(obj["url"]),
+	}
+	if recipe.Name == "" {
+		return nil, errors.New("recipe has no name")
+	}
+	lines := jsonLDStrings(obj["recipeIngredient"])
+	if len(lines) == 0 {
+		lines = jsonLDStrings(obj["ingredients"])
+	}
+	for _, line := range lines {
+		if ing, ok := parseIngredientLine(line); ok {
+			recipe.Ingredients = append(recipe.Ingredients, ing)
+		}
+	}
+	recipe.Instructions = strings.Join(jsonLDInstructions(obj["recipeInstructions"]), "\n")
+	return recipe, nil
+}
+
+// jsonLDText returns a single display string for a JSON-LD value. Arrays use
+// their first element, which is how sites usually repeat recipeYield.
+func jsonLDText(v any) string {
+	switch v := v.(type) {
+	case string:
+		return cleanText(v)
+	case float64:
+		return formatAmount(v)
+	case []any:
+		if len(v) > 0 {
+			return jsonLDText(v[0])
+		}
+	case map[string]any:
+		if s := jsonLDText(v["@id"]); s != "" {
+			return s
+		}
+		return jsonLDText(v["name"])
+	}
+	return ""
+}
+
+func jsonLDStrings(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(v, "\n") {
+			if line = cleanText(line); line != "" {
+				out = append(out, line)
+			}
+		}
+	case []any:
+		for _, el := range v {
+			out = append(out, jsonLDStrings(el)...)
+		}
+	}
+	return out
+}
+
+// jsonLDInstructions flattens recipeInstructions, which may be plain text, a
+// list of strings, HowToStep objects or HowToSection objects of steps.
+func jsonLDInstructions(v any) []string {
+	switch v := v.(type) {
+	case string, float64:
+		return jsonLDStrings(v)
+	case []any:
+		var out []string
+		for _, el := range v {
+			out = append(out, jsonLDInstructions(el)...)
+		}
+		return out
+	case map[string]any:
+		if items, ok := v["itemListElement"]; ok {
+			return jsonLDInstructions(items)
+		}
+		if text := jsonLDText(v["text"]); text != "" {
+			return []string{text}
+		}
+		return jsonLDStrings(v["name"])
+	}
+	return nil
+}
+
+var (
+	tagRe        = regexp.MustCompile(`<[^>]*>`)
+	spacePunctRe = regexp.MustCompile(`\s+([.,;:!?])`)
+)
+
+// cleanText strips HTML tags and entities, which recipe sites often leave in
+// JSON-LD strings, and collapses whitespace.
+func cleanText(s string) string {
+	s = html.UnescapeString(tagRe.ReplaceAllString(s, " "))
+	return spacePunctRe.ReplaceAllString(strings.Join(strings.Fields(s), " "), "$1")
+}
+
+// parseMarkdownRecipe reads the simple Markdown recipe format:
+//
+//	# Chilli con carne
+//	Serves: 4
+//	Source: https://example.com/chilli
+//
+//	## Ingredients
+//	- 500 g beef mince
+//	- 1 tin kidney beans
+//
+//	## Method
+//	1. Brown the mince.
+//
+// The title is the first level-one heading. "Serves", "Servings", "Yield" and
+// "Source" lines set metadata; list items under an Ingredients heading are
+// ingredients and everything under Method, Instructions, Directions or Steps
+// is kept as the instructions.
+func parseMarkdownRecipe(data []byte) (*Recipe, error) {
+	recipe := &Recipe{}
+	var section string
+	var instructions []string
+	for _, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "# ") && recipe.Name == "":
+			recipe.Name = strings.TrimSpace(line[2:])
+			continue
+		case strings.HasPrefix(line, "#"):
+			heading := strings.ToLower(strings.TrimSpace(strings.TrimLeft(line, "#")))
+			switch {
+			case strings.HasPrefix(heading, "ingredient"):
+				section = "ingredients"
+			case strings.HasPrefix(heading, "method"), strings.HasPrefix(heading, "instruction"),
+				strings.HasPrefix(heading, "direction"), strings.HasPrefix(heading, "step"):
+				section = "method"
+			default:
+				section = ""
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && section == "" {
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "serves", "servings", "yield", "makes":
+				recipe.Servings = strings.TrimSpace(value)
+				continue
+			case "source", "url":
+				recipe.Source = strings.TrimSpace(value)
+				continue
+			}
+		}
+		switch section {
+		case "ingredients":
+			if ing, ok := parseIngredientLine(line); ok {
+				recipe.Ingredients = append(recipe.Ingredients, ing)
+			}
+		case "method":
+			instructions = append(instructions, stripListMarker(line))
+		}
+	}
+	if recipe.Name == "" {
+		return nil, errors.New("markdown recipe has no '# Title' heading")
+	}
+	recipe.Instructions = strings.Join(instructions, "\n")
+	return recipe, nil
+}
+
+var listMarkerRe = regexp.MustCompile(`^(?:[-*+•]|\d+[.)])(?:\s+|$)`)
+
+func stripListMarker(line string) string {
+	return listMarkerRe.ReplaceAllString(strings.TrimSpace(line), "")
+}
+
+// parseIngredientLine splits an ingredient line such as "2 x 400g tins chopped
+// tomatoes, drained" into amount (2), unit (can), name ("chopped tomatoes")
+// and note ("400g, drained"). Lines without an amount keep only a name.
+func parseIngredientLine(line string) (RecipeIngredient, bool) {
+	line = cleanText(stripListMarker(line))
+	if line == "" {
+		return RecipeIngredient{}, false
+	}
+	ing := RecipeIngredient{Raw: line}
+	rest := line
+	var notes []string
+	if amount, after, ok := parseAmount(rest); ok {
+		ing.Amount = amount
+		rest = after
+		// Multipacks: "2 x 400g tins" counts tins and notes the size.
+		if trimmed := strings.TrimLeft(rest, " "); strings.HasPrefix(trimmed, "x ") || strings.HasPrefix(trimmed, "×") {
+			trimmed = strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(trimmed, "x"), "×"), " ")
+			if size, after, ok := parseAmount(trimmed); ok {
+				sizeUnit, after := parseUnit(after)
+				notes = append(notes, Quantity{Amount: size, Unit: sizeUnit}.String())
+				rest = after
+			}
+		}
+		ing.Unit, rest = parseUnit(rest)
+	}
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "of "))
+	if i := strings.IndexAny(rest, ",("); i > 0 {
+		notes = append(notes, strings.Trim(strings.TrimSpace(rest[i:]), ",() "))
+		rest = strings.TrimSpace(rest[:i])
+	}
+	ing.Name = rest
+	ing.Note = strings.Join(notes, ", ")
+	if ing.Name == "" {
+		ing.Name = line
+	}
+	return ing, true
+}
+
+// matchIngredients links each ingredient to the most similar pantry item,
+// leaving PantryItemID zero for anything below matchThreshold. It returns the
+// number of unmatched ingredients.
+func matchIngredients(recipe *Recipe, items []PantryItem) int {
+	unmatched := 0
+	for i := range recipe.Ingredients {
+		ing := &recipe.Ingredients[i]
+		item, score, ok := bestPantryMatch(ing.Name, items)
+		if !ok {
+			ing.PantryItemID, ing.MatchScore = 0, 0
+			unmatched++
+			continue
+		}
+		ing.PantryItemID, ing.MatchScore = item.ID, score
+	}
+	return unmatched
+}
+
+// AmountString formats the ingredient's amount and unit for display.
+func (ing RecipeIngredient) AmountString() string {
+	if ing.Amount == 0 {
+		return ""
+	}
+	return Quantity{Amount: ing.Amount, Unit: ing.Unit}.String()
+}
+
+// describeImport summarises an import for the command line.
+func describeImport(recipe *Recipe, unmatched int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Imported %q (%d ingredients, %d unmatched)\n", recipe.Name, len(recipe.Ingredients), unmatched)
+	for _, ing := range recipe.Ingredients {
+		if ing.PantryItemID == 0 {
+			fmt.Fprintf(&b, "  needs review: %s\n", ing.Raw)
+		}
+	}
+	return b.String()
+}
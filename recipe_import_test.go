@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIngredientLine(t *testing.T) {
+	cases := []struct {
+		line   string
+		amount float64
+		unit   string
+		name   string
+		note   string
+	}{
+		{"500 g beef mince", 500, "g", "beef mince", ""},
+		{"- 2 large onions, finely chopped", 2, "", "large onions", "finely chopped"},
+		{"1 tin of kidney beans", 1, "can", "kidney beans", ""},
+		{"2 x 400g tins chopped tomatoes", 2, "can", "chopped tomatoes", "400 g"},
+		{"1/2 tsp chilli flakes", 0.5, "tsp", "chilli flakes", ""},
+		{"Salt and pepper", 0, "", "Salt and pepper", ""},
+		{"3 cloves garlic (crushed)", 3, "clove", "garlic", "crushed"},
+	}
+	for _, c := range cases {
+		ing, ok := parseIngredientLine(c.line)
+		if !ok {
+			t.Errorf("parseIngredientLine(%q) failed", c.line)
+			continue
+		}
+		if ing.Amount != c.amount || ing.Unit != c.unit || ing.Name != c.name || ing.Note != c.note {
+			t.Errorf("parseIngredientLine(%q) = %+v", c.line, ing)
+		}
+	}
+	if _, ok := parseIngredientLine("  - "); ok {
+		t.Error("blank line should not produce an ingredient")
+	}
+}
+
+const jsonLDPage = `<html><head>
+<script type="application/ld+json">
+{"@context":"https://schema.org","@graph":[
+  {"@type":"WebPage","name":"Ignore me"},
+  {"@type":["Recipe"],"name":"Chilli &amp; Rice","recipeYield":["4","4 servings"],
+   "url":"https://example.com/chilli",
+   "recipeIngredient":["500g beef mince","1 tin kidney beans","200 g basmati rice"],
+   "recipeInstructions":[{"@type":"HowToSection","itemListElement":[
+     {"@type":"HowToStep","text":"Brown the mince."},
+     {"@type":"HowToStep","text":"Add the <b>beans</b>."}]}]}
+]}
+</script></head><body></body></html>`
+
+func TestParseJSONLDRecipe(t *testing.T) {
+	recipe, err := parseRecipe("chilli.html", []byte(jsonLDPage))
+	if err != nil {
+		t.Fatalf("parseRecipe: %v", err)
+	}
+	if recipe.Name != "Chilli & Rice" {
+		t.Errorf("unexpected name %q", recipe.Name)
+	}
+	if recipe.Servings != "4" || recipe.Source != "https://example.com/chilli" {
+		t.Errorf("unexpected metadata: %+v", recipe)
+	}
+	if len(recipe.Ingredients) != 3 {
+		t.Fatalf("expected 3 ingredients, got %d", len(recipe.Ingredients))
+	}
+	if recipe.Instructions != "Brown the mince.\nAdd the beans." {
+		t.Errorf("unexpected instructions %q", recipe.Instructions)
+	}
+}
+
+func TestParseJSONLDRecipeMissing(t *testing.T) {
+	if _, err := parseRecipe("page.json", []byte(`{"@type":"Person","name":"x"}`)); err == nil {
+		t.Error("expected an error when there is no Recipe")
+	}
+}
+
+func TestParseMarkdownRecipe(t *testing.T) {
+	md := "# Pancakes\nServes: 2\nSource: grandma\n\n## Ingredients\n- 100 g plain flour\n- 2 eggs\n- 300 ml milk\n\n## Method\n1. Whisk everything.\n2. Fry.\n"
+	recipe, err := parseRecipe("pancakes.md", []byte(md))
+	if err != nil {
+		t.Fatalf("parseRecipe: %v", err)
+	}
+	if recipe.Name != "Pancakes" || recipe.Servings != "2" || recipe.Source != "grandma" {
+		t.Errorf("unexpected metadata: %+v", recipe)
+	}
+	if len(recipe.Ingredients) != 3 || recipe.Ingredients[2].Unit != "ml" {
+		t.Errorf("unexpected ingredients: %+v", recipe.Ingredients)
+	}
+	if recipe.Instructions != "Whisk everything.\nFry." {
+		t.Errorf("unexpected instructions %q", recipe.Instructions)
+	}
+}
+
+func TestParseMarkdownRecipeNoTitle(t *testing.T) {
+	if _, err := parseRecipe("x.md", []byte("## Ingredients\n- 1 egg\n")); err == nil {
+		t.Error("expected an error for a recipe without a title")
+	}
+}
+
+func TestMatchIngredients(t *testing.T) {
+	recipe := &Recipe{Ingredients: []RecipeIngredient{
+		{Name: "kidney beans"},
+		{Name: "saffron"},
+	}}
+	items := []PantryItem{{ID: 7, Name: "Kidney Beans"}, {ID: 8, Name: "Rice"}}
+	if unmatched := matchIngredients(recipe, items); unmatched != 1 {
+		t.Errorf("expected 1 unmatched, got %d", unmatched)
+	}
+	if recipe.Ingredients[0].PantryItemID != 7 {
+		t.Errorf("kidney beans should match item 7, got %d", recipe.Ingredients[0].PantryItemID)
+	}
+	if recipe.Ingredients[1].PantryItemID != 0 {
+		t.Error("saffron should be left unmatched")
+	}
+	if report := describeImport(recipe, 1); !strings.Contains(report, "needs review") {
+		t.Errorf("report should list unmatched lines: %q", report)
+	}
+}
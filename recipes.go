@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRecipeUpload caps the size of a recipe import request.
+const maxRecipeUpload = 10 << 20
+
+func insertRecipe(householdID int, recipe *Recipe) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO recipes (name, servings, source, instructions, household_id) VALUES (?, ?, ?, ?, ?)",
+		recipe.Name, recipe.Servings, recipe.Source, recipe.Instructions, householdID,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	recipe.ID = int(id)
+	for i := range recipe.Ingredients {
+		ing := &recipe.Ingredients[i]
+		ing.RecipeID = recipe.ID
+		res, err := tx.Exec(
+			`INSERT INTO recipe_ingredients (recipe_id, position, raw, amount, unit, name, note, pantry_item_id, match_score)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			ing.RecipeID, i, ing.Raw, ing.Amount, ing.Unit, ing.Name, ing.Note, ing.PantryItemID, ing.MatchScore,
+		)
+		if err != nil {
+			return err
+		}
+		ingID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		ing.ID = int(ingID)
+	}
+	return tx.Commit()
+}
+
+// loadRecipes returns a household's recipes with their ingredients, sorted
+// by name.
+func loadRecipes(householdID int) ([]Recipe, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name, servings, source, instructions FROM recipes WHERE household_id = ? ORDER BY name COLLATE NOCASE", householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	recipes := []Recipe{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var r Recipe
+		if err := rows.Scan(&r.ID, &r.Name, &r.Servings, &r.Source, &r.Instructions); err != nil {
+			return nil, err
+		}
+		index[r.ID] = len(recipes)
+		recipes = append(recipes, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ingredients, err := queryIngredients(db, "WHERE recipe_id IN (SELECT id FROM recipes WHERE household_id = ?)", householdID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ing := range ingredients {
+		if i, ok := index[ing.RecipeID]; ok {
+			recipes[i].Ingredients = append(recipes[i].Ingredients, ing)
+		}
+	}
+	return recipes, nil
+}
+
+// loadRecipe returns one recipe with its ingredients, or nil if the household
+// has no recipe with that ID.
+func loadRecipe(householdID, id int) (*Recipe, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	r := &Recipe{}
+	err = db.QueryRow("SELECT id, name, servings, source, instructions FROM recipes WHERE id = ? AND household_id = ?", id, householdID).
+		Scan(&r.ID, &r.Name, &r.Servings, &r.Source, &r.Instructions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Ingredients, err = queryIngredients(db, "WHERE recipe_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func queryIngredients(db *sql.DB, where string, args ...any) ([]RecipeIngredient, error) {
+	rows, err := db.Query(
+		`SELECT id, recipe_id, raw, amount, unit, name, note, pantry_item_id, match_score
+		 FROM recipe_ingredients `+where+` ORDER BY recipe_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []RecipeIngredient
+	for rows.Next() {
+		var ing RecipeIngredient
+		if err := rows.Scan(&ing.ID, &ing.RecipeID, &ing.Raw, &ing.Amount, &ing.Unit, &ing.Name,
+			&ing.Note, &ing.PantryItemID, &ing.MatchScore); err != nil {
+			return nil, err
+		}
+		out = append(out, ing)
+	}
+	return out, rows.Err()
+}
+
+// errNotInHousehold is returned when a change refers to a record that
+// belongs to a different household.
+var errNotInHousehold = errors.New("not found in this household")
+
+// setIngredientMatch links an ingredient to a pantry item by hand. A
+// pantryItemID of zero clears the match. Both the recipe and the item must
+// belong to the household.
+func setIngredientMatch(householdID, recipeID, ingredientID, pantryItemID int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM recipes WHERE id = ? AND household_id = ?", recipeID, householdID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotInHousehold
+	}
+	if pantryItemID != 0 {
+		if err := db.QueryRow("SELECT COUNT(*) FROM pantry_items WHERE id = ? AND household_id = ?", pantryItemID, householdID).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return errNotInHousehold
+		}
+	}
+
+	score := 0.0
+	if pantryItemID != 0 {
+		score = 1
+	}
+	_, err = db.Exec(
+		"UPDATE recipe_ingredients SET pantry_item_id = ?, match_score = ? WHERE id = ? AND recipe_id = ?",
+		pantryItemID, score, ingredientID, recipeID,
+	)
+	return err
+}
+
+func deleteRecipe(householdID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM recipe_ingredients WHERE recipe_id IN (SELECT id FROM recipes WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recipes WHERE id = ? AND household_id = ?", id, householdID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// importRecipe parses a recipe file, matches its ingredients against the
+// household's pantry and stores it. It returns the stored recipe and the number of
+// ingredients left for review.
+func importRecipe(householdID int, filename string, data []byte) (*Recipe, int, error) {
+	recipe, err := parseRecipe(filename, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	store, err := loadStore(householdID)
+	if err != nil {
+		return nil, 0, err
+	}
+	unmatched := matchIngredients(recipe, store.PantryItems)
+	if err := insertRecipe(householdID, recipe); err != nil {
+		return nil, 0, err
+	}
+	return recipe, unmatched, nil
+}
+
+// UnmatchedCount is the number of ingredients not linked to a pantry item.
+func (r Recipe) UnmatchedCount() int {
+	n := 0
+	for _, ing := range r.Ingredients {
+		if ing.PantryItemID == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// recipePage is the data for the recipe review page.
+type recipePage struct {
+	Recipe      *Recipe
+	PantryItems []PantryItem
+}
+
+// Steps splits the instructions into one entry per line.
+func (r Recipe) Steps() []string {
+	if r.Instructions == "" {
+		return nil
+	}
+	return strings.Split(r.Instructions, "\n")
+}
+
+func recipesHandler(w http.ResponseWriter, r *http.Request) {
+	recipes, err := loadRecipes(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "recipes.html", recipes)
+}
+
+func recipeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	recipe, err := loadRecipe(householdID(r), id)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	if recipe == nil {
+		http.NotFound(w, r)
+		return
+	}
+	store, err := loadStore(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(store.PantryItems, func(i, j int) bool {
+		return strings.ToLower(store.PantryItems[i].Name) < strings.ToLower(store.PantryItems[j].Name)
+	})
+	page := recipePage{Recipe: recipe, PantryItems: store.PantryItems}
+	render(w, r, "recipe.html", page)
+}
+
+// importRecipeHandler accepts uploaded recipe files ("files") and/or pasted
+// text ("text", with "format" of "markdown" or "jsonld").
+func importRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecipeUpload)
+	if err := r.ParseMultipartForm(maxRecipeUpload); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Upload too large or malformed", http.StatusBadRequest)
+		return
+	}
+
+	type upload struct {
+		name string
+		data []byte
+	}
+	var uploads []upload
+	if r.MultipartForm != nil {
+		for _, fh := range r.MultipartForm.File["files"] {
+			f, err := fh.Open()
+			if err != nil {
+				http.Error(w, "Failed to read upload", http.StatusBadRequest)
+				return
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				http.Error(w, "Failed to read upload", http.StatusBadRequest)
+				return
+			}
+			uploads = append(uploads, upload{fh.Filename, data})
+		}
+	}
+	if text := strings.TrimSpace(r.FormValue("text")); text != "" {
+		name := "pasted.md"
+		if r.FormValue("format") == "jsonld" {
+			name = "pasted.json"
+		}
+		uploads = append(uploads, upload{name, []byte(text)})
+	}
+	if len(uploads) == 0 {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+
+	var last *Recipe
+	for _, u := range uploads {
+		recipe, _, err := importRecipe(householdID(r), u.name, u.data)
+		if err != nil {
+			http.Error(w, "Could not import "+u.name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		last = recipe
+	}
+	if len(uploads) == 1 {
+		http.Redirect(w, r, "/recipes/view?id="+strconv.Itoa(last.ID), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+}
+
+func matchIngredientHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	recipeID, err := strconv.Atoi(r.FormValue("recipe_id"))
+	if err != nil {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	ingredientID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	// An empty or invalid selection clears the match.
+	itemID, _ := strconv.Atoi(r.FormValue("pantry_item_id"))
+	err = setIngredientMatch(householdID(r), recipeID, ingredientID, itemID)
+	if errors.Is(err, errNotInHousehold) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		saveFailed(w, r, "/recipes/view?id="+strconv.Itoa(recipeID), err)
+		return
+	}
+	http.Redirect(w, r, "/recipes/view?id="+strconv.Itoa(recipeID), http.StatusSeeOther)
+}
+
+func deleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+		return
+	}
+	if err := deleteRecipe(householdID(r), id); err != nil {
+		saveFailed(w, r, "/recipes", err)
+		return
+	}
+	http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+}
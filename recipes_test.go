@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestImportRecipeHandlerPastedMarkdown(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Plain Flour"}},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 2,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{
+		"text":   {"# Pancakes\n## Ingredients\n- 100 g plain flour\n- 1 pinch saffron\n"},
+		"format": {"markdown"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/recipes/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	importRecipeHandler(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d: %s", w.Code, w.Body.String())
+	}
+	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "/recipes/view?id=") {
+		t.Errorf("expected redirect to the review page, got %q", loc)
+	}
+
+	recipes, err := loadRecipes(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes) != 1 || len(recipes[0].Ingredients) != 2 {
+		t.Fatalf("unexpected recipes: %+v", recipes)
+	}
+	if recipes[0].Ingredients[0].PantryItemID != 1 {
+		t.Errorf("flour should match pantry item 1: %+v", recipes[0].Ingredients[0])
+	}
+	if recipes[0].UnmatchedCount() != 1 {
+		t.Errorf("expected 1 ingredient to review, got %d", recipes[0].UnmatchedCount())
+	}
+}
+
+func TestImportRecipeHandlerBadInput(t *testing.T) {
+	setupHandlerTest(t)
+
+	form := url.Values{"text": {`{"@type":"Person"}`}, "format": {"jsonld"}}
+	req := httptest.NewRequest(http.MethodPost, "/recipes/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	importRecipeHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestRecipeHandlerShowsReview(t *testing.T) {
+	setupHandlerTest(t)
+
+	recipe := &Recipe{Name: "Toast", Ingredients: []RecipeIngredient{{Raw: "2 slices bread", Name: "bread"}}}
+	if err := insertRecipe(defaultHouseholdID, recipe); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/recipes/view?id=1", nil)
+	w := httptest.NewRecorder()
+	recipeHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Not matched") {
+		t.Error("unmatched ingredient should be flagged for review")
+	}
+}
+
+func TestRecipeHandlerNotFound(t *testing.T) {
+	setupHandlerTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/recipes/view?id=42", nil)
+	w := httptest.NewRecorder()
+	recipeHandler(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestMatchIngredientHandler(t *testing.T) {
+	setupHandlerTest(t)
+
+	recipe := &Recipe{Name: "Toast", Ingredients: []RecipeIngredient{{Raw: "bread", Name: "bread"}}}
+	if err := insertRecipe(defaultHouseholdID, recipe); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 9, Name: "Bread"}},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 10,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"recipe_id": {"1"}, "id": {"1"}, "pantry_item_id": {"9"}}
+	req := httptest.NewRequest(http.MethodPost, "/recipes/match", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	matchIngredientHandler(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("expected 303, got %d", w.Code)
+	}
+	loaded, err := loadRecipe(defaultHouseholdID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Ingredients[0].PantryItemID != 9 {
+		t.Errorf("expected ingredient matched to 9, got %d", loaded.Ingredients[0].PantryItemID)
+	}
+}
+
+func TestDeleteRecipeHandler(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := insertRecipe(defaultHouseholdID, &Recipe{Name: "Gone", Ingredients: []RecipeIngredient{{Name: "x"}}}); err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{"id": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/recipes/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	deleteRecipeHandler(w, req)
+
+	recipes, err := loadRecipes(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes) != 0 {
+		t.Errorf("expected recipe to be deleted, got %d", len(recipes))
+	}
+}
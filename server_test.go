@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	setupHandlerTest(t)
+
+	// Public, so a load balancer needs no login.
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	dbFile = filepath.Join(t.TempDir(), "missing", "data.db")
+	w = httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the database can't be opened, got %d", w.Code)
+	}
+}
+
+func TestRunServerDrainsOnShutdown(t *testing.T) {
+	useTempDB(t)
+	t.Cleanup(func() {
+		shuttingDown.Store(false)
+		itemEvents = newEventHub()
+	})
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+		close(finished)
+	})
+	srv := newServer("127.0.0.1:0", handler)
+	if srv.ReadTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 {
+		t.Error("expected the server to have timeouts")
+	}
+
+	// Find a free port so the request knows where to go.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Addr = ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runServer(ctx, srv) }()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			resp, err := http.Get("http://" + srv.Addr)
+			if err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never took the request")
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("expected the in-flight request to finish before shutdown returned")
+	}
+	if !shuttingDown.Load() {
+		t.Error("expected the health check to report shutting down")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// loadShoppingList returns a household's list with outstanding lines first.
+func loadShoppingList(householdID int) ([]ShoppingItem, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name, quantity, source, done FROM shopping_list WHERE household_id = ? ORDER BY done, id", householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ShoppingItem{}
+	for rows.Next() {
+		var item ShoppingItem
+		if err := rows.Scan(&item.ID, &item.Name, &item.Quantity, &item.Source, &item.Done); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// mergeShoppingItems adds lines to the shopping list. A line for a product
+// already outstanding from the same source replaces that line's quantity
+// rather than adding a duplicate, so regenerating a list is idempotent.
+func mergeShoppingItems(householdID int, items []ShoppingItem) error {
+	existing, err := loadShoppingList(householdID)
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		id := 0
+		for _, e := range existing {
+			if !e.Done && e.Source == item.Source && normalizeName(e.Name) == normalizeName(item.Name) {
+				id = e.ID
+				break
+			}
+		}
+		if id != 0 {
+			if _, err := tx.Exec("UPDATE shopping_list SET quantity = ? WHERE id = ?", item.Quantity, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO shopping_list (name, quantity, source, done, household_id) VALUES (?, ?, ?, 0, ?)",
+			item.Name, item.Quantity, item.Source, householdID,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func execShopping(query string, args ...any) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(query, args...)
+	return err
+}
+
+func shoppingHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := loadShoppingList(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "shopping.html", items)
+}
+
+func addShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	if err := execShopping(
+		"INSERT INTO shopping_list (name, quantity, source, done, household_id) VALUES (?, ?, '', 0, ?)",
+		name, strings.TrimSpace(r.FormValue("quantity")), householdID(r),
+	); err != nil {
+		saveFailed(w, r, "/shopping", err)
+		return
+	}
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
+
+func toggleShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	if err := execShopping("UPDATE shopping_list SET done = 1 - done WHERE id = ? AND household_id = ?", id, householdID(r)); err != nil {
+		saveFailed(w, r, "/shopping", err)
+		return
+	}
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
+
+func deleteShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	if err := execShopping("DELETE FROM shopping_list WHERE id = ? AND household_id = ?", id, householdID(r)); err != nil {
+		saveFailed(w, r, "/shopping", err)
+		return
+	}
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
+
+// clearShoppingHandler removes all ticked-off lines.
+func clearShoppingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+	if err := execShopping("DELETE FROM shopping_list WHERE done = 1 AND household_id = ?", householdID(r)); err != nil {
+		saveFailed(w, r, "/shopping", err)
+		return
+	}
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMergeShoppingItemsIsIdempotent(t *testing.T) {
+	useTempDB(t)
+
+	lines := []ShoppingItem{{Name: "Rice", Quantity: "100 g", Source: shortfallSource}}
+	if err := mergeShoppingItems(defaultHouseholdID, lines); err != nil {
+		t.Fatal(err)
+	}
+	lines[0].Quantity = "200 g"
+	if err := mergeShoppingItems(defaultHouseholdID, lines); err != nil {
+		t.Fatal(err)
+	}
+	items, err := loadShoppingList(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Quantity != "200 g" {
+		t.Errorf("expected one updated line, got %+v", items)
+	}
+}
+
+func TestShoppingHandlersAddToggleClear(t *testing.T) {
+	setupHandlerTest(t)
+
+	post := func(h http.HandlerFunc, form url.Values) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("expected 303, got %d", w.Code)
+		}
+	}
+
+	post(addShoppingHandler, url.Values{"name": {"Milk"}, "quantity": {"2 l"}})
+	post(addShoppingHandler, url.Values{"name": {""}})
+	items, _ := loadShoppingList(defaultHouseholdID)
+	if len(items) != 1 || items[0].Name != "Milk" {
+		t.Fatalf("expected one line, got %+v", items)
+	}
+
+	post(toggleShoppingHandler, url.Values{"id": {"1"}})
+	items, _ = loadShoppingList(defaultHouseholdID)
+	if !items[0].Done {
+		t.Error("line should be ticked off")
+	}
+
+	post(clearShoppingHandler, url.Values{})
+	items, _ = loadShoppingList(defaultHouseholdID)
+	if len(items) != 0 {
+		t.Errorf("ticked lines should be cleared, got %+v", items)
+	}
+}
+
+func TestShoppingHandlerRenders(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := mergeShoppingItems(defaultHouseholdID, []ShoppingItem{{Name: "Eggs", Quantity: "6"}}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/shopping", nil)
+	w := httptest.NewRecorder()
+	shoppingHandler(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Eggs") {
+		t.Errorf("expected the list to render, got %d", w.Code)
+	}
+}
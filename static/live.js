@@ -0,0 +1,157 @@
+// Live updates. On the inventory page this listens to /events for items
+// created, changed or deleted elsewhere, such as on another phone, and
+// patches their cards in place from a fresh copy of the page. Where
+// Server-Sent Events aren't available, or the stream gives up, the page is
+// checked every minute instead.
+(function () {
+    'use strict';
+
+    const POLL_INTERVAL = 60 * 1000;
+    // Events tend to come in bursts, such as a receipt adding a dozen items,
+    // so they are gathered up before the page is fetched.
+    const DEBOUNCE = 300;
+
+    const main = document.querySelector('main[data-inventory]');
+    if (!main) return;
+
+    const cardSelector = '.item-card[data-kind][data-id]';
+    const key = card => card.dataset.kind + ':' + card.dataset.id;
+
+    let pending = new Set();
+    let refreshAll = false;
+    let timer = null;
+    let fetching = false;
+
+    // queue asks for the cards with the given keys to be refreshed, or all of
+    // them if none are given.
+    function queue(keys) {
+        if (keys) keys.forEach(k => pending.add(k));
+        else refreshAll = true;
+        clearTimeout(timer);
+        timer = setTimeout(refresh, DEBOUNCE);
+    }
+
+    function refresh() {
+        if (fetching) {
+            timer = setTimeout(refresh, DEBOUNCE);
+            return;
+        }
+        const keys = refreshAll ? null : pending;
+        pending = new Set();
+        refreshAll = false;
+        fetching = true;
+        fetch(location.href, {credentials: 'same-origin', headers: {'Accept': 'text/html'}})
+            .then(res => {
+                // A lapsed session redirects to the login page.
+                if (!res.ok || res.redirected) throw new Error('inventory unavailable');
+                return res.text();
+            })
+            .then(html => {
+                const fresh = new DOMParser().parseFromString(html, 'text/html');
+                if (fresh.querySelector('main[data-inventory]')) patch(fresh, keys);
+            })
+            .catch(() => {})
+            .finally(() => { fetching = false; });
+    }
+
+    // patch brings the cards with the given keys, or every card that differs,
+    // up to date with fresh. Cards with offline changes still waiting to sync
+    // are left alone.
+    function patch(fresh, keys) {
+        for (const kind of ['pantry', 'freezer']) {
+            const list = main.querySelector('section.' + kind + ' .items-list');
+            const freshList = fresh.querySelector('section.' + kind + ' .items-list');
+            if (!list || !freshList) continue;
+
+            const current = new Map();
+            list.querySelectorAll(cardSelector).forEach(c => current.set(key(c), c));
+            const wanted = new Map();
+            freshList.querySelectorAll(cardSelector).forEach(c => wanted.set(key(c), c));
+
+            let changed = false;
+            current.forEach((card, k) => {
+                if (wanted.has(k) || (keys && !keys.has(k)) || card.classList.contains('item-pending')) return;
+                card.remove();
+                changed = true;
+            });
+            let prev = null;
+            wanted.forEach((freshCard, k) => {
+                const card = current.get(k);
+                const due = keys ? keys.has(k) : !card || card.dataset.version !== freshCard.dataset.version;
+                if (card && card.classList.contains('item-pending')) {
+                    prev = card;
+                    return;
+                }
+                if (!due) {
+                    if (card) prev = card;
+                    return;
+                }
+                const copy = document.importNode(freshCard, true);
+                copy.classList.add('item-live');
+                if (card) {
+                    card.replaceWith(copy);
+                } else if (prev) {
+                    prev.after(copy);
+                } else {
+                    list.prepend(copy);
+                }
+                prev = copy;
+                changed = true;
+            });
+            if (!changed) continue;
+
+            // Keep the count and the empty message in step with the cards.
+            const count = main.querySelector('section.' + kind + ' .item-count');
+            const freshCount = fresh.querySelector('section.' + kind + ' .item-count');
+            if (count && freshCount) count.textContent = freshCount.textContent;
+            const empty = list.querySelector('.empty-state');
+            const freshEmpty = freshList.querySelector('.empty-state');
+            if (list.querySelector(cardSelector)) {
+                if (empty) empty.remove();
+            } else if (!empty && freshEmpty) {
+                list.append(document.importNode(freshEmpty, true));
+            }
+        }
+    }
+
+    // ── Polling ──
+    let polling = null;
+
+    function startPolling() {
+        if (polling) return;
+        polling = setInterval(() => {
+            if (!document.hidden && navigator.onLine) queue(null);
+        }, POLL_INTERVAL);
+    }
+
+    if (!window.EventSource) {
+        startPolling();
+        return;
+    }
+
+    // ── Events ──
+    const source = new EventSource('/events');
+    let dropped = false;
+
+    source.addEventListener('item', e => {
+        let ev;
+        try {
+            ev = JSON.parse(e.data);
+        } catch (err) {
+            return;
+        }
+        queue([ev.kind + ':' + ev.id]);
+    });
+    // Events sent while the stream was down were missed, so everything is
+    // checked once it reconnects.
+    source.addEventListener('open', () => {
+        if (dropped) queue(null);
+        dropped = false;
+    });
+    source.addEventListener('error', () => {
+        dropped = true;
+        // The browser retries on its own unless the server refused the
+        // stream outright.
+        if (source.readyState === EventSource.CLOSED) startPolling();
+    });
+})();
@@ -0,0 +1,453 @@
+// Offline mode. On every page this registers the service worker, which keeps
+// the pages and static files for use without a connection. On the inventory
+// page it also keeps a copy of the inventory in IndexedDB, queues the adds,
+// edits and deletes made while offline in an outbox, and replays them
+// through /api/sync when the connection comes back. A change made to an item
+// that has since changed elsewhere comes back as a conflict, which is shown
+// for the user to settle.
+(function () {
+    'use strict';
+
+    const DB_NAME = 'cupboard';
+    const PAGE_CACHE = 'cupboard-pages';
+    const SYNCED_KEY = 'cupboard-synced';
+
+    if ('serviceWorker' in navigator) {
+        navigator.serviceWorker.register('/sw.js').catch(() => {});
+    }
+
+    // Logging out forgets the offline copies, so the next person to use the
+    // device doesn't see them. A lapsed session only forgets the pages, as
+    // the outbox may hold changes not yet synced.
+    document.addEventListener('submit', e => {
+        if (e.target.getAttribute('action') === '/logout') {
+            if (window.caches) caches.delete(PAGE_CACHE);
+            if (window.indexedDB) indexedDB.deleteDatabase(DB_NAME);
+        }
+    }, true);
+    if (location.pathname === '/login' && window.caches) {
+        caches.delete(PAGE_CACHE);
+    }
+
+    const main = document.querySelector('main[data-inventory]');
+    if (!main || !window.indexedDB) return;
+    const household = Number(main.dataset.household);
+
+    // ── IndexedDB ──
+    // "inventory" holds the last snapshot from the server for each
+    // household; "outbox" holds changes waiting to be synced, in order.
+    function openDB() {
+        return new Promise((resolve, reject) => {
+            const req = indexedDB.open(DB_NAME, 1);
+            req.onupgradeneeded = () => {
+                req.result.createObjectStore('inventory');
+                req.result.createObjectStore('outbox', {keyPath: 'seq', autoIncrement: true});
+            };
+            req.onsuccess = () => resolve(req.result);
+            req.onerror = () => reject(req.error);
+        });
+    }
+
+    // withStore runs fn on an object store in a transaction, resolving with
+    // the result of the request fn returns, if any, once it commits.
+    function withStore(name, mode, fn) {
+        return openDB().then(db => new Promise((resolve, reject) => {
+            const tx = db.transaction(name, mode);
+            const req = fn(tx.objectStore(name));
+            tx.oncomplete = () => { db.close(); resolve(req ? req.result : undefined); };
+            tx.onerror = () => { db.close(); reject(tx.error); };
+        }));
+    }
+
+    function outbox() {
+        return withStore('outbox', 'readonly', store => store.getAll())
+            .then(entries => entries.filter(e => e.household === household));
+    }
+
+    function loadSnapshot() {
+        return withStore('inventory', 'readonly', store => store.get(household));
+    }
+
+    function saveSnapshot(body) {
+        const snapshot = {
+            pantry: body.pantry,
+            freezer: body.freezer,
+            locations: body.locations,
+            saved: new Date().toISOString(),
+        };
+        return withStore('inventory', 'readwrite', store => store.put(snapshot, household))
+            .then(() => snapshot);
+    }
+
+    // ── Server ──
+    function csrfToken() {
+        const meta = document.querySelector('meta[name="csrf-token"]');
+        return meta ? meta.content : '';
+    }
+
+    // api calls /api/sync. A lapsed session redirects to the login page,
+    // which isn't JSON, so it fails like a lost connection and the outbox
+    // is kept.
+    function api(options) {
+        return fetch('/api/sync', Object.assign({credentials: 'same-origin'}, options)).then(res => {
+            if (!res.ok || res.redirected) throw new Error('sync failed: ' + res.status);
+            return res.json();
+        });
+    }
+
+    function refreshSnapshot() {
+        return api({}).then(saveSnapshot);
+    }
+
+    // ── Queueing changes ──
+    const ACTIONS = {
+        '/pantry/add': ['create', 'pantry'],
+        '/pantry/edit': ['update', 'pantry'],
+        '/pantry/delete': ['delete', 'pantry'],
+        '/freezer/add': ['create', 'freezer'],
+        '/freezer/edit': ['update', 'freezer'],
+        '/freezer/delete': ['delete', 'freezer'],
+    };
+
+    // queueChange adds a change to the outbox, folding it into one already
+    // queued for the same item: an edit to something added offline becomes
+    // part of adding it, and deleting it forgets it altogether. A repeated
+    // edit replaces the earlier one but keeps the version it started from.
+    function queueChange(change) {
+        return outbox().then(entries => {
+            const same = entries.filter(e => e.change.type === change.type && e.change.item_id === change.item_id);
+            const create = same.find(e => e.change.op === 'create');
+            const update = same.find(e => e.change.op === 'update');
+            return withStore('outbox', 'readwrite', store => {
+                if (create) {
+                    if (change.op === 'delete') return store.delete(create.seq);
+                    create.change[change.type] = change[change.type];
+                    return store.put(create);
+                }
+                if (update) {
+                    if (change.op === 'update') {
+                        update.change[change.type] = change[change.type];
+                        return store.put(update);
+                    }
+                    change.version = update.change.version;
+                    store.delete(update.seq);
+                }
+                return store.add({household: household, change: change});
+            });
+        });
+    }
+
+    function parsePlace(value) {
+        const i = value.indexOf(':');
+        const id = parseInt(i < 0 ? value : value.slice(0, i), 10);
+        return id > 0 ? [id, value.slice(i + 1)] : [0, ''];
+    }
+
+    // itemFromForm reads an add or edit form as the JSON the API takes.
+    function itemFromForm(form, type) {
+        const data = new FormData(form);
+        const text = name => (data.get(name) || '').toString().trim();
+        const tags = data.getAll('allergen')
+            .concat(text('tags').split(','))
+            .map(t => t.trim())
+            .filter(Boolean);
+        const [locationID, position] = parsePlace(text('place'));
+        const item = {name: text('name'), tags: tags, location_id: locationID, position: position};
+        if (type === 'pantry') {
+            Object.assign(item, {
+                quantity: text('quantity'),
+                category: text('category'),
+                expiry: text('expiry'),
+                notes: text('notes'),
+            });
+        } else {
+            Object.assign(item, {
+                portions: text('portions'),
+                date_frozen: text('date_frozen'),
+                description: text('description'),
+            });
+        }
+        return item;
+    }
+
+    function findCard(type, id) {
+        return main.querySelector('.item-card[data-kind="' + type + '"][data-id="' + id + '"]');
+    }
+
+    let lastTempID = 0;
+
+    // tempID names an item added offline until the server gives it an ID.
+    // Negative numbers can't clash with real IDs.
+    function tempID() {
+        lastTempID = Math.min(lastTempID - 1, -Date.now());
+        return lastTempID;
+    }
+
+    document.addEventListener('submit', e => {
+        const form = e.target;
+        const action = ACTIONS[form.getAttribute('action')];
+        if (!action || navigator.onLine) return;
+        e.preventDefault();
+        const [op, type] = action;
+        const change = {op: op, type: type};
+        if (op === 'create') {
+            change.item_id = tempID();
+        } else {
+            const data = new FormData(form);
+            change.item_id = Number(data.get('id'));
+            const card = findCard(type, change.item_id);
+            change.version = Number(data.get('version')) || (card ? Number(card.dataset.version) : 0);
+        }
+        if (op === 'delete') {
+            change.outcome = e.submitter ? e.submitter.value : '';
+        } else {
+            change[type] = itemFromForm(form, type);
+        }
+        queueChange(change).then(() => {
+            const overlay = form.closest('.modal-overlay');
+            if (overlay && window.closeModal) window.closeModal(overlay.id);
+            if (op === 'create') form.reset();
+            return loadSnapshot();
+        }).then(snapshot => {
+            patchCard(change, snapshot);
+            showStatus();
+        }).catch(err => showBanner('error', '⚠️ Couldn\'t save that change on this device: ' + err.message));
+    });
+
+    // ── Showing queued changes ──
+    function el(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) node.className = className;
+        if (text) node.textContent = text;
+        return node;
+    }
+
+    function describePlace(snapshot, id, position) {
+        const loc = snapshot && (snapshot.locations || []).find(l => l.id === id);
+        if (!loc) return '';
+        return position ? loc.name + ' › ' + position : loc.name;
+    }
+
+    // patchCard shows a queued change on the page, as the page won't be
+    // rendered again until it has synced.
+    function patchCard(change, snapshot) {
+        let card = findCard(change.type, change.item_id);
+        if (change.op === 'delete') {
+            if (card) card.remove();
+            return;
+        }
+        if (!card) {
+            if (change.op !== 'create') return;
+            card = newCard(change.type, change.item_id);
+            const list = main.querySelector('section.' + change.type + ' .items-list');
+            const empty = list.querySelector('.empty-state');
+            if (empty) empty.remove();
+            list.prepend(card);
+        }
+        fillCard(card, change.type, change[change.type], snapshot);
+    }
+
+    function newCard(type, id) {
+        const card = el('div', 'item-card');
+        card.dataset.kind = type;
+        card.dataset.id = id;
+        card.dataset.version = 0;
+        const header = el('div', 'item-header');
+        header.append(el('span', 'item-name'));
+        const actions = el('div', 'item-actions');
+        const edit = el('button', 'btn btn-warning btn-sm', '✏️');
+        edit.title = 'Edit';
+        edit.addEventListener('click', () => type === 'pantry' ? editPantryFromBtn(edit) : editFreezerFromBtn(edit));
+        const del = el('button', 'btn btn-danger btn-sm', '🗑️');
+        del.title = 'Delete';
+        del.addEventListener('click', () => type === 'pantry' ? deletePantryFromBtn(del) : deleteFreezerFromBtn(del));
+        actions.append(edit, del);
+        header.append(actions);
+        card.append(header, el('div', 'item-meta'));
+        return card;
+    }
+
+    // fillCard writes an item into its card and into the data its edit
+    // button fills the edit form from.
+    function fillCard(card, type, item, snapshot) {
+        card.classList.add('item-pending');
+        card.querySelector('.item-name').textContent = item.name;
+        const [edit, del] = card.querySelectorAll('.item-actions button');
+        edit.dataset.id = del.dataset.id = card.dataset.id;
+        edit.dataset.name = del.dataset.name = item.name;
+        edit.dataset.tags = item.tags.join(',');
+        edit.dataset.place = item.location_id ? item.location_id + ':' + item.position : '';
+        const meta = card.querySelector('.item-meta');
+        meta.replaceChildren();
+        if (type === 'pantry') {
+            Object.assign(edit.dataset, {
+                quantity: item.quantity, category: item.category, expiry: item.expiry, notes: item.notes,
+            });
+            if (item.category) meta.append(el('span', 'cat-badge', item.category));
+            if (item.quantity) meta.append(el('span', 'badge badge-qty', '📦 ' + item.quantity));
+        } else {
+            Object.assign(edit.dataset, {
+                portions: item.portions, dateFrozen: item.date_frozen, description: item.description,
+            });
+            if (item.portions) meta.append(el('span', 'badge badge-portions', '🍽️ ' + item.portions + ' portions'));
+        }
+        const place = describePlace(snapshot, item.location_id, item.position);
+        if (place) meta.append(el('span', 'badge badge-place', '📍 ' + place));
+        item.tags.forEach(t => meta.append(el('span', 'badge badge-tag', '🏷️ ' + t)));
+        if (item.expiry) meta.append(el('span', 'badge badge-expiry-ok', '📅 ' + item.expiry));
+        meta.append(el('span', 'badge badge-pending', '⏳ Not synced yet'));
+        const notes = card.querySelector('.item-notes');
+        if (notes) notes.textContent = type === 'pantry' ? item.notes : item.description;
+    }
+
+    // ── Status and conflicts ──
+    let banner;
+
+    function showBanner(kind, message) {
+        if (!banner) {
+            banner = el('div', 'offline-banner');
+            banner.setAttribute('role', 'status');
+            main.prepend(banner);
+        }
+        banner.className = 'offline-banner offline-banner-' + kind;
+        banner.replaceChildren(el('p', '', message));
+        return banner;
+    }
+
+    function hideBanner() {
+        if (banner) banner.remove();
+        banner = null;
+    }
+
+    function plural(n, word) {
+        return n + ' ' + word + (n === 1 ? '' : 's');
+    }
+
+    function showStatus() {
+        return Promise.all([outbox(), loadSnapshot()]).then(([entries, snapshot]) => {
+            const waiting = entries.length ? ' ' + plural(entries.length, 'change') + ' waiting to sync.' : '';
+            if (!navigator.onLine) {
+                const saved = snapshot ? ' Showing the inventory as of ' + new Date(snapshot.saved).toLocaleString() + '.' : '';
+                showBanner('offline', '📴 You\'re offline. Changes are kept on this device and sync when you\'re back online.' + saved + waiting);
+            } else if (entries.length) {
+                const b = showBanner('pending', '⏳' + waiting);
+                const retry = el('button', 'btn btn-sm', 'Sync now');
+                retry.type = 'button';
+                retry.addEventListener('click', sync);
+                b.append(retry);
+            } else if (banner && !banner.classList.contains('offline-banner-problem')) {
+                hideBanner();
+            }
+        });
+    }
+
+    const FIELDS = {
+        pantry: [['name', 'Name'], ['quantity', 'Quantity'], ['category', 'Category'], ['expiry', 'Expiry'], ['notes', 'Notes']],
+        freezer: [['name', 'Name'], ['portions', 'Portions'], ['date_frozen', 'Date frozen'], ['description', 'Description']],
+    };
+
+    // differences lists the fields where mine and theirs disagree.
+    function differences(type, mine, theirs) {
+        return FIELDS[type]
+            .filter(([key]) => (mine[key] || '') !== (theirs[key] || ''))
+            .map(([key, label]) => label + ': yours “' + (mine[key] || '—') + '”, now “' + (theirs[key] || '—') + '”');
+    }
+
+    // showProblems lists the changes the server didn't apply. A conflicting
+    // change can be kept anyway, which queues it again against the server's
+    // current version, or dropped in favour of the server's copy.
+    function showProblems(problems) {
+        const b = showBanner('problem', '⚠️ Some changes made offline couldn\'t be synced:');
+        const list = el('ul');
+        problems.forEach(({entry, result}) => {
+            const change = entry.change;
+            const theirs = result[change.type];
+            const name = (change[change.type] || theirs || {}).name || 'An item';
+            const li = el('li');
+            if (result.status === 'conflict') {
+                li.append(el('strong', '', name), ' was changed elsewhere while you were offline. ');
+                if (change.op === 'delete') {
+                    li.append('You deleted it. ');
+                } else {
+                    const diff = differences(change.type, change[change.type], theirs);
+                    if (diff.length) li.append(el('span', 'conflict-diff', diff.join('; ') + '. '));
+                }
+                const mine = el('button', 'btn btn-primary btn-sm', change.op === 'delete' ? 'Delete it anyway' : 'Keep mine');
+                mine.type = 'button';
+                mine.addEventListener('click', () => {
+                    li.remove();
+                    const again = Object.assign({}, change, {version: theirs.version});
+                    queueChange(again).then(sync);
+                });
+                const keep = el('button', 'btn btn-sm', 'Keep theirs');
+                keep.type = 'button';
+                keep.addEventListener('click', () => li.remove());
+                li.append(mine, ' ', keep);
+            } else if (result.status === 'missing') {
+                li.append(el('strong', '', name), ' had already been removed, so your change was dropped.');
+            } else {
+                const why = result.error || Object.values(result.fields || {}).join(' ');
+                li.append(el('strong', '', name), ' wasn\'t saved: ' + why);
+            }
+            list.append(li);
+        });
+        const reload = el('button', 'btn btn-sm', 'Reload');
+        reload.type = 'button';
+        reload.addEventListener('click', () => location.reload());
+        b.append(list, reload);
+    }
+
+    // ── Syncing ──
+    let syncing = false;
+
+    // sync sends the outbox to the server. Whatever the outcome of each
+    // change, it leaves the outbox, so one the server refuses doesn't block
+    // the rest; refusals are shown instead. If the request itself fails, the
+    // outbox is kept for next time.
+    function sync() {
+        if (syncing || !navigator.onLine) return Promise.resolve();
+        syncing = true;
+        return outbox().then(entries => {
+            if (!entries.length) return refreshSnapshot();
+            const changes = entries.map(e => Object.assign({id: String(e.seq)}, e.change));
+            return api({
+                method: 'POST',
+                headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken()},
+                body: JSON.stringify({changes: changes}),
+            }).then(body => withStore('outbox', 'readwrite', store => {
+                entries.forEach(e => store.delete(e.seq));
+            }).then(() => saveSnapshot(body)).then(() => {
+                const problems = [];
+                let applied = 0;
+                body.results.forEach((result, i) => {
+                    if (result.status === 'applied') applied++;
+                    else problems.push({entry: entries[i], result: result});
+                });
+                if (problems.length) {
+                    showProblems(problems);
+                } else if (applied && !document.querySelector('.modal-overlay.active')) {
+                    sessionStorage.setItem(SYNCED_KEY, applied);
+                    location.reload();
+                } else {
+                    showBanner('synced', '✅ Synced ' + plural(applied, 'change') + ' made offline. Reload to see them.');
+                }
+            }));
+        }).catch(() => showStatus()).finally(() => { syncing = false; });
+    }
+
+    window.addEventListener('online', sync);
+    window.addEventListener('offline', showStatus);
+
+    const synced = sessionStorage.getItem(SYNCED_KEY);
+    if (synced) {
+        sessionStorage.removeItem(SYNCED_KEY);
+        showBanner('synced', '✅ Synced ' + plural(Number(synced), 'change') + ' made offline.');
+    }
+
+    // A page shown from the cache predates the queued changes, so they are
+    // shown on it until they sync.
+    Promise.all([outbox(), loadSnapshot()]).then(([entries, snapshot]) => {
+        entries.forEach(e => patchCard(e.change, snapshot));
+        return showStatus();
+    }).then(sync);
+})();
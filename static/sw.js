@@ -0,0 +1,78 @@
+// Service worker for using the inventory without a connection. The server
+// serves this file at /sw.js with ASSETS, the content-hashed URLs of the
+// files the inventory page needs, defined above this line.
+//
+// Static files are served from the cache, as their URLs change with their
+// contents. Pages are fetched from the network and cached as they load, so
+// the last copy of the inventory can be shown offline. Changes made offline
+// are queued by offline.js, not here.
+
+const STATIC_CACHE = 'cupboard-static';
+const PAGE_CACHE = 'cupboard-pages';
+
+self.addEventListener('install', event => {
+    event.waitUntil(
+        caches.open(STATIC_CACHE)
+            .then(cache => cache.addAll(ASSETS))
+            .then(() => self.skipWaiting())
+    );
+});
+
+// Drops static files no longer linked from the pages; their hashed URLs
+// will never be asked for again.
+self.addEventListener('activate', event => {
+    event.waitUntil(
+        caches.open(STATIC_CACHE)
+            .then(cache => cache.keys().then(requests => Promise.all(
+                requests
+                    .filter(req => !ASSETS.includes(new URL(req.url).pathname))
+                    .map(req => cache.delete(req))
+            )))
+            .then(() => self.clients.claim())
+    );
+});
+
+self.addEventListener('fetch', event => {
+    const req = event.request;
+    const url = new URL(req.url);
+    if (req.method !== 'GET' || url.origin !== self.location.origin) {
+        return;
+    }
+    if (url.pathname.startsWith('/static/')) {
+        event.respondWith(cacheFirst(req));
+    } else if (req.mode === 'navigate') {
+        event.respondWith(networkFirst(req));
+    }
+});
+
+function cacheFirst(req) {
+    return caches.match(req).then(cached => cached || fetch(req).then(res => {
+        if (res.ok) {
+            const copy = res.clone();
+            caches.open(STATIC_CACHE).then(cache => cache.put(req, copy));
+        }
+        return res;
+    }));
+}
+
+// networkFirst fetches a page, keeping a copy for when there is no
+// connection. Offline, a page never visited falls back to the inventory.
+function networkFirst(req) {
+    return fetch(req).then(res => {
+        // A redirect to the login page isn't the page that was asked for.
+        if (res.ok && !res.redirected) {
+            const copy = res.clone();
+            caches.open(PAGE_CACHE).then(cache => cache.put(req, copy));
+        }
+        return res;
+    }).catch(() => caches.open(PAGE_CACHE).then(cache =>
+        cache.match(req)
+            .then(cached => cached || cache.match('/', {ignoreSearch: true}))
+            .then(cached => cached || new Response(
+                '<!DOCTYPE html><meta name="viewport" content="width=device-width"><title>Offline</title>' +
+                '<p style="font-family:sans-serif;padding:2rem">You\'re offline, and this page hasn\'t been saved for offline use. ' +
+                'Open the inventory while online to keep a copy.</p>',
+                {status: 503, headers: {'Content-Type': 'text/html; charset=utf-8'}}
+            ))
+    ));
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Removal outcomes. A removal without one, such as an item added by mistake,
+// isn't logged.
+const (
+	outcomeEaten  = "eaten"
+	outcomeBinned = "binned"
+)
+
+// removalOutcome reads the posted outcome of a delete. It writes a 400 and
+// returns false for anything but eaten, binned or none.
+func removalOutcome(w http.ResponseWriter, r *http.Request) (string, bool) {
+	outcome := r.FormValue("outcome")
+	if outcome != "" && outcome != outcomeEaten && outcome != outcomeBinned {
+		http.Error(w, "Outcome must be eaten or binned", http.StatusBadRequest)
+		return "", false
+	}
+	return outcome, true
+}
+
+// pantryRemoval describes taking item out of the pantry, with value its
+// worth from its price history, if any.
+func pantryRemoval(item PantryItem, outcome string, value Money, now time.Time) *Removal {
+	if outcome == "" {
+		return nil
+	}
+	return &Removal{
+		ItemType: "pantry",
+		Name:     item.Name,
+		Quantity: item.Quantity,
+		Category: item.Category,
+		Expiry:   item.Expiry,
+		Outcome:  outcome,
+		Date:     now.Format("2006-01-02"),
+		Value:    value,
+	}
+}
+
+func freezerRemoval(meal FreezerMeal, outcome string, now time.Time) *Removal {
+	if outcome == "" {
+		return nil
+	}
+	return &Removal{
+		ItemType: "freezer",
+		Name:     meal.Name,
+		Quantity: meal.Portions,
+		Category: "Freezer meal",
+		Outcome:  outcome,
+		Date:     now.Format("2006-01-02"),
+	}
+}
+
+// PastExpiry reports whether the item had passed its expiry date when it was
+// removed.
+func (rm Removal) PastExpiry() bool {
+	return rm.Expiry != "" && rm.Expiry < rm.Date
+}
+
+// saveRemoval saves a store that has had items taken out and logs what
+// became of each in the same transaction. Nil removals aren't logged.
+func saveRemoval(householdID int, store *Store, rms ...*Removal) (err error) {
+	defer observeDB("save_removal", time.Now(), &err)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
+		return err
+	}
+	for _, rm := range rms {
+		if rm == nil {
+			continue
+		}
+		_, err := tx.Exec(
+			"INSERT INTO removals (household_id, item_type, name, quantity, category, expiry, outcome, date, value, currency) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			householdID, rm.ItemType, rm.Name, rm.Quantity, rm.Category, rm.Expiry, rm.Outcome, rm.Date, rm.Value.Amount, rm.Value.Currency,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return commitAndPublish(tx, events)
+}
+
+// loadWasteLog returns a household's most recently binned items.
+func loadWasteLog(householdID, limit int) ([]Removal, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, item_type, name, quantity, category, expiry, outcome, date, value, currency
+		FROM removals
+		WHERE household_id = ? AND outcome = ?
+		ORDER BY date DESC, id DESC
+		LIMIT ?`, householdID, outcomeBinned, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	removals := []Removal{}
+	for rows.Next() {
+		var rm Removal
+		if err := rows.Scan(&rm.ID, &rm.ItemType, &rm.Name, &rm.Quantity, &rm.Category, &rm.Expiry, &rm.Outcome, &rm.Date, &rm.Value.Amount, &rm.Value.Currency); err != nil {
+			return nil, err
+		}
+		removals = append(removals, rm)
+	}
+	return removals, rows.Err()
+}
+
+// removalTotals is how many removals there were and what they were worth.
+type removalTotals struct {
+	Count int
+	Value moneyTotals
+}
+
+// monthlyRemovals totals a household's removals by month ("2006-01") and
+// outcome, from the given date on.
+func monthlyRemovals(householdID int, since string) (map[string]map[string]*removalTotals, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT substr(date, 1, 7), outcome, currency, COUNT(*), SUM(value)
+		FROM removals
+		WHERE household_id = ? AND date >= ?
+		GROUP BY 1, 2, 3`, householdID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := make(map[string]map[string]*removalTotals)
+	for rows.Next() {
+		var month, outcome, currency string
+		var n int
+		var value int64
+		if err := rows.Scan(&month, &outcome, &currency, &n, &value); err != nil {
+			return nil, err
+		}
+		if totals[month] == nil {
+			totals[month] = map[string]*removalTotals{
+				outcomeEaten:  {Value: moneyTotals{}},
+				outcomeBinned: {Value: moneyTotals{}},
+			}
+		}
+		t, ok := totals[month][outcome]
+		if !ok {
+			continue
+		}
+		t.Count += n
+		t.Value.add(Money{Amount: value, Currency: currency})
+	}
+	return totals, rows.Err()
+}
+
+// Chart geometry, in SVG user units.
+const (
+	chartWidth      = 480
+	chartLabelWidth = 140
+	chartBarSpace   = 280
+	chartRowHeight  = 28
+	chartBarHeight  = 18
+)
+
+// chart is a horizontal bar chart rendered as SVG by the "chart" template.
+// Each row is one bar, made of one or more stacked segments.
+type chart struct {
+	Title  string
+	Width  int
+	Height int
+	LabelX int
+	Rows   []chartRow
+}
+
+type chartRow struct {
+	Label    string
+	Segments []chartSegment
+	// TotalText is shown after the bar; newChart fills it with the total
+	// unless it is already set.
+	TotalText string
+	// Set by newChart.
+	Total  int
+	TextY  int
+	TotalX float64
+}
+
+type chartSegment struct {
+	Label string
+	Value int
+	Class string
+	// Text is shown on hover in place of Value if set.
+	Text string
+	// Set by newChart.
+	X, Y, Width float64
+}
+
+// newChart lays out rows as bars scaled to the largest row total.
+func newChart(title string, rows []chartRow) chart {
+	most := 0
+	for i := range rows {
+		rows[i].Total = 0
+		for _, seg := range rows[i].Segments {
+			rows[i].Total += seg.Value
+		}
+		most = max(most, rows[i].Total)
+	}
+	for i := range rows {
+		row := &rows[i]
+		y := i * chartRowHeight
+		row.TextY = y + chartBarHeight - 4
+		x := float64(chartLabelWidth)
+		for j := range row.Segments {
+			seg := &row.Segments[j]
+			seg.X = x
+			seg.Y = float64(y)
+			if most > 0 {
+				seg.Width = roundTenth(float64(seg.Value) / float64(most) * chartBarSpace)
+			}
+			x += seg.Width
+		}
+		row.TotalX = roundTenth(x + 6)
+		if row.TotalText == "" {
+			row.TotalText = strconv.Itoa(row.Total)
+		}
+		for j := range row.Segments {
+			if row.Segments[j].Text == "" {
+				row.Segments[j].Text = strconv.Itoa(row.Segments[j].Value)
+			}
+		}
+	}
+	return chart{
+		Title:  title,
+		Width:  chartWidth,
+		Height: max(len(rows)*chartRowHeight, chartRowHeight),
+		LabelX: chartLabelWidth - 8,
+		Rows:   rows,
+	}
+}
+
+func roundTenth(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// statsPage is the data for the statistics dashboard.
+type statsPage struct {
+	PantryCount      int
+	FreezerCount     int
+	StockValue       string
+	BinnedValue      string
+	ExpiredNow       int
+	ExpiredThisMonth int
+	EatenThisMonth   int
+	BinnedThisMonth  int
+	// WastePercent is the share of this month's logged removals that were
+	// binned.
+	WastePercent int
+	Categories   chart
+	Locations    chart
+	FreezerAges  chart
+	Waste        chart
+	WasteValue   chart
+	WasteLog     []Removal
+}
+
+// locationChart counts the pantry items and freezer meals kept in each
+// location, with those not placed anywhere on a last row. It is empty when
+// the household has no locations.
+func locationChart(locs locations, store *Store) chart {
+	if len(locs) == 0 {
+		return newChart("Items by location", nil)
+	}
+	pantry := make(map[int]int)
+	freezer := make(map[int]int)
+	for _, item := range store.PantryItems {
+		id := item.LocationID
+		if locs.find(id) == nil {
+			id = 0
+		}
+		pantry[id]++
+	}
+	for _, meal := range store.FreezerMeals {
+		id := meal.LocationID
+		if locs.find(id) == nil {
+			id = 0
+		}
+		freezer[id]++
+	}
+	row := func(label string, id int) chartRow {
+		return chartRow{Label: label, Segments: []chartSegment{
+			{Label: "Pantry", Value: pantry[id], Class: "bar-pantry"},
+			{Label: "Freezer", Value: freezer[id], Class: "bar-freezer"},
+		}}
+	}
+	var rows []chartRow
+	for _, l := range locs {
+		rows = append(rows, row(l.Name, l.ID))
+	}
+	if pantry[0]+freezer[0] > 0 {
+		rows = append(rows, row("Not placed", 0))
+	}
+	return newChart("Items by location", rows)
+}
+
+// statsMonths is how many months the waste chart covers.
+const statsMonths = 6
+
+func buildStats(householdID int, now time.Time) (*statsPage, error) {
+	store, err := loadStore(householdID)
+	if err != nil {
+		return nil, err
+	}
+	page := &statsPage{PantryCount: len(store.PantryItems), FreezerCount: len(store.FreezerMeals)}
+	values, err := loadValuation(householdID, store.PantryItems)
+	if err != nil {
+		return nil, err
+	}
+	page.StockValue = values.PantryValue()
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	categories := make(map[string]int)
+	for _, item := range store.PantryItems {
+		category := item.Category
+		if !isPantryCategory(category) {
+			category = "Other"
+		}
+		categories[category]++
+		if isExpired(item.Expiry, now) {
+			page.ExpiredNow++
+			if item.Expiry >= monthStart.Format("2006-01-02") {
+				page.ExpiredThisMonth++
+			}
+		}
+	}
+	var categoryRows []chartRow
+	for _, c := range pantryCategories {
+		if n := categories[c]; n > 0 {
+			categoryRows = append(categoryRows, chartRow{Label: c, Segments: []chartSegment{{Label: c, Value: n, Class: "bar-pantry"}}})
+		}
+	}
+	page.Categories = newChart("Pantry items by category", categoryRows)
+
+	locs, err := loadLocations(householdID)
+	if err != nil {
+		return nil, err
+	}
+	page.Locations = locationChart(locs, store)
+
+	ages := make(map[string]int)
+	for _, meal := range store.FreezerMeals {
+		ages[freezerAge(meal.DateFrozen, now)]++
+	}
+	w := config.Warnings
+	page.FreezerAges = newChart("Freezer meals by age", []chartRow{
+		{Label: fmt.Sprintf("Up to %d days", w.FreezerAgingDays), Segments: []chartSegment{{Label: "Fresh", Value: ages["fresh"], Class: "bar-fresh"}}},
+		{Label: fmt.Sprintf("%d–%d days", w.FreezerAgingDays+1, w.FreezerOldDays), Segments: []chartSegment{{Label: "Getting old", Value: ages["medium"], Class: "bar-medium"}}},
+		{Label: fmt.Sprintf("Over %d days", w.FreezerOldDays), Segments: []chartSegment{{Label: "Old", Value: ages["old"], Class: "bar-old"}}},
+	})
+
+	first := monthStart.AddDate(0, -(statsMonths - 1), 0)
+	totals, err := monthlyRemovals(householdID, first.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	var wasteRows, valueRows []chartRow
+	for m := first; !m.After(monthStart); m = m.AddDate(0, 1, 0) {
+		var eaten, binned removalTotals
+		if t := totals[m.Format("2006-01")]; t != nil {
+			eaten, binned = *t[outcomeEaten], *t[outcomeBinned]
+		}
+		label := m.Format("Jan 2006")
+		wasteRows = append(wasteRows, chartRow{Label: label, Segments: []chartSegment{
+			{Label: "Eaten", Value: eaten.Count, Class: "bar-eaten"},
+			{Label: "Binned", Value: binned.Count, Class: "bar-binned"},
+		}})
+		// The value chart is in the main currency; others still count in
+		// the totals above it.
+		value := Money{Amount: binned.Value[config.Currency], Currency: config.Currency}
+		valueRows = append(valueRows, chartRow{Label: label, TotalText: value.String(), Segments: []chartSegment{
+			{Label: "Binned", Value: int(value.Amount), Class: "bar-binned", Text: value.String()},
+		}})
+	}
+	page.Waste = newChart("Eaten and binned by month", wasteRows)
+	page.WasteValue = newChart("Value binned by month", valueRows)
+	if t := totals[monthStart.Format("2006-01")]; t != nil {
+		page.EatenThisMonth = t[outcomeEaten].Count
+		page.BinnedThisMonth = t[outcomeBinned].Count
+		page.BinnedValue = t[outcomeBinned].Value.String()
+	}
+	if total := page.EatenThisMonth + page.BinnedThisMonth; total > 0 {
+		page.WastePercent = int(math.Round(float64(page.BinnedThisMonth) / float64(total) * 100))
+	}
+
+	if page.WasteLog, err = loadWasteLog(householdID, 50); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := buildStats(householdID(r), time.Now())
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "stats.html", page)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteLogsOutcome(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Milk", Quantity: "1 pint", Category: "Beverages", Expiry: "2000-01-01"}, {ID: 2, Name: "Rice"}, {ID: 3, Name: "Typo"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextPantryID: 4,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"1"}, "outcome": {"binned"}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"2"}, "outcome": {"eaten"}})
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"3"}})
+	postForm(deleteFreezerHandler, "/freezer/delete", url.Values{"id": {"1"}, "outcome": {"binned"}})
+
+	if w := postForm(deleteFreezerHandler, "/freezer/delete", url.Values{"id": {"1"}, "outcome": {"composted"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown outcome, got %d", w.Code)
+	}
+
+	log, err := loadWasteLog(defaultHouseholdID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].Name != "Chilli" || log[1].Name != "Milk" {
+		t.Fatalf("expected Chilli and Milk in the waste log, got %+v", log)
+	}
+	if !log[1].PastExpiry() || log[1].Quantity != "1 pint" {
+		t.Errorf("expected Milk's details to be kept, got %+v", log[1])
+	}
+
+	counts, err := monthlyRemovals(defaultHouseholdID, "2000-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	month := counts[time.Now().Format("2006-01")]
+	if month[outcomeEaten].Count != 1 || month[outcomeBinned].Count != 2 {
+		t.Errorf("expected 1 eaten and 2 binned, got %v", month)
+	}
+
+	// Another household's log is separate.
+	if other, _ := loadWasteLog(defaultHouseholdID+1, 10); len(other) != 0 {
+		t.Errorf("expected no waste in another household, got %+v", other)
+	}
+}
+
+func TestStatsPage(t *testing.T) {
+	setupHandlerTest(t)
+	now := time.Now()
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Beans", Category: "Canned Goods"},
+			{ID: 2, Name: "Soup", Category: "Canned Goods", Expiry: now.AddDate(0, 0, -1).Format("2006-01-02")},
+			{ID: 3, Name: "Flour", Category: "Baking"},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Stew", DateFrozen: now.AddDate(0, 0, -60).Format("2006-01-02")}},
+		NextPantryID: 4,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	postForm(deletePantryHandler, "/pantry/delete", url.Values{"id": {"3"}, "outcome": {"binned"}})
+
+	page, err := buildStats(defaultHouseholdID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.PantryCount != 2 || page.ExpiredNow != 1 || page.BinnedThisMonth != 1 || page.WastePercent != 100 {
+		t.Errorf("unexpected totals: %+v", page)
+	}
+	if len(page.Categories.Rows) != 1 || page.Categories.Rows[0].Total != 2 {
+		t.Errorf("expected one category with two items, got %+v", page.Categories.Rows)
+	}
+	if page.FreezerAges.Rows[1].Total != 1 {
+		t.Errorf("expected the stew in the middle age bucket, got %+v", page.FreezerAges.Rows)
+	}
+	if n := len(page.Waste.Rows); n != statsMonths {
+		t.Errorf("expected %d months in the waste chart, got %d", statsMonths, n)
+	}
+
+	w := httptest.NewRecorder()
+	statsHandler(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "<svg") || !strings.Contains(body, `<rect class="bar-binned"`) || !strings.Contains(body, "Flour") {
+		t.Errorf("expected SVG charts and the waste log, got %d", w.Code)
+	}
+}
+
+func TestStatsCountsByLocation(t *testing.T) {
+	setupHandlerTest(t)
+	now := time.Now()
+	page, err := buildStats(defaultHouseholdID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Locations.Rows) != 0 {
+		t.Errorf("expected no location chart without locations, got %+v", page.Locations.Rows)
+	}
+
+	chest := &Location{Name: "Chest freezer", Kind: locationFreezer, Compartments: []string{"Drawer 1"}}
+	larder := &Location{Name: "Larder", Kind: locationPantry, Compartments: []string{"Top shelf"}}
+	for _, l := range []*Location{chest, larder} {
+		if err := saveLocation(defaultHouseholdID, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Beans", LocationID: larder.ID, Position: "Top shelf"},
+			{ID: 2, Name: "Soup", LocationID: larder.ID},
+			{ID: 3, Name: "Peas", LocationID: chest.ID, Position: "Drawer 1"},
+			{ID: 4, Name: "Flour"},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Stew", LocationID: chest.ID, Position: "Drawer 1"}},
+		NextPantryID: 5,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = buildStats(defaultHouseholdID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range page.Locations.Rows {
+		got = append(got, fmt.Sprintf("%s %d+%d", row.Label, row.Segments[0].Value, row.Segments[1].Value))
+	}
+	if strings.Join(got, ", ") != "Chest freezer 1+1, Larder 2+0, Not placed 1+0" {
+		t.Errorf("unexpected counts by location: %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	statsHandler(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if body := w.Body.String(); !strings.Contains(body, "By Location") || !strings.Contains(body, `<rect class="bar-freezer"`) {
+		t.Errorf("expected the location chart on the stats page, got %d", w.Code)
+	}
+}
+
+func TestNewChartScalesToLargestRow(t *testing.T) {
+	c := newChart("test", []chartRow{
+		{Label: "a", Segments: []chartSegment{{Value: 2}, {Value: 2}}},
+		{Label: "b", Segments: []chartSegment{{Value: 1}}},
+		{Label: "c", Segments: []chartSegment{{Value: 0}}},
+	})
+	a, b := c.Rows[0], c.Rows[1]
+	if a.Total != 4 || a.Segments[0].Width != chartBarSpace/2 || a.Segments[1].X != chartLabelWidth+chartBarSpace/2 {
+		t.Errorf("unexpected layout for a: %+v", a)
+	}
+	if b.Segments[0].Width != chartBarSpace/4 || b.Segments[0].Y != chartRowHeight {
+		t.Errorf("unexpected layout for b: %+v", b)
+	}
+	if c.Height != 3*chartRowHeight {
+		t.Errorf("expected height %d, got %d", 3*chartRowHeight, c.Height)
+	}
+}
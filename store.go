@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"sort"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 var dbFile = "data.db"
 
-func openDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbFile)
+// householdTables are the tables whose rows belong to a household.
+var householdTables = []string{
+	"pantry_items", "freezer_meals", "recipes", "meal_plan", "people", "shopping_list", "audit_log",
+}
+
+// openDB opens the database and brings its schema up to date.
+func openDB() (db *sql.DB, err error) {
+	defer observeDB("open", time.Now(), &err)
+	db, err = sql.Open("sqlite", dbFile)
 	if err != nil {
 		return nil, err
 	}
@@ -20,34 +31,323 @@ func openDB() (*sql.DB, error) {
 	return db, nil
 }
 
+// pingDB checks the database can be opened and queried.
+func pingDB(ctx context.Context) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var one int
+	return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// closeDB is called at shutdown once requests have drained. Storage calls
+// open and close their own connections, so nothing is left open; this runs
+// the optimize pass SQLite recommends before a long-lived program closes.
+func closeDB() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("PRAGMA optimize"); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
 func initDB(db *sql.DB) error {
 	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS pantry_items (
-			id       INTEGER PRIMARY KEY,
-			name     TEXT NOT NULL,
-			quantity TEXT,
-			category TEXT,
-			expiry   TEXT,
-			notes    TEXT
+			id           INTEGER PRIMARY KEY,
+			name         TEXT NOT NULL,
+			quantity     TEXT,
+			category     TEXT,
+			expiry       TEXT,
+			notes        TEXT,
+			household_id INTEGER NOT NULL DEFAULT 1,
+			location_id  INTEGER NOT NULL DEFAULT 0,
+			position     TEXT NOT NULL DEFAULT '',
+			version      INTEGER NOT NULL DEFAULT 1,
+			checksum     TEXT NOT NULL DEFAULT ''
+		);
+		CREATE TABLE IF NOT EXISTS pantry_batches (
+			item_id   INTEGER NOT NULL,
+			position  INTEGER NOT NULL,
+			quantity  TEXT,
+			expiry    TEXT,
+			purchased TEXT
 		);
 		CREATE TABLE IF NOT EXISTS freezer_meals (
-			id          INTEGER PRIMARY KEY,
-			name        TEXT NOT NULL,
-			portions    TEXT,
-			date_frozen TEXT,
-			description TEXT
+			id           INTEGER PRIMARY KEY,
+			name         TEXT NOT NULL,
+			portions     TEXT,
+			date_frozen  TEXT,
+			description  TEXT,
+			household_id INTEGER NOT NULL DEFAULT 1,
+			location_id  INTEGER NOT NULL DEFAULT 0,
+			position     TEXT NOT NULL DEFAULT '',
+			version      INTEGER NOT NULL DEFAULT 1,
+			checksum     TEXT NOT NULL DEFAULT ''
+		);
+		CREATE TABLE IF NOT EXISTS locations (
+			id           INTEGER PRIMARY KEY,
+			household_id INTEGER NOT NULL,
+			name         TEXT NOT NULL,
+			kind         TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS location_compartments (
+			location_id INTEGER NOT NULL,
+			position    INTEGER NOT NULL,
+			name        TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS freezer_meal_ingredients (
+			meal_id        INTEGER NOT NULL,
+			position       INTEGER NOT NULL,
+			pantry_item_id INTEGER NOT NULL DEFAULT 0,
+			name           TEXT NOT NULL,
+			quantity       TEXT,
+			category       TEXT
+		);
+		CREATE TABLE IF NOT EXISTS recipes (
+			id           INTEGER PRIMARY KEY,
+			name         TEXT NOT NULL,
+			servings     TEXT,
+			source       TEXT,
+			instructions TEXT,
+			household_id INTEGER NOT NULL DEFAULT 1
+		);
+		CREATE TABLE IF NOT EXISTS recipe_ingredients (
+			id             INTEGER PRIMARY KEY,
+			recipe_id      INTEGER NOT NULL,
+			position       INTEGER NOT NULL,
+			raw            TEXT,
+			amount         REAL,
+			unit           TEXT,
+			name           TEXT,
+			note           TEXT,
+			pantry_item_id INTEGER NOT NULL DEFAULT 0,
+			match_score    REAL NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS meal_plan (
+			id              INTEGER PRIMARY KEY,
+			date            TEXT NOT NULL,
+			freezer_meal_id INTEGER NOT NULL DEFAULT 0,
+			recipe_id       INTEGER NOT NULL DEFAULT 0,
+			portions        INTEGER NOT NULL DEFAULT 1,
+			household_id    INTEGER NOT NULL DEFAULT 1
+		);
+		CREATE TABLE IF NOT EXISTS tags (
+			id       INTEGER PRIMARY KEY,
+			name     TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			allergen INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS item_tags (
+			item_type TEXT NOT NULL,
+			item_id   INTEGER NOT NULL,
+			tag_id    INTEGER NOT NULL,
+			PRIMARY KEY (item_type, item_id, tag_id)
+		);
+		CREATE TABLE IF NOT EXISTS people (
+			id           INTEGER PRIMARY KEY,
+			name         TEXT NOT NULL,
+			household_id INTEGER NOT NULL DEFAULT 1
+		);
+		CREATE TABLE IF NOT EXISTS person_tags (
+			person_id INTEGER NOT NULL,
+			tag_id    INTEGER NOT NULL,
+			PRIMARY KEY (person_id, tag_id)
+		);
+		CREATE TABLE IF NOT EXISTS meal_plan_people (
+			entry_id  INTEGER NOT NULL,
+			person_id INTEGER NOT NULL,
+			PRIMARY KEY (entry_id, person_id)
+		);
+		CREATE TABLE IF NOT EXISTS households (
+			id   INTEGER PRIMARY KEY,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS household_members (
+			household_id INTEGER NOT NULL,
+			user_id      INTEGER NOT NULL,
+			PRIMARY KEY (household_id, user_id)
+		);
+		CREATE TABLE IF NOT EXISTS users (
+			id            INTEGER PRIMARY KEY,
+			username      TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			password_hash TEXT NOT NULL,
+			admin         INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS sessions (
+			token_hash TEXT PRIMARY KEY,
+			user_id    INTEGER NOT NULL,
+			expires    TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id           INTEGER PRIMARY KEY,
+			user_id      INTEGER NOT NULL,
+			household_id INTEGER NOT NULL,
+			name         TEXT NOT NULL,
+			token_hash   TEXT NOT NULL UNIQUE,
+			scope        TEXT NOT NULL,
+			created      TEXT NOT NULL,
+			last_used    TEXT
+		);
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id           INTEGER PRIMARY KEY,
+			time         TEXT NOT NULL,
+			user_id      INTEGER NOT NULL DEFAULT 0,
+			username     TEXT,
+			action       TEXT NOT NULL,
+			detail       TEXT,
+			household_id INTEGER NOT NULL DEFAULT 1
+		);
+		CREATE TABLE IF NOT EXISTS purchases (
+			id             INTEGER PRIMARY KEY,
+			household_id   INTEGER NOT NULL,
+			pantry_item_id INTEGER NOT NULL,
+			price          INTEGER NOT NULL,
+			currency       TEXT NOT NULL,
+			store          TEXT NOT NULL DEFAULT '',
+			date           TEXT NOT NULL,
+			quantity       TEXT NOT NULL DEFAULT ''
+		);
+		CREATE TABLE IF NOT EXISTS removals (
+			id           INTEGER PRIMARY KEY,
+			household_id INTEGER NOT NULL,
+			item_type    TEXT NOT NULL,
+			name         TEXT NOT NULL,
+			quantity     TEXT NOT NULL DEFAULT '',
+			category     TEXT NOT NULL DEFAULT '',
+			expiry       TEXT NOT NULL DEFAULT '',
+			outcome      TEXT NOT NULL,
+			date         TEXT NOT NULL,
+			value        INTEGER NOT NULL DEFAULT 0,
+			currency     TEXT NOT NULL DEFAULT ''
+		);
+		CREATE TABLE IF NOT EXISTS shopping_list (
+			id           INTEGER PRIMARY KEY,
+			name         TEXT NOT NULL,
+			quantity     TEXT,
+			source       TEXT,
+			done         INTEGER NOT NULL DEFAULT 0,
+			household_id INTEGER NOT NULL DEFAULT 1
+		);
+		CREATE TABLE IF NOT EXISTS id_sequences (
+			name    TEXT PRIMARY KEY,
+			next_id INTEGER NOT NULL
 		);
 	`)
+	if err != nil {
+		return err
+	}
+	// Databases from before households existed get every row in the
+	// default household.
+	for _, table := range householdTables {
+		if err := ensureColumn(db, table, "household_id", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+	}
+	// Removals logged before prices were tracked have no value.
+	if err := ensureColumn(db, "removals", "value", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "removals", "currency", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Items stored before locations existed aren't anywhere in particular.
+	for _, table := range []string{"pantry_items", "freezer_meals"} {
+		if err := ensureColumn(db, table, "location_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := ensureColumn(db, table, "position", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	// Items stored before versions existed start at 1; their checksum is
+	// filled in when they are next saved.
+	for _, table := range []string{"pantry_items", "freezer_meals"} {
+		if err := ensureColumn(db, table, "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+		if err := ensureColumn(db, table, "checksum", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	// Item IDs only ever go up, so a deleted item's ID, and the short code
+	// printed on its label, is never given to another. Databases from before
+	// the sequences existed start them after the highest ID in use.
+	for _, table := range idSequences {
+		if _, err := db.Exec("INSERT OR IGNORE INTO id_sequences (name, next_id) SELECT ?, COALESCE(MAX(id), 0) + 1 FROM "+table, table); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO households (id, name) VALUES (?, 'Home')", defaultHouseholdID); err != nil {
+		return err
+	}
+	for _, name := range euAllergens {
+		if _, err := db.Exec("INSERT INTO tags (name, allergen) VALUES (?, 1) ON CONFLICT (name) DO UPDATE SET allergen = 1", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds a column to a table created by an older version.
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
 	return err
 }
 
-func loadStore() (*Store, error) {
+// loadStore returns a household's pantry items and freezer meals.
+func loadStore(householdID int) (_ *Store, err error) {
+	defer observeDB("load_store", time.Now(), &err)
 	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
+	return readStore(db, householdID)
+}
+
+// idSequences are the tables whose IDs come from id_sequences.
+var idSequences = []string{"pantry_items", "freezer_meals"}
+
+// nextIDQuery returns the next unused ID for table: its sequence, or past
+// the highest row if a row was written with a later ID.
+func nextIDQuery(table string) string {
+	return "SELECT MAX(COALESCE((SELECT next_id FROM id_sequences WHERE name = '" + table + "'), 1), (SELECT COALESCE(MAX(id), 0) + 1 FROM " + table + "))"
+}
 
+// querier is what readStore needs, met by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// readStore reads a household's pantry items and freezer meals through db,
+// which may be a transaction the store is about to be written back in. IDs
+// are unique across households, so the next IDs come from every row.
+func readStore(db querier, householdID int) (*Store, error) {
 	store := &Store{
 		PantryItems:  []PantryItem{},
 		FreezerMeals: []FreezerMeal{},
@@ -55,48 +355,135 @@ func loadStore() (*Store, error) {
 		NextMealID:   1,
 	}
 
-	rows, err := db.Query("SELECT id, name, quantity, category, expiry, notes FROM pantry_items")
+	if err := db.QueryRow(nextIDQuery("pantry_items")).Scan(&store.NextPantryID); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(nextIDQuery("freezer_meals")).Scan(&store.NextMealID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT id, name, quantity, category, expiry, notes, location_id, position, version FROM pantry_items WHERE household_id = ?", householdID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var item PantryItem
-		if err := rows.Scan(&item.ID, &item.Name, &item.Quantity, &item.Category, &item.Expiry, &item.Notes); err != nil {
+		if err := rows.Scan(&item.ID, &item.Name, &item.Quantity, &item.Category, &item.Expiry, &item.Notes, &item.LocationID, &item.Position, &item.Version); err != nil {
 			return nil, err
 		}
 		store.PantryItems = append(store.PantryItems, item)
-		if item.ID >= store.NextPantryID {
-			store.NextPantryID = item.ID + 1
-		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	rows2, err := db.Query("SELECT id, name, portions, date_frozen, description FROM freezer_meals")
+	batchRows, err := db.Query(`
+		SELECT item_id, quantity, expiry, purchased FROM pantry_batches
+		WHERE item_id IN (SELECT id FROM pantry_items WHERE household_id = ?)
+		ORDER BY item_id, position`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer batchRows.Close()
+	pantryIndex := make(map[int]int, len(store.PantryItems))
+	for i, item := range store.PantryItems {
+		pantryIndex[item.ID] = i
+	}
+	for batchRows.Next() {
+		var itemID int
+		var b Batch
+		if err := batchRows.Scan(&itemID, &b.Quantity, &b.Expiry, &b.Purchased); err != nil {
+			return nil, err
+		}
+		if i, ok := pantryIndex[itemID]; ok {
+			store.PantryItems[i].Batches = append(store.PantryItems[i].Batches, b)
+		}
+	}
+	if err := batchRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows2, err := db.Query("SELECT id, name, portions, date_frozen, description, location_id, position, version FROM freezer_meals WHERE household_id = ?", householdID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows2.Close()
 	for rows2.Next() {
 		var meal FreezerMeal
-		if err := rows2.Scan(&meal.ID, &meal.Name, &meal.Portions, &meal.DateFrozen, &meal.Description); err != nil {
+		if err := rows2.Scan(&meal.ID, &meal.Name, &meal.Portions, &meal.DateFrozen, &meal.Description, &meal.LocationID, &meal.Position, &meal.Version); err != nil {
 			return nil, err
 		}
 		store.FreezerMeals = append(store.FreezerMeals, meal)
-		if meal.ID >= store.NextMealID {
-			store.NextMealID = meal.ID + 1
-		}
 	}
 	if err := rows2.Err(); err != nil {
 		return nil, err
 	}
 
+	rows3, err := db.Query(`
+		SELECT meal_id, pantry_item_id, name, quantity, category FROM freezer_meal_ingredients
+		WHERE meal_id IN (SELECT id FROM freezer_meals WHERE household_id = ?)
+		ORDER BY meal_id, position`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows3.Close()
+	mealIndex := make(map[int]int, len(store.FreezerMeals))
+	for i, meal := range store.FreezerMeals {
+		mealIndex[meal.ID] = i
+	}
+	for rows3.Next() {
+		var mealID int
+		var ing FreezerMealIngredient
+		if err := rows3.Scan(&mealID, &ing.PantryItemID, &ing.Name, &ing.Quantity, &ing.Category); err != nil {
+			return nil, err
+		}
+		if i, ok := mealIndex[mealID]; ok {
+			store.FreezerMeals[i].Ingredients = append(store.FreezerMeals[i].Ingredients, ing)
+		}
+	}
+	if err := rows3.Err(); err != nil {
+		return nil, err
+	}
+
+	rows4, err := db.Query(`
+		SELECT it.item_type, it.item_id, t.name FROM item_tags it
+		JOIN tags t ON t.id = it.tag_id
+		WHERE (it.item_type = 'pantry' AND it.item_id IN (SELECT id FROM pantry_items WHERE household_id = ?))
+		   OR (it.item_type = 'freezer' AND it.item_id IN (SELECT id FROM freezer_meals WHERE household_id = ?))
+		ORDER BY t.allergen DESC, t.name COLLATE NOCASE`, householdID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows4.Close()
+	for rows4.Next() {
+		var itemType, name string
+		var itemID int
+		if err := rows4.Scan(&itemType, &itemID, &name); err != nil {
+			return nil, err
+		}
+		switch itemType {
+		case "pantry":
+			if i, ok := pantryIndex[itemID]; ok {
+				store.PantryItems[i].Tags = append(store.PantryItems[i].Tags, name)
+			}
+		case "freezer":
+			if i, ok := mealIndex[itemID]; ok {
+				store.FreezerMeals[i].Tags = append(store.FreezerMeals[i].Tags, name)
+			}
+		}
+	}
+	if err := rows4.Err(); err != nil {
+		return nil, err
+	}
+
+	store.loaded = store.versions()
 	return store, nil
 }
 
-func saveStore(store *Store) error {
+// saveStore replaces a household's pantry items and freezer meals.
+func saveStore(householdID int, store *Store) (err error) {
+	defer observeDB("save_store", time.Now(), &err)
 	db, err := openDB()
 	if err != nil {
 		return err
@@ -109,29 +496,248 @@ func saveStore(store *Store) error {
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM pantry_items"); err != nil {
+	events, err := writeStore(tx, householdID, store)
+	if err != nil {
 		return err
 	}
+	return commitAndPublish(tx, events)
+}
+
+// storeVersions is the version and checksum of each item in a store, keyed
+// by ID.
+type storeVersions struct {
+	pantry  map[int]itemVersion
+	freezer map[int]itemVersion
+}
+
+// versions returns the versions of the items in store as they now are.
+func (store *Store) versions() *storeVersions {
+	v := &storeVersions{
+		pantry:  make(map[int]itemVersion, len(store.PantryItems)),
+		freezer: make(map[int]itemVersion, len(store.FreezerMeals)),
+	}
 	for _, item := range store.PantryItems {
+		v.pantry[item.ID] = itemVersion{version: item.Version, checksum: pantryChecksum(item)}
+	}
+	for _, meal := range store.FreezerMeals {
+		v.freezer[meal.ID] = itemVersion{version: meal.Version, checksum: mealChecksum(meal)}
+	}
+	return v
+}
+
+// writeStore saves a household's pantry items and freezer meals from store,
+// inside the caller's transaction. Only the items store created, changed or
+// deleted since it was loaded are written, so other saves made meanwhile are
+// kept; if one of them changed or deleted an item store also changed or
+// deleted, nothing is written and errConflict is returned. Other households'
+// rows are never touched. Each item's version goes up when it changes, and
+// is set in store. It returns an event for each item created, changed or
+// deleted, for the caller to publish once the transaction commits.
+func writeStore(tx *sql.Tx, householdID int, store *Store) ([]itemEvent, error) {
+	pantryVersions, err := loadVersions(tx, "pantry_items", householdID)
+	if err != nil {
+		return nil, err
+	}
+	mealVersions, err := loadVersions(tx, "freezer_meals", householdID)
+	if err != nil {
+		return nil, err
+	}
+	loaded := store.loaded
+	if loaded == nil {
+		loaded = &storeVersions{pantry: pantryVersions, freezer: mealVersions}
+	}
+
+	var events []itemEvent
+	kept := make(map[int]bool, len(store.PantryItems))
+	for i := range store.PantryItems {
+		item := &store.PantryItems[i]
+		kept[item.ID] = true
+		sum := pantryChecksum(*item)
+		version, event, write, err := itemWrite("pantry", item.ID, sum, loaded.pantry, pantryVersions)
+		if err != nil {
+			return nil, err
+		}
+		item.Version = version
+		if !write {
+			continue
+		}
+		if err := deletePantryRows(tx, householdID, item.ID); err != nil {
+			return nil, err
+		}
 		if _, err := tx.Exec(
-			"INSERT INTO pantry_items (id, name, quantity, category, expiry, notes) VALUES (?, ?, ?, ?, ?, ?)",
-			item.ID, item.Name, item.Quantity, item.Category, item.Expiry, item.Notes,
+			"INSERT INTO pantry_items (id, name, quantity, category, expiry, notes, household_id, location_id, position, version, checksum) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			item.ID, item.Name, item.Quantity, item.Category, item.Expiry, item.Notes, householdID, item.LocationID, item.Position, item.Version, sum,
 		); err != nil {
-			return err
+			return nil, err
+		}
+		for i, b := range item.Batches {
+			if _, err := tx.Exec(
+				"INSERT INTO pantry_batches (item_id, position, quantity, expiry, purchased) VALUES (?, ?, ?, ?, ?)",
+				item.ID, i, b.Quantity, b.Expiry, b.Purchased,
+			); err != nil {
+				return nil, err
+			}
 		}
+		if err := writeItemTags(tx, "pantry", item.ID, item.Tags); err != nil {
+			return nil, err
+		}
+		events = appendItemEvent(events, event, "pantry", item.ID, item.Version, householdID)
 	}
-
-	if _, err := tx.Exec("DELETE FROM freezer_meals"); err != nil {
-		return err
+	for _, id := range deletedIDs(loaded.pantry, kept) {
+		if err := checkDelete("pantry", id, loaded.pantry, pantryVersions); err != nil {
+			return nil, err
+		}
+		if _, ok := pantryVersions[id]; !ok {
+			continue
+		}
+		if err := deletePantryRows(tx, householdID, id); err != nil {
+			return nil, err
+		}
+		events = appendItemEvent(events, eventDeleted, "pantry", id, 0, householdID)
 	}
-	for _, meal := range store.FreezerMeals {
+
+	kept = make(map[int]bool, len(store.FreezerMeals))
+	for i := range store.FreezerMeals {
+		meal := &store.FreezerMeals[i]
+		kept[meal.ID] = true
+		sum := mealChecksum(*meal)
+		version, event, write, err := itemWrite("freezer", meal.ID, sum, loaded.freezer, mealVersions)
+		if err != nil {
+			return nil, err
+		}
+		meal.Version = version
+		if !write {
+			continue
+		}
+		if err := deleteMealRows(tx, householdID, meal.ID); err != nil {
+			return nil, err
+		}
 		if _, err := tx.Exec(
-			"INSERT INTO freezer_meals (id, name, portions, date_frozen, description) VALUES (?, ?, ?, ?, ?)",
-			meal.ID, meal.Name, meal.Portions, meal.DateFrozen, meal.Description,
+			"INSERT INTO freezer_meals (id, name, portions, date_frozen, description, household_id, location_id, position, version, checksum) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			meal.ID, meal.Name, meal.Portions, meal.DateFrozen, meal.Description, householdID, meal.LocationID, meal.Position, meal.Version, sum,
 		); err != nil {
-			return err
+			return nil, err
+		}
+		for i, ing := range meal.Ingredients {
+			if _, err := tx.Exec(
+				"INSERT INTO freezer_meal_ingredients (meal_id, position, pantry_item_id, name, quantity, category) VALUES (?, ?, ?, ?, ?, ?)",
+				meal.ID, i, ing.PantryItemID, ing.Name, ing.Quantity, ing.Category,
+			); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeItemTags(tx, "freezer", meal.ID, meal.Tags); err != nil {
+			return nil, err
+		}
+		events = appendItemEvent(events, event, "freezer", meal.ID, meal.Version, householdID)
+	}
+	for _, id := range deletedIDs(loaded.freezer, kept) {
+		if err := checkDelete("freezer", id, loaded.freezer, mealVersions); err != nil {
+			return nil, err
+		}
+		if _, ok := mealVersions[id]; !ok {
+			continue
+		}
+		if err := deleteMealRows(tx, householdID, id); err != nil {
+			return nil, err
+		}
+		events = appendItemEvent(events, eventDeleted, "freezer", id, 0, householdID)
+	}
+
+	// The IDs handed out stay used even if their items are deleted.
+	for table, next := range map[string]int{"pantry_items": store.NextPantryID, "freezer_meals": store.NextMealID} {
+		if _, err := tx.Exec("UPDATE id_sequences SET next_id = MAX(("+nextIDQuery(table)+"), ?) WHERE name = ?", next, table); err != nil {
+			return nil, err
+		}
+	}
+
+	// Price history goes with its item.
+	_, err = tx.Exec(
+		"DELETE FROM purchases WHERE household_id = ? AND pantry_item_id NOT IN (SELECT id FROM pantry_items WHERE household_id = ?)",
+		householdID, householdID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	store.loaded = store.versions()
+	return events, nil
+}
+
+// itemWrite works out how to save an item with checksum sum, given its
+// version when the store was loaded and the versions saved now: the version
+// it ends at, the event it makes ("" for none), and whether its rows need
+// writing. An item nobody else has touched is written if it changed, and
+// one this save didn't change is left as saved. An item changed both here
+// and elsewhere, or deleted elsewhere, is an errConflict, unless the other
+// save made the same change. Every change moves the version on, even for rows
+// saved before checksums, so a save made to the old version is always seen
+// as stale.
+func itemWrite(kind string, id int, sum string, loaded, saved map[int]itemVersion) (version int, event string, write bool, err error) {
+	was, wasLoaded := loaded[id]
+	cur, exists := saved[id]
+	switch {
+	case !wasLoaded && exists:
+		return 0, "", false, fmt.Errorf("%s %d was created elsewhere: %w", kind, id, errConflict)
+	case !wasLoaded:
+		return 1, eventCreated, true, nil
+	case was.checksum == sum:
+		return was.version, "", false, nil
+	case !exists:
+		return 0, "", false, fmt.Errorf("%s %d was deleted elsewhere: %w", kind, id, errConflict)
+	case cur.version != was.version:
+		if cur.checksum != sum {
+			return 0, "", false, fmt.Errorf("%s %d was changed elsewhere: %w", kind, id, errConflict)
 		}
+		return cur.version, "", false, nil
+	}
+	version = cur.next(sum)
+	if version != cur.version {
+		event = eventUpdated
 	}
+	return version, event, true, nil
+}
+
+// checkDelete returns an errConflict if the item with id, loaded at the
+// version in loaded, has been changed elsewhere since.
+func checkDelete(kind string, id int, loaded, saved map[int]itemVersion) error {
+	if cur, ok := saved[id]; ok && cur.version != loaded[id].version {
+		return fmt.Errorf("%s %d was changed elsewhere: %w", kind, id, errConflict)
+	}
+	return nil
+}
 
-	return tx.Commit()
+// deletedIDs returns the IDs in loaded that aren't kept, in order.
+func deletedIDs(loaded map[int]itemVersion, kept map[int]bool) []int {
+	var ids []int
+	for id := range loaded {
+		if !kept[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// deletePantryRows deletes a pantry item with its batches and tags.
+func deletePantryRows(tx *sql.Tx, householdID, id int) error {
+	if _, err := tx.Exec("DELETE FROM item_tags WHERE item_type = 'pantry' AND item_id IN (SELECT id FROM pantry_items WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM pantry_batches WHERE item_id IN (SELECT id FROM pantry_items WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM pantry_items WHERE id = ? AND household_id = ?", id, householdID)
+	return err
+}
+
+// deleteMealRows deletes a freezer meal with its ingredients and tags.
+func deleteMealRows(tx *sql.Tx, householdID, id int) error {
+	if _, err := tx.Exec("DELETE FROM item_tags WHERE item_type = 'freezer' AND item_id IN (SELECT id FROM freezer_meals WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM freezer_meal_ingredients WHERE meal_id IN (SELECT id FROM freezer_meals WHERE id = ? AND household_id = ?)", id, householdID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM freezer_meals WHERE id = ? AND household_id = ?", id, householdID)
+	return err
 }
@@ -36,7 +36,7 @@ func TestInitDB(t *testing.T) {
 func TestLoadStoreEmpty(t *testing.T) {
 	useTempDB(t)
 
-	store, err := loadStore()
+	store, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatalf("loadStore: %v", err)
 	}
@@ -67,11 +67,11 @@ func TestSaveAndLoadPantryItems(t *testing.T) {
 		NextMealID:   1,
 	}
 
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatalf("saveStore: %v", err)
 	}
 
-	loaded, err := loadStore()
+	loaded, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatalf("loadStore: %v", err)
 	}
@@ -109,11 +109,11 @@ func TestSaveAndLoadFreezerMeals(t *testing.T) {
 		NextMealID:   2,
 	}
 
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatalf("saveStore: %v", err)
 	}
 
-	loaded, err := loadStore()
+	loaded, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatalf("loadStore: %v", err)
 	}
@@ -140,7 +140,7 @@ func TestSaveStoreOverwrites(t *testing.T) {
 		NextPantryID: 3,
 		NextMealID:   1,
 	}
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatalf("saveStore first: %v", err)
 	}
 
@@ -148,11 +148,11 @@ func TestSaveStoreOverwrites(t *testing.T) {
 	store.PantryItems = []PantryItem{
 		{ID: 2, Name: "Pasta", Quantity: "500g", Category: "Dry Goods"},
 	}
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatalf("saveStore second: %v", err)
 	}
 
-	loaded, err := loadStore()
+	loaded, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatalf("loadStore: %v", err)
 	}
@@ -178,11 +178,11 @@ func TestLoadStoreNextIDCalculation(t *testing.T) {
 		NextPantryID: 6,
 		NextMealID:   8,
 	}
-	if err := saveStore(store); err != nil {
+	if err := saveStore(defaultHouseholdID, store); err != nil {
 		t.Fatalf("saveStore: %v", err)
 	}
 
-	loaded, err := loadStore()
+	loaded, err := loadStore(defaultHouseholdID)
 	if err != nil {
 		t.Fatalf("loadStore: %v", err)
 	}
@@ -193,3 +193,40 @@ func TestLoadStoreNextIDCalculation(t *testing.T) {
 		t.Errorf("expected NextMealID=8, got %d", loaded.NextMealID)
 	}
 }
+
+func TestSaveAndLoadFreezerMealIngredients(t *testing.T) {
+	useTempDB(t)
+
+	store := &Store{
+		PantryItems: []PantryItem{},
+		FreezerMeals: []FreezerMeal{
+			{ID: 1, Name: "Chilli", Ingredients: []FreezerMealIngredient{
+				{PantryItemID: 4, Name: "Beans", Quantity: "2 cans", Category: "Canned Goods"},
+				{PantryItemID: 5, Name: "Mince", Quantity: "500 g"},
+			}},
+			{ID: 2, Name: "Leftovers"},
+		},
+		NextPantryID: 1,
+		NextMealID:   3,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatalf("saveStore: %v", err)
+	}
+
+	loaded, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatalf("loadStore: %v", err)
+	}
+	byID := make(map[int]FreezerMeal)
+	for _, m := range loaded.FreezerMeals {
+		byID[m.ID] = m
+	}
+	chilli := byID[1]
+	if len(chilli.Ingredients) != 2 || chilli.Ingredients[0].Name != "Beans" ||
+		chilli.Ingredients[0].Category != "Canned Goods" || chilli.Ingredients[1].PantryItemID != 5 {
+		t.Errorf("unexpected ingredients: %+v", chilli.Ingredients)
+	}
+	if len(byID[2].Ingredients) != 0 {
+		t.Errorf("meal without provenance should have no ingredients, got %+v", byID[2].Ingredients)
+	}
+}
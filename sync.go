@@ -0,0 +1,466 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// itemVersion is what writeStore knows of a saved item: its version and a
+// checksum of its contents at that version.
+type itemVersion struct {
+	version  int
+	checksum string
+}
+
+// next is the version of an item with checksum sum saved over v: the same
+// if it hasn't changed, one more if it has, and 1 for a new item. Rows saved
+// before checksums existed have nothing to compare with, so they count as
+// changed.
+func (v itemVersion) next(sum string) int {
+	switch {
+	case v.version == 0:
+		return 1
+	case v.checksum == sum:
+		return v.version
+	}
+	return v.version + 1
+}
+
+// loadVersions reads the versions of a household's saved items in table,
+// keyed by ID.
+func loadVersions(tx *sql.Tx, table string, householdID int) (map[int]itemVersion, error) {
+	rows, err := tx.Query("SELECT id, version, checksum FROM "+table+" WHERE household_id = ?", householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int]itemVersion)
+	for rows.Next() {
+		var id int
+		var v itemVersion
+		if err := rows.Scan(&id, &v.version, &v.checksum); err != nil {
+			return nil, err
+		}
+		versions[id] = v
+	}
+	return versions, rows.Err()
+}
+
+// checksum is a short hash of v's JSON, enough to tell whether an item has
+// changed between saves.
+func checksum(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// canonicalTags returns tags in lower case and sorted, as tags are stored
+// in whichever case was used first and loaded in tag order.
+func canonicalTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = strings.ToLower(t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pantryChecksum is the checksum of everything about item but its version.
+func pantryChecksum(item PantryItem) string {
+	item.Version = 0
+	item.Tags = canonicalTags(item.Tags)
+	return checksum(item)
+}
+
+// mealChecksum is the checksum of everything about meal but its version.
+func mealChecksum(meal FreezerMeal) string {
+	meal.Version = 0
+	meal.Tags = canonicalTags(meal.Tags)
+	return checksum(meal)
+}
+
+// syncSnapshot is the inventory an offline copy keeps: every pantry item and
+// freezer meal with its version, and the locations they can be put in.
+type syncSnapshot struct {
+	Pantry    []PantryItem  `json:"pantry"`
+	Freezer   []FreezerMeal `json:"freezer"`
+	Locations locations     `json:"locations"`
+}
+
+func newSyncSnapshot(store *Store, locs locations) syncSnapshot {
+	sortPantryItems(store.PantryItems)
+	sortFreezerMeals(store.FreezerMeals)
+	if locs == nil {
+		locs = locations{}
+	}
+	return syncSnapshot{Pantry: store.PantryItems, Freezer: store.FreezerMeals, Locations: locs}
+}
+
+// Sync operations and the kinds of item they apply to.
+const (
+	syncCreate = "create"
+	syncUpdate = "update"
+	syncDelete = "delete"
+
+	syncPantry  = "pantry"
+	syncFreezer = "freezer"
+)
+
+// Sync results: whether a change was applied or, if not, why.
+const (
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncMissing  = "missing"
+	syncInvalid  = "invalid"
+)
+
+// maxSyncChanges caps how many queued changes one sync can replay.
+const maxSyncChanges = 500
+
+// syncAttempts is how many times a sync is replayed when other saves keep
+// changing the same items before it can be saved.
+const syncAttempts = 3
+
+// syncChange is a change made while offline, replayed by POST /api/sync.
+// Updates and deletes carry the version of the item they were made to, so
+// one made to a copy that has since changed is reported as a conflict
+// rather than overwriting the newer copy.
+type syncChange struct {
+	// ID is the client's name for the change, echoed in its result.
+	ID      string       `json:"id"`
+	Op      string       `json:"op"`
+	Type    string       `json:"type"`
+	ItemID  int          `json:"item_id,omitempty"`
+	Version int          `json:"version,omitempty"`
+	Pantry  *PantryItem  `json:"pantry,omitempty"`
+	Freezer *FreezerMeal `json:"freezer,omitempty"`
+	// Outcome says whether a deleted item was eaten or binned.
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// syncResult says what became of a change. Applied changes give the item's
+// ID and new version; conflicts give the server's copy of the item, so the
+// client can show both.
+type syncResult struct {
+	ID      string       `json:"id"`
+	Status  string       `json:"status"`
+	ItemID  int          `json:"item_id,omitempty"`
+	Version int          `json:"version,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Fields  fieldErrors  `json:"fields,omitempty"`
+	Pantry  *PantryItem  `json:"pantry,omitempty"`
+	Freezer *FreezerMeal `json:"freezer,omitempty"`
+}
+
+// syncResponse is the reply to POST /api/sync: a result per change, in
+// order, and the inventory once they have been applied.
+type syncResponse struct {
+	Results []syncResult `json:"results"`
+	syncSnapshot
+}
+
+// syncDeletion is an item or meal a sync took out, with what became of it.
+// Exactly one of item and meal is set.
+type syncDeletion struct {
+	item    *PantryItem
+	meal    *FreezerMeal
+	outcome string
+}
+
+// applySync applies changes to store in order, checking places against locs.
+// It returns a result per change and what the deletes took out.
+func applySync(store *Store, locs locations, changes []syncChange) (results []syncResult, deleted []syncDeletion) {
+	results = make([]syncResult, len(changes))
+	for n, c := range changes {
+		res := syncResult{ID: c.ID, ItemID: c.ItemID}
+		switch {
+		case c.Type != syncPantry && c.Type != syncFreezer:
+			res.Status, res.Error = syncInvalid, "Type must be pantry or freezer"
+		case c.Op == syncCreate:
+			res = applyCreate(store, locs, c)
+		case c.Op == syncUpdate:
+			res = applyUpdate(store, locs, c)
+		case c.Op == syncDelete:
+			if c.Outcome != "" && c.Outcome != outcomeEaten && c.Outcome != outcomeBinned {
+				res.Status, res.Error = syncInvalid, "Outcome must be eaten or binned"
+				break
+			}
+			var d syncDeletion
+			if res, d = applyDelete(store, c); res.Status == syncApplied {
+				deleted = append(deleted, d)
+			}
+		default:
+			res.Status, res.Error = syncInvalid, "Op must be create, update or delete"
+		}
+		results[n] = res
+	}
+	return results, deleted
+}
+
+// applyCreate adds the item or meal in c to store, as the API's POST does.
+func applyCreate(store *Store, locs locations, c syncChange) syncResult {
+	res := syncResult{ID: c.ID}
+	if c.Type == syncPantry {
+		if c.Pantry == nil {
+			return syncResult{ID: c.ID, Status: syncInvalid, Error: "A pantry item is required"}
+		}
+		item := *c.Pantry
+		if errs := validateSyncedItem(&item, locs); len(errs) > 0 {
+			return syncResult{ID: c.ID, Status: syncInvalid, Fields: errs}
+		}
+		item.ID = store.NextPantryID
+		store.NextPantryID++
+		store.PantryItems = append(store.PantryItems, item)
+		res.ItemID = item.ID
+	} else {
+		if c.Freezer == nil {
+			return syncResult{ID: c.ID, Status: syncInvalid, Error: "A freezer meal is required"}
+		}
+		meal := *c.Freezer
+		if errs := validateSyncedMeal(&meal, locs); len(errs) > 0 {
+			return syncResult{ID: c.ID, Status: syncInvalid, Fields: errs}
+		}
+		meal.ID = store.NextMealID
+		meal.Ingredients = nil
+		store.NextMealID++
+		store.FreezerMeals = append(store.FreezerMeals, meal)
+		res.ItemID = meal.ID
+	}
+	res.Status = syncApplied
+	return res
+}
+
+// applyUpdate replaces the item or meal c was made to, as the edit forms do,
+// unless it has changed since c's version. A change that matches the current
+// copy anyway is applied, as there is nothing to choose between.
+func applyUpdate(store *Store, locs locations, c syncChange) syncResult {
+	res := syncResult{ID: c.ID, ItemID: c.ItemID}
+	if c.Type == syncPantry {
+		if c.Pantry == nil {
+			return syncResult{ID: c.ID, ItemID: c.ItemID, Status: syncInvalid, Error: "A pantry item is required"}
+		}
+		i := pantryIndex(store, c.ItemID)
+		if i < 0 {
+			res.Status = syncMissing
+			return res
+		}
+		current := store.PantryItems[i]
+		item := *c.Pantry
+		if errs := validateSyncedItem(&item, locs); len(errs) > 0 {
+			return syncResult{ID: c.ID, ItemID: c.ItemID, Status: syncInvalid, Fields: errs}
+		}
+		item.ID = current.ID
+		item.Batches = current.Batches
+		item.syncBatches()
+		if pantryConflicts(c.Version, item, current) {
+			res.Status, res.Pantry = syncConflict, &current
+			return res
+		}
+		store.PantryItems[i] = item
+	} else {
+		if c.Freezer == nil {
+			return syncResult{ID: c.ID, ItemID: c.ItemID, Status: syncInvalid, Error: "A freezer meal is required"}
+		}
+		i := freezerIndex(store, c.ItemID)
+		if i < 0 {
+			res.Status = syncMissing
+			return res
+		}
+		current := store.FreezerMeals[i]
+		meal := *c.Freezer
+		if errs := validateSyncedMeal(&meal, locs); len(errs) > 0 {
+			return syncResult{ID: c.ID, ItemID: c.ItemID, Status: syncInvalid, Fields: errs}
+		}
+		meal.ID = current.ID
+		meal.Ingredients = current.Ingredients
+		if mealConflicts(c.Version, meal, current) {
+			res.Status, res.Freezer = syncConflict, &current
+			return res
+		}
+		store.FreezerMeals[i] = meal
+	}
+	res.Status = syncApplied
+	return res
+}
+
+// applyDelete takes the item or meal c was made to out of store, unless it
+// has changed since c's version.
+func applyDelete(store *Store, c syncChange) (syncResult, syncDeletion) {
+	res := syncResult{ID: c.ID, ItemID: c.ItemID}
+	d := syncDeletion{outcome: c.Outcome}
+	if c.Type == syncPantry {
+		i := pantryIndex(store, c.ItemID)
+		if i < 0 {
+			res.Status = syncMissing
+			return res, d
+		}
+		current := store.PantryItems[i]
+		if c.Version != current.Version {
+			res.Status, res.Pantry = syncConflict, &current
+			return res, d
+		}
+		store.PantryItems = append(store.PantryItems[:i], store.PantryItems[i+1:]...)
+		res.Status, d.item = syncApplied, &current
+		return res, d
+	}
+	i := freezerIndex(store, c.ItemID)
+	if i < 0 {
+		res.Status = syncMissing
+		return res, d
+	}
+	current := store.FreezerMeals[i]
+	if c.Version != current.Version {
+		res.Status, res.Freezer = syncConflict, &current
+		return res, d
+	}
+	store.FreezerMeals = append(store.FreezerMeals[:i], store.FreezerMeals[i+1:]...)
+	res.Status, d.meal = syncApplied, &current
+	return res, d
+}
+
+// syncRemovals describes what became of deleted items for the waste log,
+// valuing pantry items from their price history.
+func syncRemovals(householdID int, deleted []syncDeletion) ([]*Removal, error) {
+	var items []PantryItem
+	for _, d := range deleted {
+		if d.item != nil && d.outcome != "" {
+			items = append(items, *d.item)
+		}
+	}
+	var values valuation
+	if len(items) > 0 {
+		var err error
+		if values, err = loadValuation(householdID, items); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	removals := make([]*Removal, 0, len(deleted))
+	for _, d := range deleted {
+		if d.item != nil {
+			value, _ := values.value(d.item.ID)
+			removals = append(removals, pantryRemoval(*d.item, d.outcome, value, now))
+		} else {
+			removals = append(removals, freezerRemoval(*d.meal, d.outcome, now))
+		}
+	}
+	return removals, nil
+}
+
+// validateSyncedItem tidies and checks a pantry item from a sync, with errors
+// keyed by JSON names as the API's are.
+func validateSyncedItem(item *PantryItem, locs locations) fieldErrors {
+	item.Tags = mergeTags(nil, item.Tags...)
+	sortTags(item.Tags)
+	errs := validatePantryItem(item)
+	errs.checkPlace("position", locs, item.LocationID, item.Position)
+	return errs
+}
+
+// validateSyncedMeal tidies and checks a freezer meal from a sync.
+func validateSyncedMeal(meal *FreezerMeal, locs locations) fieldErrors {
+	meal.Tags = mergeTags(nil, meal.Tags...)
+	sortTags(meal.Tags)
+	errs := validateFreezerMeal(meal)
+	errs.checkPlace("position", locs, meal.LocationID, meal.Position)
+	return errs
+}
+
+// apiSyncHandler serves the offline copy of the inventory (GET) and replays
+// the changes made while offline (POST), reporting each one's result with
+// the inventory as it now is.
+func apiSyncHandler(w http.ResponseWriter, r *http.Request) {
+	hh := householdID(r)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var req struct {
+		Changes []syncChange `json:"changes"`
+	}
+	if r.Method == http.MethodPost {
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if len(req.Changes) > maxSyncChanges {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Sync at most %d changes at once", maxSyncChanges))
+			return
+		}
+	}
+	store, err := loadStore(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	locs, err := loadLocations(hh)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, newSyncSnapshot(store, locs))
+		return
+	}
+
+	var results []syncResult
+	for attempt := 1; ; attempt++ {
+		var deleted []syncDeletion
+		results, deleted = applySync(store, locs, req.Changes)
+		applied := false
+		for _, res := range results {
+			applied = applied || res.Status == syncApplied
+		}
+		if !applied {
+			break
+		}
+		removals, err := syncRemovals(hh, deleted)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+		err = saveRemoval(hh, store, removals...)
+		if err == nil {
+			break
+		}
+		// Another save changed some of the same items while these were
+		// applied, so they are replayed against a fresh copy, where each is
+		// checked against what that save left.
+		if !errors.Is(err, errConflict) || attempt == syncAttempts {
+			writeSaveError(w, err)
+			return
+		}
+		if store, err = loadStore(hh); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load data")
+			return
+		}
+	}
+	// Saving set the versions the applied changes ended at.
+	for n, res := range results {
+		if res.Status != syncApplied || req.Changes[n].Op == syncDelete {
+			continue
+		}
+		if req.Changes[n].Type == syncPantry {
+			if i := pantryIndex(store, res.ItemID); i >= 0 {
+				results[n].Version = store.PantryItems[i].Version
+			}
+		} else if i := freezerIndex(store, res.ItemID); i >= 0 {
+			results[n].Version = store.FreezerMeals[i].Version
+		}
+	}
+	writeJSON(w, http.StatusOK, syncResponse{Results: results, syncSnapshot: newSyncSnapshot(store, locs)})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVersionsGoUpOnlyWhenItemsChange(t *testing.T) {
+	useTempDB(t)
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Rice", Quantity: "1 kg", Tags: []string{"Vegan", "gluten"}},
+			{ID: 2, Name: "Oats", Quantity: "500 g"},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextPantryID: 3,
+		NextMealID:   2,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+	if store.PantryItems[0].Version != 1 {
+		t.Errorf("expected saving to set new items' versions to 1, got %d", store.PantryItems[0].Version)
+	}
+
+	loaded, _ := loadStore(defaultHouseholdID)
+	rice := &loaded.PantryItems[pantryIndex(loaded, 1)]
+	rice.Quantity = "750 g"
+	if err := saveStore(defaultHouseholdID, loaded); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again unchanged, with tags in another order and case, is no
+	// change.
+	loaded, _ = loadStore(defaultHouseholdID)
+	loaded.PantryItems[pantryIndex(loaded, 1)].Tags = []string{"GLUTEN", "vegan"}
+	if err := saveStore(defaultHouseholdID, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _ = loadStore(defaultHouseholdID)
+	for id, want := range map[int]int{1: 2, 2: 1} {
+		if got := loaded.PantryItems[pantryIndex(loaded, id)].Version; got != want {
+			t.Errorf("item %d: expected version %d, got %d", id, want, got)
+		}
+	}
+	if got := loaded.FreezerMeals[0].Version; got != 1 {
+		t.Errorf("expected the untouched meal at version 1, got %d", got)
+	}
+}
+
+// insertLegacyRice stores a pantry item as a database from before checksums
+// has it: at version 1 with no checksum.
+func insertLegacyRice(t *testing.T) {
+	t.Helper()
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(
+		"INSERT INTO pantry_items (id, name, quantity, category, expiry, notes, household_id) VALUES (1, 'Rice', '1 kg', '', '', '', ?)",
+		defaultHouseholdID,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyItemVersionGoesUpWhenEdited(t *testing.T) {
+	useTempDB(t)
+	useEventHub(t)
+	insertLegacyRice(t)
+	ch, stop := itemEvents.subscribe(defaultHouseholdID)
+	defer stop()
+
+	store, _ := loadStore(defaultHouseholdID)
+	store.PantryItems[0].Quantity = "500 g"
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeEvents(drain(ch)); got != "updated pantry 1 v2" {
+		t.Errorf("expected an update to version 2, got %q", got)
+	}
+	if store, _ := loadStore(defaultHouseholdID); store.PantryItems[0].Version != 2 {
+		t.Errorf("expected the edited item at version 2, got %+v", store.PantryItems[0])
+	}
+}
+
+func postSync(t *testing.T, body string) syncResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	apiSyncHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var resp syncResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestSyncHandler(t *testing.T) {
+	setupHandlerTest(t)
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Rice", Quantity: "1 kg"}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Portions: "2"}},
+		NextPantryID: 2,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Someone else uses some rice while the offline copy still has version 1.
+	store, _ := loadStore(defaultHouseholdID)
+	store.PantryItems[0].Quantity = "500 g"
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := postSync(t, `{"changes": [
+		{"id": "1", "op": "create", "type": "pantry", "item_id": -5, "pantry": {"name": " Beans ", "quantity": "2 cans"}},
+		{"id": "2", "op": "update", "type": "pantry", "item_id": 1, "version": 1, "pantry": {"name": "Rice", "quantity": "250 g"}},
+		{"id": "3", "op": "delete", "type": "freezer", "item_id": 1, "version": 1, "outcome": "eaten"},
+		{"id": "4", "op": "update", "type": "pantry", "item_id": 99, "version": 1, "pantry": {"name": "Gone"}},
+		{"id": "5", "op": "create", "type": "freezer", "freezer": {"name": ""}},
+		{"id": "6", "op": "update", "type": "pantry", "item_id": 1, "version": 1, "pantry": {"name": "Rice", "quantity": "500 g"}}
+	]}`)
+
+	want := []string{syncApplied, syncConflict, syncApplied, syncMissing, syncInvalid, syncApplied}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), resp.Results)
+	}
+	for i, status := range want {
+		if got := resp.Results[i]; got.Status != status || got.ID != strconv.Itoa(i+1) {
+			t.Errorf("change %d: expected %s, got %+v", i+1, status, got)
+		}
+	}
+	if r := resp.Results[0]; r.ItemID != 2 || r.Version != 1 {
+		t.Errorf("expected the beans added as item 2 at version 1, got %+v", r)
+	}
+	if r := resp.Results[1]; r.Pantry == nil || r.Pantry.Quantity != "500 g" || r.Pantry.Version != 2 {
+		t.Errorf("expected the conflict to carry the current rice, got %+v", r.Pantry)
+	}
+	if r := resp.Results[4]; r.Fields["name"] == "" {
+		t.Errorf("expected the blank meal's name reported, got %+v", r)
+	}
+	// The same edit made on both sides isn't a conflict.
+	if r := resp.Results[5]; r.Version != 2 {
+		t.Errorf("expected the matching edit at version 2, got %+v", r)
+	}
+
+	names := make([]string, len(resp.Pantry))
+	for i, item := range resp.Pantry {
+		names[i] = item.Name
+	}
+	if strings.Join(names, ",") != "Beans,Rice" || len(resp.Freezer) != 0 {
+		t.Errorf("expected the beans added and the chilli gone, got %+v %+v", resp.Pantry, resp.Freezer)
+	}
+	months, err := monthlyRemovals(defaultHouseholdID, "2000-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eaten := 0
+	for _, outcomes := range months {
+		eaten += outcomes[outcomeEaten].Count
+	}
+	if eaten != 1 {
+		t.Errorf("expected the chilli logged as eaten, got %+v", months)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// euAllergens are the 14 allergens EU food labelling requires. They are
+// seeded as allergen tags so they can be picked from a fixed list.
+var euAllergens = []string{
+	"Celery",
+	"Cereals containing gluten",
+	"Crustaceans",
+	"Eggs",
+	"Fish",
+	"Lupin",
+	"Milk",
+	"Molluscs",
+	"Mustard",
+	"Tree nuts",
+	"Peanuts",
+	"Sesame seeds",
+	"Soya",
+	"Sulphur dioxide and sulphites",
+}
+
+// isAllergen reports whether name is one of the predefined allergen tags.
+func isAllergen(name string) bool {
+	for _, a := range euAllergens {
+		if strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag reports whether tags contains name, ignoring case.
+func hasTag(tags []string, name string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTags appends the tags not already present, ignoring case and blanks.
+func mergeTags(tags []string, more ...string) []string {
+	for _, t := range more {
+		t = strings.Join(strings.Fields(t), " ")
+		if t != "" && !hasTag(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// formTags reads tags from a form: ticked "allergen" checkboxes plus the
+// comma-separated free-form "tags" field.
+func formTags(r *http.Request) []string {
+	free := strings.Split(r.FormValue("tags"), ",") // parses the form
+	return mergeTags(mergeTags(nil, r.Form["allergen"]...), free...)
+}
+
+// ensureTag returns the ID of the tag called name, creating it if needed.
+// Names match case-insensitively, so "peanuts" finds the Peanuts allergen.
+func ensureTag(tx *sql.Tx, name string) (int, error) {
+	if _, err := tx.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", name); err != nil {
+		return 0, err
+	}
+	var id int
+	err := tx.QueryRow("SELECT id FROM tags WHERE name = ?", name).Scan(&id)
+	return id, err
+}
+
+// writeItemTags links a pantry item or freezer meal (itemType "pantry" or
+// "freezer") to its tags.
+func writeItemTags(tx *sql.Tx, itemType string, itemID int, tags []string) error {
+	for _, name := range tags {
+		tagID, err := ensureTag(tx, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO item_tags (item_type, item_id, tag_id) VALUES (?, ?, ?)",
+			itemType, itemID, tagID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags returns the allergens and the free-form tags a household uses,
+// allergens first. Other households' free-form tags are not shown.
+func loadTags(householdID int) ([]Tag, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, name, allergen FROM tags t
+		WHERE allergen = 1
+		   OR id IN (SELECT tag_id FROM item_tags WHERE item_type = 'pantry'
+		             AND item_id IN (SELECT id FROM pantry_items WHERE household_id = ?))
+		   OR id IN (SELECT tag_id FROM item_tags WHERE item_type = 'freezer'
+		             AND item_id IN (SELECT id FROM freezer_meals WHERE household_id = ?))
+		   OR id IN (SELECT tag_id FROM person_tags
+		             WHERE person_id IN (SELECT id FROM people WHERE household_id = ?))
+		ORDER BY allergen DESC, name COLLATE NOCASE`, householdID, householdID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Allergen); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// tagFilter narrows the inventory to items carrying every Include tag and
+// none of the Exclude tags.
+type tagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// parseTagFilter reads the filter from the "include" and "exclude" query
+// parameters, each of which may repeat.
+func parseTagFilter(r *http.Request) tagFilter {
+	q := r.URL.Query()
+	return tagFilter{
+		Include: mergeTags(nil, q["include"]...),
+		Exclude: mergeTags(nil, q["exclude"]...),
+	}
+}
+
+// Active reports whether the filter hides anything.
+func (f tagFilter) Active() bool {
+	return len(f.Include) > 0 || len(f.Exclude) > 0
+}
+
+// Includes and Excludes let the filter form keep its selection.
+func (f tagFilter) Includes(name string) bool { return hasTag(f.Include, name) }
+func (f tagFilter) Excludes(name string) bool { return hasTag(f.Exclude, name) }
+
+func (f tagFilter) matches(tags []string) bool {
+	for _, t := range f.Include {
+		if !hasTag(tags, t) {
+			return false
+		}
+	}
+	for _, t := range f.Exclude {
+		if hasTag(tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply removes the items and meals the filter doesn't match.
+func (f tagFilter) apply(store *Store) {
+	if !f.Active() {
+		return
+	}
+	items := store.PantryItems[:0]
+	for _, item := range store.PantryItems {
+		if f.matches(item.Tags) {
+			items = append(items, item)
+		}
+	}
+	store.PantryItems = items
+	meals := store.FreezerMeals[:0]
+	for _, meal := range store.FreezerMeals {
+		if f.matches(meal.Tags) {
+			meals = append(meals, meal)
+		}
+	}
+	store.FreezerMeals = meals
+}
+
+// tagURL links a tag badge to the index filtered to that tag.
+func tagURL(name string) string {
+	return "/?" + url.Values{"include": {name}}.Encode()
+}
+
+// loadPeople returns a household's members with the tags they avoid.
+func loadPeople(householdID int) ([]Person, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name FROM people WHERE household_id = ? ORDER BY name COLLATE NOCASE", householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	people := []Person{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var p Person
+		if err := rows.Scan(&p.ID, &p.Name); err != nil {
+			return nil, err
+		}
+		index[p.ID] = len(people)
+		people = append(people, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows2, err := db.Query(`
+		SELECT pt.person_id, t.name FROM person_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.person_id IN (SELECT id FROM people WHERE household_id = ?)
+		ORDER BY t.allergen DESC, t.name COLLATE NOCASE`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var personID int
+		var name string
+		if err := rows2.Scan(&personID, &name); err != nil {
+			return nil, err
+		}
+		if i, ok := index[personID]; ok {
+			people[i].Avoid = append(people[i].Avoid, name)
+		}
+	}
+	return people, rows2.Err()
+}
+
+func insertPerson(householdID int, p *Person) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO people (name, household_id) VALUES (?, ?)", p.Name, householdID)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.ID = int(id)
+	for _, name := range p.Avoid {
+		tagID, err := ensureTag(tx, name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO person_tags (person_id, tag_id) VALUES (?, ?)", p.ID, tagID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func deletePerson(householdID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM people WHERE id = ? AND household_id = ?", id, householdID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	for _, q := range []string{
+		"DELETE FROM person_tags WHERE person_id = ?",
+		"DELETE FROM meal_plan_people WHERE person_id = ?",
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// recipeTags collects the tags of the pantry items a recipe's ingredients are
+// matched to.
+func recipeTags(recipe *Recipe, items []PantryItem) []string {
+	byID := make(map[int][]string, len(items))
+	for _, item := range items {
+		byID[item.ID] = item.Tags
+	}
+	var tags []string
+	for _, ing := range recipe.Ingredients {
+		tags = mergeTags(tags, byID[ing.PantryItemID]...)
+	}
+	return tags
+}
+
+// tagWarnings lists who a meal with the given tags is unsuitable for, e.g.
+// "Sam avoids Peanuts". An empty peopleIDs means the meal is for everyone.
+func tagWarnings(tags []string, people []Person, peopleIDs []int) []string {
+	var warnings []string
+	for _, p := range people {
+		if len(peopleIDs) > 0 && !containsInt(peopleIDs, p.ID) {
+			continue
+		}
+		var clash []string
+		for _, avoid := range p.Avoid {
+			if hasTag(tags, avoid) {
+				clash = append(clash, avoid)
+			}
+		}
+		if len(clash) > 0 {
+			warnings = append(warnings, p.Name+" avoids "+strings.Join(clash, ", "))
+		}
+	}
+	return warnings
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// peoplePage is the data for the household page.
+type peoplePage struct {
+	People    []Person
+	Allergens []string
+}
+
+func peopleHandler(w http.ResponseWriter, r *http.Request) {
+	people, err := loadPeople(householdID(r))
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	render(w, r, "people.html", peoplePage{People: people, Allergens: euAllergens})
+}
+
+// addPersonHandler adds a household member. The tags they avoid come from
+// the same allergen checkboxes and free-form field as item forms.
+func addPersonHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/people", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Redirect(w, r, "/people", http.StatusSeeOther)
+		return
+	}
+	p := Person{Name: name, Avoid: formTags(r)}
+	if err := insertPerson(householdID(r), &p); err != nil {
+		saveFailed(w, r, "/people", err)
+		return
+	}
+	http.Redirect(w, r, "/people", http.StatusSeeOther)
+}
+
+func deletePersonHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/people", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/people", http.StatusSeeOther)
+		return
+	}
+	if err := deletePerson(householdID(r), id); err != nil {
+		saveFailed(w, r, "/people", err)
+		return
+	}
+	http.Redirect(w, r, "/people", http.StatusSeeOther)
+}
+
+// sortTags orders tags allergens first, then alphabetically.
+func sortTags(tags []string) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		ai, aj := isAllergen(tags[i]), isAllergen(tags[j])
+		if ai != aj {
+			return ai
+		}
+		return strings.ToLower(tags[i]) < strings.ToLower(tags[j])
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInitDBSeedsAllergens(t *testing.T) {
+	useTempDB(t)
+
+	tags, err := loadTags(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allergens := 0
+	for _, tag := range tags {
+		if tag.Allergen {
+			allergens++
+		}
+	}
+	if allergens != 14 {
+		t.Errorf("expected the 14 EU allergens, got %d", allergens)
+	}
+}
+
+func TestSaveAndLoadTags(t *testing.T) {
+	useTempDB(t)
+
+	store := &Store{
+		PantryItems:  []PantryItem{{ID: 1, Name: "Peanut butter", Tags: []string{"vegetarian", "peanuts"}}},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Chilli", Tags: []string{"meat"}}},
+		NextPantryID: 2,
+		NextMealID:   2,
+	}
+	if err := saveStore(defaultHouseholdID, store); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Allergens come first and take the seeded tag's spelling.
+	if got := strings.Join(loaded.PantryItems[0].Tags, ","); got != "Peanuts,vegetarian" {
+		t.Errorf("expected pantry tags Peanuts,vegetarian, got %q", got)
+	}
+	if got := strings.Join(loaded.FreezerMeals[0].Tags, ","); got != "meat" {
+		t.Errorf("expected freezer tags meat, got %q", got)
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Peanut butter", Tags: []string{"Peanuts", "vegetarian"}},
+			{ID: 2, Name: "Lentils", Tags: []string{"vegetarian"}},
+			{ID: 3, Name: "Corned beef", Tags: []string{"meat"}},
+		},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Dal", Tags: []string{"Vegetarian"}}},
+	}
+	tagFilter{Include: []string{"vegetarian"}, Exclude: []string{"peanuts"}}.apply(store)
+
+	if len(store.PantryItems) != 1 || store.PantryItems[0].Name != "Lentils" {
+		t.Errorf("expected only Lentils, got %+v", store.PantryItems)
+	}
+	if len(store.FreezerMeals) != 1 {
+		t.Errorf("expected the vegetarian meal to stay, got %+v", store.FreezerMeals)
+	}
+}
+
+func TestTagWarnings(t *testing.T) {
+	people := []Person{
+		{ID: 1, Name: "Sam", Avoid: []string{"Peanuts"}},
+		{ID: 2, Name: "Alex", Avoid: []string{"meat"}},
+	}
+	tags := []string{"Peanuts", "vegetarian"}
+
+	if got := tagWarnings(tags, people, nil); len(got) != 1 || got[0] != "Sam avoids Peanuts" {
+		t.Errorf("expected a warning for Sam, got %v", got)
+	}
+	if got := tagWarnings(tags, people, []int{2}); len(got) != 0 {
+		t.Errorf("expected no warning when only Alex is eating, got %v", got)
+	}
+}
+
+func TestApplyBatchCookCopiesTags(t *testing.T) {
+	store := &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Satay sauce", Tags: []string{"Peanuts"}},
+			{ID: 2, Name: "Chicken", Tags: []string{"meat"}},
+		},
+		NextMealID: 1,
+	}
+	meal := FreezerMeal{Name: "Satay chicken", Tags: []string{"spicy"}}
+	if err := applyBatchCook(store, meal, []batchUse{{ItemID: 1}, {ItemID: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.FreezerMeals[0].Tags, ","); got != "Peanuts,meat,spicy" {
+		t.Errorf("expected the meal to inherit its ingredients' tags, got %q", got)
+	}
+}
+
+func TestAddPantryHandlerSavesTags(t *testing.T) {
+	setupHandlerTest(t)
+
+	form := url.Values{
+		"name":     {"Pesto"},
+		"allergen": {"Tree nuts", "Milk"},
+		"tags":     {"vegetarian, , jar"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/pantry/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	addPantryHandler(w, req)
+
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.PantryItems[0].Tags, ","); got != "Milk,Tree nuts,jar,vegetarian" {
+		t.Errorf("expected allergens then free-form tags, got %q", got)
+	}
+}
+
+func TestIndexHandlerFiltersByTag(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems: []PantryItem{
+			{ID: 1, Name: "Peanut butter", Tags: []string{"Peanuts"}},
+			{ID: 2, Name: "Lentils"},
+		},
+		FreezerMeals: []FreezerMeal{},
+		NextPantryID: 3,
+		NextMealID:   1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?exclude=Peanuts", nil)
+	w := httptest.NewRecorder()
+	indexHandler(w, req)
+
+	body := w.Body.String()
+	if strings.Contains(body, "Peanut butter") || !strings.Contains(body, "Lentils") {
+		t.Errorf("expected peanut items to be hidden")
+	}
+}
+
+func TestPlanHandlerWarnsAboutAllergens(t *testing.T) {
+	setupHandlerTest(t)
+
+	if err := saveStore(defaultHouseholdID, &Store{
+		PantryItems:  []PantryItem{},
+		FreezerMeals: []FreezerMeal{{ID: 1, Name: "Satay", Portions: "4", Tags: []string{"Peanuts"}}},
+		NextPantryID: 1,
+		NextMealID:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sam := Person{Name: "Sam", Avoid: []string{"peanuts"}}
+	if err := insertPerson(defaultHouseholdID, &sam); err != nil {
+		t.Fatal(err)
+	}
+	entry := MealPlanEntry{Date: today(), FreezerMealID: 1, Portions: 1, PeopleIDs: []int{sam.ID}}
+	if err := insertMealPlanEntry(defaultHouseholdID, &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/plan", nil)
+	w := httptest.NewRecorder()
+	planHandler(w, req)
+
+	if !strings.Contains(w.Body.String(), "Sam avoids Peanuts") {
+		t.Errorf("expected an allergen warning on the plan")
+	}
+}
@@ -2,33 +2,34 @@ package main
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
+	"net/http"
+	"strings"
 	"time"
 )
 
 var tmpl *template.Template
 
 var funcMap = template.FuncMap{
+	"isAllergen": isAllergen,
+	"tagURL":     tagURL,
+	"allergens":  func() []string { return euAllergens },
+	"categories": func() []string { return pantryCategories },
+	"joinTags":   func(tags []string) string { return strings.Join(tags, ",") },
+	"staticURL":  staticURL,
+	"currency":   func() string { return config.Currency },
+	// Placeholders for the request-bound functions set by render.
+	"currentUser":      func() *User { return nil },
+	"currentHousehold": func() Household { return Household{} },
+	"memberHouseholds": func() []Household { return nil },
+	"csrfField":        func() template.HTML { return "" },
+	"csrfToken":        func() string { return "" },
+	"flashes":          func() []flash { return nil },
 	"isExpired": func(expiry string) bool {
-		if expiry == "" {
-			return false
-		}
-		t, err := time.Parse("2006-01-02", expiry)
-		if err != nil {
-			return false
-		}
-		return time.Now().After(t)
+		return isExpired(expiry, time.Now())
 	},
 	"isExpiringSoon": func(expiry string) bool {
-		if expiry == "" {
-			return false
-		}
-		t, err := time.Parse("2006-01-02", expiry)
-		if err != nil {
-			return false
-		}
-		now := time.Now()
-		return !now.After(t) && t.Before(now.Add(7*24*time.Hour))
+		return isExpiringSoon(expiry, time.Now())
 	},
 	"categoryClass": func(category string) string {
 		classes := map[string]string{
@@ -61,29 +62,107 @@ var funcMap = template.FuncMap{
 		return days
 	},
 	"freezerAgeClass": func(dateFrozen string) string {
-		if dateFrozen == "" {
-			return "age-fresh"
-		}
-		t, err := time.Parse("2006-01-02", dateFrozen)
-		if err != nil {
-			return "age-fresh"
-		}
-		days := int(time.Since(t).Hours() / 24)
-		switch {
-		case days > 90:
-			return "age-old"
-		case days > 30:
-			return "age-medium"
-		default:
-			return "age-fresh"
-		}
+		return "age-" + freezerAge(dateFrozen, time.Now())
 	},
 }
 
+// isExpired reports whether a pantry item's expiry date has passed.
+func isExpired(expiry string, now time.Time) bool {
+	if expiry == "" {
+		return false
+	}
+	t, err := time.Parse("2006-01-02", expiry)
+	if err != nil {
+		return false
+	}
+	return now.After(t)
+}
+
+// isExpiringSoon reports whether a pantry item expires within the configured
+// warning window, but hasn't expired yet.
+func isExpiringSoon(expiry string, now time.Time) bool {
+	if expiry == "" {
+		return false
+	}
+	t, err := time.Parse("2006-01-02", expiry)
+	if err != nil {
+		return false
+	}
+	window := time.Duration(config.Warnings.ExpiryDays) * 24 * time.Hour
+	return !now.After(t) && t.Before(now.Add(window))
+}
+
+// freezerAge buckets a freezer meal by how long it has been frozen: "fresh",
+// "medium" once past the aging threshold and "old" past the old one.
+func freezerAge(dateFrozen string, now time.Time) string {
+	if dateFrozen == "" {
+		return "fresh"
+	}
+	t, err := time.Parse("2006-01-02", dateFrozen)
+	if err != nil {
+		return "fresh"
+	}
+	days := int(now.Sub(t).Hours() / 24)
+	switch {
+	case days > config.Warnings.FreezerOldDays:
+		return "old"
+	case days > config.Warnings.FreezerAgingDays:
+		return "medium"
+	default:
+		return "fresh"
+	}
+}
+
 func initTemplates() {
 	var err error
-	tmpl, err = template.New("index.html").Funcs(funcMap).ParseFiles("templates/index.html")
+	tmpl, err = parseTemplates()
+	if err != nil {
+		fatal("failed to parse templates", "err", err)
+	}
+}
+
+func parseTemplates() (*template.Template, error) {
+	return template.New("index.html").Funcs(funcMap).ParseFS(assetFS(), "templates/*.html")
+}
+
+// pageTemplates returns a copy of the templates to bind request functions to.
+// In dev mode they are parsed afresh, so edits show on the next reload.
+func pageTemplates() (*template.Template, error) {
+	if config.Dev {
+		return parseTemplates()
+	}
+	return tmpl.Clone()
+}
+
+// render executes a page template with the functions that depend on the
+// request, such as the logged-in user and household shown in the header, the
+// CSRF token every form posts and any flash messages waiting to be shown.
+func render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	renderStatus(w, r, http.StatusOK, name, data)
+}
+
+// renderStatus is render with a status other than 200, such as for a form
+// shown again with errors.
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	t, err := pageTemplates()
 	if err != nil {
-		log.Fatal("Failed to parse template:", err)
+		slog.Error("template failed", "template", name, "err", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+	// Flashes are taken before anything is written so the cookie can be
+	// cleared.
+	flashes := takeFlashes(w, r)
+	t.Funcs(template.FuncMap{
+		"currentUser":      func() *User { return currentUser(r) },
+		"currentHousehold": func() Household { return currentHousehold(r) },
+		"memberHouseholds": func() []Household { return memberHouseholds(r) },
+		"csrfField":        func() template.HTML { return csrfField(r) },
+		"csrfToken":        func() string { return csrfToken(r) },
+		"flashes":          func() []flash { return flashes },
+	})
+	w.WriteHeader(status)
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("template failed", "template", name, "err", err)
 	}
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API token scopes. Read-only tokens may only make GET and HEAD requests.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// createAPIToken issues a token for a user in a household and returns the
+// secret, which is shown once and never stored.
+func createAPIToken(userID, householdID int, name, scope string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("token name is required")
+	}
+	if scope != scopeRead && scope != scopeWrite {
+		return "", errors.New("scope must be read or write")
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(
+		"INSERT INTO api_tokens (user_id, household_id, name, token_hash, scope, created) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, householdID, name, hashToken(token), scope, time.Now().UTC().Format(time.RFC3339),
+	)
+	return token, err
+}
+
+// loadAPITokens returns a user's tokens, newest first.
+func loadAPITokens(userID int) ([]APIToken, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT t.id, t.user_id, t.household_id, COALESCE(h.name, ''), t.name, t.scope, t.created, COALESCE(t.last_used, '')
+		FROM api_tokens t
+		LEFT JOIN households h ON h.id = t.household_id
+		WHERE t.user_id = ?
+		ORDER BY t.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.HouseholdID, &t.Household, &t.Name, &t.Scope, &t.Created, &t.LastUsed); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// revokeAPIToken deletes one of a user's tokens. Other users' tokens are left
+// alone.
+func revokeAPIToken(userID, id int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// apiTokenUser returns the token and its user for a bearer token, or nils if
+// the token is unknown, and records that it was used.
+func apiTokenUser(token string) (*User, *APIToken, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	u := &User{}
+	t := &APIToken{}
+	err = db.QueryRow(`
+		SELECT u.id, u.username, u.password_hash, u.admin, t.id, t.household_id, t.name, t.scope
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?`, hashToken(token),
+	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Admin, &t.ID, &t.HouseholdID, &t.Name, &t.Scope)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	t.UserID = u.ID
+	t.LastUsed = time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE api_tokens SET last_used = ? WHERE id = ?", t.LastUsed, t.ID); err != nil {
+		return nil, nil, err
+	}
+	return u, t, nil
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok
+}
+
+// currentAPIToken returns the token a request was authenticated with, or nil
+// for a browser session.
+func currentAPIToken(r *http.Request) *APIToken {
+	t, _ := r.Context().Value(apiTokenKey).(*APIToken)
+	return t
+}
+
+// tokenAuth authenticates a request by API token instead of a session. The
+// request acts on the token's household, as long as its user still belongs
+// to it. It returns nil after writing an error response.
+func tokenAuth(w http.ResponseWriter, r *http.Request, token string) *http.Request {
+	user, t, err := apiTokenUser(token)
+	if err != nil {
+		http.Error(w, "Failed to load session", http.StatusInternalServerError)
+		return nil
+	}
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cupboard"`)
+		http.Error(w, "Invalid API token", http.StatusUnauthorized)
+		return nil
+	}
+	if t.Scope != scopeWrite && !isSafeMethod(r.Method) {
+		http.Error(w, "This API token is read-only", http.StatusForbidden)
+		return nil
+	}
+	households, err := userHouseholds(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return nil
+	}
+	for _, h := range households {
+		if h.ID == t.HouseholdID {
+			r = withHousehold(withUser(r, user), h, []Household{h})
+			return r.WithContext(context.WithValue(r.Context(), apiTokenKey, t))
+		}
+	}
+	http.Error(w, "This API token's household is no longer available to its owner", http.StatusForbidden)
+	return nil
+}
+
+// requireSession keeps a handler to browser sessions, so a leaked API token
+// can't be used to mint more tokens.
+func requireSession(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentAPIToken(r) != nil {
+			http.Error(w, "Not available to API tokens", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// settingsPage is the data for the personal settings page. NewToken is only
+// set straight after a token is created.
+type settingsPage struct {
+	Tokens   []APIToken
+	NewToken string
+	Error    string
+}
+
+func renderSettings(w http.ResponseWriter, r *http.Request, page settingsPage) {
+	tokens, err := loadAPITokens(currentUser(r).ID)
+	if err != nil {
+		http.Error(w, "Failed to load data", http.StatusInternalServerError)
+		return
+	}
+	page.Tokens = tokens
+	status := http.StatusOK
+	if page.Error != "" {
+		status = http.StatusBadRequest
+	}
+	renderStatus(w, r, status, "settings.html", page)
+}
+
+func settingsHandler(w http.ResponseWriter, r *http.Request) {
+	renderSettings(w, r, settingsPage{})
+}
+
+// addTokenHandler creates a token for the current household and shows it
+// once.
+func addTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	token, err := createAPIToken(currentUser(r).ID, householdID(r), r.FormValue("name"), r.FormValue("scope"))
+	if err != nil {
+		renderSettings(w, r, settingsPage{Error: err.Error()})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	renderSettings(w, r, settingsPage{NewToken: token})
+}
+
+func revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	if err := revokeAPIToken(currentUser(r).ID, id); err != nil {
+		saveFailed(w, r, "/settings", err)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
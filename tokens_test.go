@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func apiRequest(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	return w
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	setupHandlerTest(t)
+	loginAs(t, "sam", false)
+	u, err := loadUserByName("sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly, err := createAPIToken(u.ID, defaultHouseholdID, "dashboard", scopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readWrite, err := createAPIToken(u.ID, defaultHouseholdID, "Home Assistant", scopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := apiRequest(t, http.MethodPost, "/api/pantry", readOnly, `{"name":"Rice"}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 writing with a read-only token, got %d", w.Code)
+	}
+	// Bearer requests need no CSRF token.
+	w := apiRequest(t, http.MethodPost, "/api/pantry", readWrite, `{"name":"Rice","quantity":"1 kg","tags":["vegan"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = apiRequest(t, http.MethodGet, "/api/pantry", readOnly, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var items []PantryItem
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Name != "Rice" || items[0].Quantity != "1 kg" {
+		t.Errorf("expected the item added through the API, got %+v", items)
+	}
+
+	tokens, err := loadAPITokens(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens {
+		if tok.LastUsed == "" {
+			t.Errorf("expected %s to record when it was last used", tok.Name)
+		}
+	}
+}
+
+func TestAPITokenRejectedWhenUnknownOrRevoked(t *testing.T) {
+	setupHandlerTest(t)
+	loginAs(t, "sam", false)
+	u, err := loadUserByName("sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := createAPIToken(u.ID, defaultHouseholdID, "script", scopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := apiRequest(t, http.MethodGet, "/api/pantry", "not-a-token", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", w.Code)
+	}
+	tokens, err := loadAPITokens(u.ID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("expected one token, got %+v, %v", tokens, err)
+	}
+	if err := revokeAPIToken(u.ID, tokens[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := apiRequest(t, http.MethodGet, "/api/pantry", token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a revoked token, got %d", w.Code)
+	}
+}
+
+func TestAPITokenActsOnItsHousehold(t *testing.T) {
+	setupHandlerTest(t)
+	other := seedTwoHouseholds(t)
+	loginAs(t, "sam", false)
+	u, err := loadUserByName("sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addHouseholdMember(other.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	token, err := createAPIToken(u.ID, other.ID, "flat", scopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := apiRequest(t, http.MethodGet, "/api/pantry", token, "")
+	if body := w.Body.String(); !strings.Contains(body, "Caviar") || strings.Contains(body, "Rice") {
+		t.Errorf("expected only Flat 2's items, got %s", body)
+	}
+
+	// Leaving the household disables the token.
+	if err := removeHouseholdMember(other.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := apiRequest(t, http.MethodGet, "/api/pantry", token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 once the owner left the household, got %d", w.Code)
+	}
+}
+
+func TestSettingsCreatesTokenAndRefusesBearer(t *testing.T) {
+	setupHandlerTest(t)
+	cookie := loginAs(t, "sam", false)
+
+	form := url.Values{"name": {"Home Assistant"}, "scope": {scopeWrite}, csrfFormField: {sessionCSRFToken(cookie.Value)}}
+	req := httptest.NewRequest(http.MethodPost, "/settings/tokens/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	u, err := loadUserByName("sam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := loadAPITokens(u.ID)
+	if err != nil || len(tokens) != 1 || tokens[0].Scope != scopeWrite {
+		t.Fatalf("expected one read-write token, got %+v, %v", tokens, err)
+	}
+	// The page shows the secret once; only its hash is stored.
+	body := w.Body.String()
+	start := strings.Index(body, `class="token-value" value="`)
+	if start < 0 {
+		t.Fatal("expected the new token to be shown")
+	}
+	secret := body[start+len(`class="token-value" value="`):]
+	secret = secret[:strings.Index(secret, `"`)]
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var stored string
+	if err := db.QueryRow("SELECT token_hash FROM api_tokens").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == secret || stored != hashToken(secret) {
+		t.Error("expected the token to be stored hashed")
+	}
+
+	if w := apiRequest(t, http.MethodGet, "/settings", secret, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected API tokens to be refused on the settings page, got %d", w.Code)
+	}
+}
+
+func TestAdminPagesRefuseAPITokens(t *testing.T) {
+	setupHandlerTest(t)
+	loginAs(t, "root", true)
+	u, err := loadUserByName("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := createAPIToken(u.ID, defaultHouseholdID, "scripts", scopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := url.Values{"username": {"mallory"}, "password": {"correct horse"}, "admin": {"on"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/users/add", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected an admin's token to be refused on /users/add, got %d", w.Code)
+	}
+	if u, _ := loadUserByName("mallory"); u != nil {
+		t.Error("expected no account to be created")
+	}
+	if w := apiRequest(t, http.MethodGet, "/metrics", token, ""); w.Code != http.StatusOK {
+		t.Errorf("expected an admin's token to still read metrics, got %d", w.Code)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// pantryCategories are the categories a pantry item can be filed under, in
+// the order the forms list them.
+var pantryCategories = []string{
+	"Canned Goods",
+	"Dry Goods",
+	"Spices",
+	"Condiments",
+	"Baking",
+	"Snacks",
+	"Beverages",
+	"Other",
+}
+
+// Field length limits, counted in characters.
+const (
+	maxNameLength     = 100
+	maxQuantityLength = 50
+	maxNotesLength    = 1000
+	maxTagLength      = 40
+	maxTags           = 20
+)
+
+// fieldErrors maps a form field name to what is wrong with it.
+type fieldErrors map[string]string
+
+// check records msg against field unless ok.
+func (e fieldErrors) check(ok bool, field, msg string) {
+	if !ok {
+		if _, seen := e[field]; !seen {
+			e[field] = msg
+		}
+	}
+}
+
+// checkLength records an error if value is longer than max characters.
+func (e fieldErrors) checkLength(field, label, value string, max int) {
+	e.check(utf8.RuneCountInString(value) <= max, field, fmt.Sprintf("%s must be at most %d characters.", label, max))
+}
+
+// checkDate records an error unless value is empty or a YYYY-MM-DD date.
+func (e fieldErrors) checkDate(field, label, value string) {
+	if value == "" {
+		return
+	}
+	_, err := time.Parse("2006-01-02", value)
+	e.check(err == nil, field, label+" must be a date like 2026-01-31.")
+}
+
+func (e fieldErrors) checkTags(tags []string) {
+	e.check(len(tags) <= maxTags, "tags", fmt.Sprintf("Use at most %d tags.", maxTags))
+	for _, t := range tags {
+		e.checkLength("tags", "Each tag", t, maxTagLength)
+	}
+}
+
+func isPantryCategory(category string) bool {
+	for _, c := range pantryCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePantryItem tidies an item's fields and reports what is wrong with
+// them, if anything.
+func validatePantryItem(item *PantryItem) fieldErrors {
+	item.Name = strings.TrimSpace(item.Name)
+	item.Quantity = strings.TrimSpace(item.Quantity)
+	item.Expiry = strings.TrimSpace(item.Expiry)
+	item.Notes = strings.TrimSpace(item.Notes)
+	errs := fieldErrors{}
+	errs.check(item.Name != "", "name", "Name is required.")
+	errs.checkLength("name", "Name", item.Name, maxNameLength)
+	errs.checkLength("quantity", "Quantity", item.Quantity, maxQuantityLength)
+	errs.check(item.Category == "" || isPantryCategory(item.Category), "category", "Pick a category from the list.")
+	errs.checkDate("expiry", "Expiry date", item.Expiry)
+	errs.checkLength("notes", "Notes", item.Notes, maxNotesLength)
+	errs.checkTags(item.Tags)
+	for i := range item.Batches {
+		batchErrs := validateBatch(&item.Batches[i])
+		for _, field := range []string{"quantity", "expiry", "purchased"} {
+			if msg, ok := batchErrs[field]; ok {
+				errs.check(false, "batches", fmt.Sprintf("Batch %d: %s", i+1, msg))
+			}
+		}
+	}
+	item.syncBatches()
+	return errs
+}
+
+// validateFreezerMeal tidies a meal's fields and reports what is wrong with
+// them, if anything.
+func validateFreezerMeal(meal *FreezerMeal) fieldErrors {
+	meal.Name = strings.TrimSpace(meal.Name)
+	meal.Portions = strings.TrimSpace(meal.Portions)
+	meal.DateFrozen = strings.TrimSpace(meal.DateFrozen)
+	meal.Description = strings.TrimSpace(meal.Description)
+	errs := fieldErrors{}
+	errs.check(meal.Name != "", "name", "Name is required.")
+	errs.checkLength("name", "Name", meal.Name, maxNameLength)
+	errs.checkLength("portions", "Portions", meal.Portions, maxQuantityLength)
+	errs.checkDate("date_frozen", "Date frozen", meal.DateFrozen)
+	errs.checkLength("description", "Description", meal.Description, maxNotesLength)
+	errs.checkTags(meal.Tags)
+	return errs
+}
+
+func pantryItemFromForm(r *http.Request) PantryItem {
+	item := PantryItem{
+		Name:     r.FormValue("name"),
+		Quantity: r.FormValue("quantity"),
+		Category: r.FormValue("category"),
+		Expiry:   r.FormValue("expiry"),
+		Notes:    r.FormValue("notes"),
+		Tags:     formTags(r),
+	}
+	item.LocationID, item.Position = parsePlace(r.FormValue("place"))
+	return item
+}
+
+func freezerMealFromForm(r *http.Request) FreezerMeal {
+	meal := FreezerMeal{
+		Name:        r.FormValue("name"),
+		Portions:    r.FormValue("portions"),
+		DateFrozen:  r.FormValue("date_frozen"),
+		Description: r.FormValue("description"),
+		Tags:        formTags(r),
+	}
+	meal.LocationID, meal.Position = parsePlace(r.FormValue("place"))
+	return meal
+}
+
+// formID reads the "id" field, writing a 400 response if it isn't a number.
+func formID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid or missing id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// formState is a submitted form that failed validation. The index page
+// reopens its Modal ("add-pantry", "edit-freezer", ...) with the user's
+// input and an error under each bad field. The zero value means no form
+// failed.
+type formState struct {
+	Modal  string
+	Values url.Values
+	Tags   []string
+	Errors fieldErrors
+	// Duplicate is the existing item an add looks like a copy of, offered
+	// to be topped up instead.
+	Duplicate *PantryItem
+}
+
+// Value returns what was submitted for field if modal is the failed form.
+func (f formState) Value(modal, field string) string {
+	if f.Modal != modal {
+		return ""
+	}
+	return f.Values.Get(field)
+}
+
+// Error returns the message for field if modal is the failed form.
+func (f formState) Error(modal, field string) string {
+	if f.Modal != modal {
+		return ""
+	}
+	return f.Errors[field]
+}
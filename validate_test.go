@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidatePantryItem(t *testing.T) {
+	item := PantryItem{
+		Name:     "  " + strings.Repeat("x", maxNameLength+1),
+		Category: "Frozen",
+		Expiry:   "31/01/2026",
+		Tags:     []string{strings.Repeat("t", maxTagLength+1)},
+	}
+	errs := validatePantryItem(&item)
+	for _, field := range []string{"name", "category", "expiry", "tags"} {
+		if errs[field] == "" {
+			t.Errorf("expected an error for %s, got %v", field, errs)
+		}
+	}
+	if _, ok := errs["quantity"]; ok {
+		t.Errorf("expected no error for an empty quantity, got %v", errs)
+	}
+
+	good := PantryItem{Name: " Rice ", Category: "Dry Goods", Expiry: "2026-01-31"}
+	if errs := validatePantryItem(&good); len(errs) != 0 || good.Name != "Rice" {
+		t.Errorf("expected a valid, trimmed item, got %+v, %v", good, errs)
+	}
+}
+
+func TestValidateFreezerMeal(t *testing.T) {
+	meal := FreezerMeal{Name: "Chilli", DateFrozen: "2026-02-30"}
+	if errs := validateFreezerMeal(&meal); errs["date_frozen"] == "" {
+		t.Errorf("expected an impossible date to be rejected, got %v", errs)
+	}
+}
+
+func TestInvalidFormKeepsInput(t *testing.T) {
+	setupHandlerTest(t)
+
+	form := url.Values{
+		"name":     {"Chickpeas"},
+		"quantity": {"2 cans"},
+		"expiry":   {"next week"},
+		"notes":    {"for hummus"},
+		"tags":     {"vegan"},
+	}
+	w := postForm(addPantryHandler, "/pantry/add", form)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`value="Chickpeas"`, `value="2 cans"`, `value="next week"`, `>for hummus</textarea>`,
+		"Expiry date must be a date", `openModal("add-pantry" + '-modal')`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the re-rendered form to contain %q", want)
+		}
+	}
+	store, err := loadStore(defaultHouseholdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.PantryItems) != 0 {
+		t.Errorf("expected nothing saved, got %+v", store.PantryItems)
+	}
+}
+
+func TestEditAndDeleteUnknownIDs(t *testing.T) {
+	setupHandlerTest(t)
+
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		id      string
+		want    int
+	}{
+		{editPantryHandler, "42", http.StatusNotFound},
+		{deletePantryHandler, "42", http.StatusNotFound},
+		{editFreezerHandler, "42", http.StatusNotFound},
+		{deleteFreezerHandler, "42", http.StatusNotFound},
+		{editPantryHandler, "abc", http.StatusBadRequest},
+		{deleteFreezerHandler, "", http.StatusBadRequest},
+	} {
+		w := postForm(tc.handler, "/", url.Values{"id": {tc.id}, "version": {"1"}, "name": {"Anything"}})
+		if w.Code != tc.want {
+			t.Errorf("id %q: expected %d, got %d", tc.id, tc.want, w.Code)
+		}
+	}
+}
+
+func TestAPIRejectsInvalidItem(t *testing.T) {
+	setupHandlerTest(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/pantry", strings.NewReader(`{"name":"Rice","expiry":"soon"}`))
+	w := httptest.NewRecorder()
+	apiPantryHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"expiry"`) {
+		t.Errorf("expected 422 naming the expiry field, got %d %s", w.Code, w.Body.String())
+	}
+}